@@ -4,28 +4,68 @@ import (
 	"context"
 	"errors"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // the runtime image has no zoneinfo, needed for the TZ sessions send
 
 	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
+	"notion_ssh_app/internal/app/blobs"
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/gitstore"
 	middlewares "notion_ssh_app/internal/app/middlewares"
+	"notion_ssh_app/internal/app/notify"
+	"notion_ssh_app/internal/app/web"
 )
 
 const (
-	host = "0.0.0.0"
-	port = "23236"
+	host     = "0.0.0.0"
+	port     = "23236"
+	httpPort = "23237" // serves published notes
 )
 
 func main() {
+	if err := db.Migrate(); err != nil {
+		log.Error("Could not migrate database", "error", err)
+	}
+
+	encrypted, err := db.EncryptionEnabled()
+	if err != nil {
+		log.Fatal("Could not load the master key", "error", err)
+	}
+	if encrypted {
+		// Both run while serving: sessions read notes under either master key, sealed or not
+		go func() {
+			if n, err := db.RotateKeys(); err != nil {
+				log.Error("Could not rewrap data keys", "error", err)
+			} else if n > 0 {
+				log.Info("Rewrapped data keys with the current master key", "keys", n)
+			}
+			if n, err := db.EncryptNotes(); err != nil {
+				log.Error("Could not encrypt notes", "error", err)
+			} else if n > 0 {
+				log.Info("Encrypted notes stored in plaintext", "notes", n)
+			}
+			if n, err := db.EncryptCopies(); err != nil {
+				log.Error("Could not encrypt copies of notes", "error", err)
+			} else if n > 0 {
+				log.Info("Encrypted comments, notifications, reminders, templates and values stored in plaintext", "rows", n)
+			}
+		}()
+	}
+
 	s, err := wish.NewServer(
 		wish.WithAddress(net.JoinHostPort(host, port)),
 		wish.WithHostKeyPath(".ssh/id_ed25519"),
+		middlewares.Authentication(),
 		wish.WithMiddleware(
 			middlewares.ListMiddleware(),
+			middlewares.CommandMiddleware(),
+			middlewares.AttachmentsMiddleware(),
 		),
 	)
 	if err != nil {
@@ -42,11 +82,41 @@ func main() {
 		}
 	}()
 
+	h := &http.Server{Addr: net.JoinHostPort(host, httpPort), Handler: web.Handler()}
+	log.Info("Starting HTTP server", "host", host, "port", httpPort)
+	go func() {
+		if err := h.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Could not start HTTP server", "error", err)
+			done <- nil
+		}
+	}()
+
+	// Blobs of attachments deleted with their note or user while the server was down
+	go func() {
+		if err := blobs.Purge(); err != nil {
+			log.Error("Could not purge deleted attachments", "error", err)
+		}
+	}()
+
+	if gitstore.Enabled() {
+		log.Info("Mirroring notes into git", "dir", gitstore.Dir())
+	} else if gitstore.Dir() != "" {
+		log.Warn("Not mirroring notes into git, the repositories would hold encrypted notes in plaintext", "dir", gitstore.Dir())
+	}
+
+	// Reminders are persisted, so the ones due while the server was down fire right away
+	reminders, stopReminders := context.WithCancel(context.Background())
+	go notify.RunReminders(reminders, 30*time.Second)
+
 	<-done
+	stopReminders()
 	log.Info("Stopping SSH server")
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer func() { cancel() }()
 	if err := s.Shutdown(ctx); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
 		log.Error("Could not stop server", "error", err)
 	}
+	if err := h.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("Could not stop HTTP server", "error", err)
+	}
 }
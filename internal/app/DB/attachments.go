@@ -0,0 +1,331 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// defaultAttachmentQuota is how much a user may upload when ATTACHMENT_QUOTA_MB is not set
+const defaultAttachmentQuota = 100 << 20
+
+// ErrQuotaExceeded is returned for uploads that do not fit in what is left of the uploader's quota
+var ErrQuotaExceeded = errors.New("attachment quota exceeded")
+
+// ErrPrivateNote is returned for uploads to private notes. Blobs and file names are stored
+// unsealed, so they would give away what the passphrase keeps from everyone else.
+var ErrPrivateNote = errors.New("private notes cannot have attachments")
+
+// ErrHasAttachments is returned when a note with attachments is saved as private
+var ErrHasAttachments = errors.New("remove the attachments before making the note private")
+
+// ErrNoAttachment is returned for attachments that do not exist or belong to notes the user cannot read
+var ErrNoAttachment = errors.New("no such attachment")
+
+// ErrAttachmentLinkInvalid is returned for download links that expired or never existed
+var ErrAttachmentLinkInvalid = errors.New("attachment link is invalid or expired")
+
+// Define the attachment model struct, the contents are in the blob store under BlobKey
+type Attachment struct {
+	ID          int
+	NoteID      int
+	UserID      int // who uploaded it, the size counts against their quota
+	Name        string
+	Size        int64
+	ContentType string
+	BlobKey     string
+	CreatedAt   time.Time
+}
+
+// attachmentColumns are scanned by scanAttachment
+const attachmentColumns = `a.id, a."noteId", a."userId", a.name, a.size, a."contentType", a."blobKey", a."createdAt"`
+
+// scanAttachment reads the attachmentColumns of a row
+func scanAttachment(row interface{ Scan(...any) error }) (Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.NoteID, &a.UserID, &a.Name, &a.Size, &a.ContentType, &a.BlobKey, &a.CreatedAt)
+	return a, err
+}
+
+// AttachmentQuota is how many bytes each user may upload in total, set in megabytes with
+// ATTACHMENT_QUOTA_MB
+func AttachmentQuota() int64 {
+	if mb, err := strconv.ParseInt(os.Getenv("ATTACHMENT_QUOTA_MB"), 10, 64); err == nil && mb >= 0 {
+		return mb << 20
+	}
+	return defaultAttachmentQuota
+}
+
+// AttachmentUsage returns how many bytes the user uploaded, across every note
+func AttachmentUsage(userID int) (int64, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var used int64
+	err = db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM "Attachment" WHERE "userId" = $1`, userID).Scan(&used)
+	return used, err
+}
+
+// notePrivate fails with ErrPrivateNote when the note is private. Within a transaction the
+// note stays as it is until the transaction ends.
+func notePrivate(db queryer, noteID int) error {
+	var private bool
+	err := db.QueryRow(`SELECT COALESCE("private", false) FROM "Note" WHERE id = $1 FOR SHARE`, noteID).Scan(&private)
+	if err == nil && private {
+		return ErrPrivateNote
+	}
+	return err
+}
+
+// AttachmentSpace returns how many bytes the user may still attach, failing with ErrForbidden
+// unless they can edit the note and with ErrPrivateNote when it is private
+func AttachmentSpace(noteID, userID int) (int64, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleEditor); err != nil {
+		return 0, err
+	}
+	if err := notePrivate(db, noteID); err != nil {
+		return 0, err
+	}
+	var used int64
+	err = db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM "Attachment" WHERE "userId" = $1`, userID).Scan(&used)
+	return max(AttachmentQuota()-used, 0), err
+}
+
+// AddAttachment records a file whose contents were stored under a.BlobKey. The quota is
+// checked again under a lock on the uploader, since uploads may run side by side, and the
+// note is locked so it cannot be made private before the attachment is in.
+func AddAttachment(a Attachment) (Attachment, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return a, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, a.NoteID, a.UserID, models.RoleEditor); err != nil {
+		return a, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return a, err
+	}
+	defer tx.Rollback()
+
+	if err := notePrivate(tx, a.NoteID); err != nil {
+		return a, err
+	}
+	if _, err := tx.Exec(`SELECT id FROM "User" WHERE id = $1 FOR UPDATE`, a.UserID); err != nil {
+		return a, err
+	}
+	var used int64
+	if err := tx.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM "Attachment" WHERE "userId" = $1`, a.UserID).Scan(&used); err != nil {
+		return a, err
+	}
+	if used+a.Size > AttachmentQuota() {
+		return a, ErrQuotaExceeded
+	}
+
+	query := `
+        INSERT INTO "Attachment" ("noteId", "userId", name, size, "contentType", "blobKey")
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, "createdAt";
+    `
+	if err := tx.QueryRow(query, a.NoteID, a.UserID, a.Name, a.Size, a.ContentType, a.BlobKey).Scan(&a.ID, &a.CreatedAt); err != nil {
+		return a, err
+	}
+	return a, tx.Commit()
+}
+
+// NoteAttachments lists the files attached to a note the user can read, oldest first
+func NoteAttachments(noteID, userID int) ([]Attachment, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT `+attachmentColumns+` FROM "Attachment" a WHERE a."noteId" = $1 ORDER BY a.id`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// FetchAttachment returns an attachment of a note the user can read
+func FetchAttachment(id, userID int) (Attachment, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return Attachment{}, err
+	}
+	defer db.Close()
+
+	a, err := scanAttachment(db.QueryRow(`SELECT `+attachmentColumns+` FROM "Attachment" a WHERE a.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return a, ErrNoAttachment
+	}
+	if err != nil {
+		return a, err
+	}
+	if _, err := requireRole(db, a.NoteID, userID, models.RoleViewer); err == ErrForbidden {
+		return Attachment{}, ErrNoAttachment
+	} else if err != nil {
+		return Attachment{}, err
+	}
+	return a, nil
+}
+
+// FindAttachment returns the latest file attached to the note under that name
+func FindAttachment(noteID, userID int, name string) (Attachment, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return Attachment{}, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleViewer); err != nil {
+		return Attachment{}, err
+	}
+	query := `SELECT ` + attachmentColumns + ` FROM "Attachment" a WHERE a."noteId" = $1 AND a.name = $2 ORDER BY a.id DESC LIMIT 1`
+	a, err := scanAttachment(db.QueryRow(query, noteID, name))
+	if err == sql.ErrNoRows {
+		return a, ErrNoAttachment
+	}
+	return a, err
+}
+
+// DeleteAttachment removes an attachment, which editors of its note and its uploader may do.
+// Its blob is left in the trash for blobs.Purge.
+func DeleteAttachment(id, userID int) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var noteID, uploaderID int
+	err = db.QueryRow(`SELECT "noteId", "userId" FROM "Attachment" WHERE id = $1`, id).Scan(&noteID, &uploaderID)
+	if err == sql.ErrNoRows {
+		return ErrNoAttachment
+	}
+	if err != nil {
+		return err
+	}
+	if uploaderID != userID {
+		if _, err := requireRole(db, noteID, userID, models.RoleEditor); err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec(`DELETE FROM "Attachment" WHERE id = $1`, id)
+	return err
+}
+
+// CreateAttachmentLink returns a token to download an attachment of a note the user can read,
+// as often as needed before it expires
+func CreateAttachmentLink(id, userID int, lifetime time.Duration) (string, time.Time, error) {
+	if _, err := FetchAttachment(id, userID); err != nil {
+		return "", time.Time{}, err
+	}
+
+	db, err := OpenDB()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer db.Close()
+
+	token, err := newSlug()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(lifetime)
+	_, err = db.Exec(`INSERT INTO "AttachmentLink" (token, "attachmentId", "expiresAt") VALUES ($1, $2, $3)`, token, id, expiresAt)
+	return token, expiresAt, err
+}
+
+// AttachmentByLink returns the attachment a download token was created for
+func AttachmentByLink(token string) (Attachment, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return Attachment{}, err
+	}
+	defer db.Close()
+
+	query := `
+        SELECT ` + attachmentColumns + ` FROM "AttachmentLink" l
+        JOIN "Attachment" a ON a.id = l."attachmentId"
+        WHERE l.token = $1 AND l."expiresAt" > now();
+    `
+	a, err := scanAttachment(db.QueryRow(query, token))
+	if err == sql.ErrNoRows {
+		return a, ErrAttachmentLinkInvalid
+	}
+	return a, err
+}
+
+// TrashedBlobs lists the blobs of deleted attachments that are still in the blob store
+func TrashedBlobs() ([]string, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT "blobKey" FROM "BlobTrash" ORDER BY "deletedAt"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ForgetBlobs empties the trash of blobs that were removed from the blob store, and the
+// expired attachment links along with it
+func ForgetBlobs(keys []string) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`DELETE FROM "BlobTrash" WHERE "blobKey" = ANY($1)`, pq.Array(keys)); err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM "AttachmentLink" WHERE "expiresAt" < now()`)
+	return err
+}
@@ -0,0 +1,547 @@
+package db
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/vault"
+)
+
+// RestoreReport tells what a restore created, or would create for a dry run
+type RestoreReport struct {
+	Workspace   string // name of the workspace created, empty for a personal backup
+	Notes       int
+	Collections int
+	Comments    int
+	Templates   int
+	Undated     int      // daily notes restored as regular notes, their day being taken already
+	Others      []string // people of the backup besides the restoring user, given nothing; their notes and comments go to the restoring user
+}
+
+// backupScope restricts alias to the records of a workspace, or to the personal ones of a user,
+// given as $1
+func backupScope(alias string, workspaceID int) string {
+	if workspaceID != 0 {
+		return alias + `."workspaceId" = $1`
+	}
+	return alias + `."userId" = $1 AND ` + alias + `."workspaceId" IS NULL`
+}
+
+// ReadBackup copies a workspace the user manages, or their personal notes when workspaceID is 0
+func ReadBackup(userID, workspaceID int) (models.Backup, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return models.Backup{}, err
+	}
+	defer db.Close()
+
+	b := models.Backup{CreatedAt: time.Now().UTC()}
+	scopeID := userID
+	if workspaceID != 0 {
+		role, err := workspaceRole(db, workspaceID, userID)
+		if err != nil {
+			return b, err
+		}
+		if !role.CanManage() {
+			return b, ErrForbidden
+		}
+		scopeID = workspaceID
+		b.Workspace = &models.BackupWorkspace{}
+		if err := db.QueryRow(`SELECT name FROM "Workspace" WHERE id = $1`, workspaceID).Scan(&b.Workspace.Name); err != nil {
+			return b, err
+		}
+		query := `
+            SELECT u.email, m.role FROM "WorkspaceMember" m JOIN "User" u ON u.id = m."userId"
+            WHERE m."workspaceId" = $1 ORDER BY u.email;
+        `
+		err = scanRows(db, query, []any{workspaceID}, func(rows *sql.Rows) error {
+			var m models.BackupMember
+			err := rows.Scan(&m.Email, &m.Role)
+			b.Workspace.Members = append(b.Workspace.Members, m)
+			return err
+		})
+		if err != nil {
+			return b, err
+		}
+	}
+
+	// Databases and their columns
+	collectionIndex := map[int]int{}
+	query := `
+        SELECT c.id, c.name, u.email, c."createdAt" FROM "Collection" c JOIN "User" u ON u.id = c."userId"
+        WHERE ` + backupScope("c", workspaceID) + ` ORDER BY c.id;
+    `
+	err = scanRows(db, query, []any{scopeID}, func(rows *sql.Rows) error {
+		var c models.BackupCollection
+		err := rows.Scan(&c.ID, &c.Name, &c.Owner, &c.CreatedAt)
+		collectionIndex[c.ID] = len(b.Collections)
+		b.Collections = append(b.Collections, c)
+		return err
+	})
+	if err != nil {
+		return b, err
+	}
+	query = `
+        SELECT p.id, p."collectionId", p.name, p.type, p.options, COALESCE(p."relationId", 0), p.position
+        FROM "CollectionProperty" p JOIN "Collection" c ON c.id = p."collectionId"
+        WHERE ` + backupScope("c", workspaceID) + ` ORDER BY p.position, p.id;
+    `
+	err = scanRows(db, query, []any{scopeID}, func(rows *sql.Rows) error {
+		var p models.BackupProperty
+		var collectionID int
+		if err := rows.Scan(&p.ID, &collectionID, &p.Name, &p.Type, pq.Array(&p.Options), &p.RelationID, &p.Position); err != nil {
+			return err
+		}
+		// Relations to databases outside the backup cannot be restored
+		if _, ok := collectionIndex[p.RelationID]; !ok {
+			p.RelationID = 0
+		}
+		c := &b.Collections[collectionIndex[collectionID]]
+		c.Properties = append(c.Properties, p)
+		return nil
+	})
+	if err != nil {
+		return b, err
+	}
+
+	// Notes, then everything hanging off them
+	noteIndex := map[int]int{}
+	query = `
+        SELECT n.id, n.title, n.description, n.content, n."private", n.version, u.email, n."createdAt", n."updatedAt",
+            COALESCE(to_char(n."dueDate", 'YYYY-MM-DD'), ''), COALESCE(to_char(n."dailyDate", 'YYYY-MM-DD'), ''),
+            COALESCE(n."collectionId", 0)
+        FROM "Note" n JOIN "User" u ON u.id = n."userId"
+        WHERE ` + backupScope("n", workspaceID) + ` ORDER BY n.id;
+    `
+	err = scanRows(db, query, []any{scopeID}, func(rows *sql.Rows) error {
+		var n models.BackupNote
+		err := rows.Scan(&n.ID, &n.Title, &n.Description, &n.Content, &n.Private, &n.Version, &n.Owner, &n.CreatedAt, &n.UpdatedAt,
+			&n.Due, &n.Daily, &n.CollectionID)
+		if err != nil {
+			return err
+		}
+		// Backups are plaintext, restoring seals them with the data keys of their new home
+		if err := decrypt(db, at("Note", n.ID), noteFields(&n.Title, &n.Description, &n.Content)...); err != nil {
+			return err
+		}
+		noteIndex[n.ID] = len(b.Notes)
+		b.Notes = append(b.Notes, n)
+		return nil
+	})
+	if err != nil {
+		return b, err
+	}
+	note := func(id int) *models.BackupNote { return &b.Notes[noteIndex[id]] }
+
+	query = `
+        SELECT v."noteId", v."propertyId", p.type, v.value FROM "PropertyValue" v
+        JOIN "Note" n ON n.id = v."noteId" JOIN "CollectionProperty" p ON p.id = v."propertyId"
+        WHERE ` + backupScope("n", workspaceID) + `;
+    `
+	err = scanRows(db, query, []any{scopeID}, func(rows *sql.Rows) error {
+		var noteID, propertyID int
+		var kind models.PropertyType
+		var value string
+		if err := rows.Scan(&noteID, &propertyID, &kind, &value); err != nil {
+			return err
+		}
+		if err := decrypt(db, at("PropertyValue", noteID, propertyID), field{"value", &value}); err != nil {
+			return err
+		}
+		if kind == models.PropertyRelation {
+			var ids []string
+			for _, id := range models.SplitList(value) {
+				if related, err := strconv.Atoi(id); err == nil {
+					if _, ok := noteIndex[related]; ok {
+						ids = append(ids, id)
+					}
+				}
+			}
+			value = strings.Join(ids, ",")
+		}
+		n := note(noteID)
+		if n.Values == nil {
+			n.Values = map[string]string{}
+		}
+		n.Values[strconv.Itoa(propertyID)] = value
+		return nil
+	})
+	if err != nil {
+		return b, err
+	}
+
+	query = `
+        SELECT s."noteId", u.email, s.role FROM "NoteShare" s
+        JOIN "Note" n ON n.id = s."noteId" JOIN "User" u ON u.id = s."userId"
+        WHERE ` + backupScope("n", workspaceID) + ` ORDER BY s."noteId", u.email;
+    `
+	err = scanRows(db, query, []any{scopeID}, func(rows *sql.Rows) error {
+		var noteID int
+		var s models.BackupMember
+		err := rows.Scan(&noteID, &s.Email, &s.Role)
+		note(noteID).Shares = append(note(noteID).Shares, s)
+		return err
+	})
+	if err != nil {
+		return b, err
+	}
+
+	query = `
+        SELECT f."noteId", u.email FROM "NoteFollow" f
+        JOIN "Note" n ON n.id = f."noteId" JOIN "User" u ON u.id = f."userId"
+        WHERE ` + backupScope("n", workspaceID) + ` ORDER BY f."noteId", u.email;
+    `
+	err = scanRows(db, query, []any{scopeID}, func(rows *sql.Rows) error {
+		var noteID int
+		var email string
+		err := rows.Scan(&noteID, &email)
+		note(noteID).Followers = append(note(noteID).Followers, email)
+		return err
+	})
+	if err != nil {
+		return b, err
+	}
+
+	commentNote := map[int]int{}
+	query = `
+        SELECT c.id, c."noteId", COALESCE(c."parentId", 0), u.email, c."lineStart", c."lineEnd", c.body, c.resolved,
+            c."createdAt", c."updatedAt"
+        FROM "Comment" c JOIN "Note" n ON n.id = c."noteId" JOIN "User" u ON u.id = c."authorId"
+        WHERE ` + backupScope("n", workspaceID) + ` ORDER BY c.id;
+    `
+	err = scanRows(db, query, []any{scopeID}, func(rows *sql.Rows) error {
+		var c models.BackupComment
+		var noteID int
+		if err := rows.Scan(&c.ID, &noteID, &c.ParentID, &c.Author, &c.LineStart, &c.LineEnd, &c.Body, &c.Resolved, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return err
+		}
+		if err := decrypt(db, at("Comment", c.ID), field{"body", &c.Body}); err != nil {
+			return err
+		}
+		commentNote[c.ID] = noteID
+		note(noteID).Comments = append(note(noteID).Comments, c)
+		return nil
+	})
+	if err != nil {
+		return b, err
+	}
+	query = `
+        SELECT m."commentId", u.email FROM "CommentMention" m
+        JOIN "Comment" c ON c.id = m."commentId" JOIN "Note" n ON n.id = c."noteId" JOIN "User" u ON u.id = m."userId"
+        WHERE ` + backupScope("n", workspaceID) + ` ORDER BY m."commentId", u.email;
+    `
+	err = scanRows(db, query, []any{scopeID}, func(rows *sql.Rows) error {
+		var commentID int
+		var email string
+		if err := rows.Scan(&commentID, &email); err != nil {
+			return err
+		}
+		comments := note(commentNote[commentID]).Comments
+		for index := range comments {
+			if comments[index].ID == commentID {
+				comments[index].Mentions = append(comments[index].Mentions, email)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return b, err
+	}
+
+	query = `
+        SELECT t.id, t.name, u.email, t.title, t.description, t.content, t."createdAt"
+        FROM "NoteTemplate" t JOIN "User" u ON u.id = t."userId"
+        WHERE ` + backupScope("t", workspaceID) + ` ORDER BY t.id;
+    `
+	err = scanRows(db, query, []any{scopeID}, func(rows *sql.Rows) error {
+		var t models.BackupTemplate
+		var id int
+		if err := rows.Scan(&id, &t.Name, &t.Author, &t.Title, &t.Description, &t.Content, &t.CreatedAt); err != nil {
+			return err
+		}
+		if err := decrypt(db, at("NoteTemplate", id), templateFields(&t.Name, &t.Title, &t.Description, &t.Content)...); err != nil {
+			return err
+		}
+		b.Templates = append(b.Templates, t)
+		return nil
+	})
+	if err != nil {
+		return b, err
+	}
+	return b, b.Seal()
+}
+
+// scanRows runs query and hands each row to scan
+func scanRows(db *sql.DB, query string, args []any, scan func(*sql.Rows) error) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// RestoreBackup recreates a verified backup for the user: a workspace backup as a new workspace
+// they own, named name when given, a personal backup among their personal notes. Every record
+// gets a new ID and belongs to the user. A dry run does the same work and rolls it back.
+func RestoreBackup(userID int, b models.Backup, name string, dryRun bool) (RestoreReport, error) {
+	var report RestoreReport
+	if err := b.Verify(); err != nil {
+		return report, err
+	}
+	db, err := OpenDB()
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	// Anyone can edit a backup and its checksum, so the people it names are not trusted: nobody
+	// but the restoring user is made a member, shared with, subscribed or mentioned, and what
+	// others wrote becomes theirs. They are listed so the restoring user can invite them again.
+	var self string
+	if err := tx.QueryRow(`SELECT email FROM "User" WHERE id = $1`, userID).Scan(&self); err != nil {
+		return report, err
+	}
+	others := map[string]bool{}
+	other := func(emails ...string) {
+		for _, email := range emails {
+			if email != self && !others[email] {
+				others[email] = true
+				report.Others = append(report.Others, email)
+			}
+		}
+	}
+	if b.Workspace != nil {
+		for _, m := range b.Workspace.Members {
+			other(m.Email)
+		}
+	}
+	for _, c := range b.Collections {
+		other(c.Owner)
+	}
+	for _, n := range b.Notes {
+		other(n.Owner)
+		for _, s := range n.Shares {
+			other(s.Email)
+		}
+		other(n.Followers...)
+		for _, c := range n.Comments {
+			other(c.Author)
+			other(c.Mentions...)
+		}
+	}
+	for _, t := range b.Templates {
+		other(t.Author)
+	}
+	sort.Strings(report.Others)
+
+	var workspace sql.NullInt64
+	if b.Workspace != nil {
+		report.Workspace = b.Workspace.Name
+		if name != "" {
+			report.Workspace = name
+		}
+		var id int64
+		if err := tx.QueryRow(`INSERT INTO "Workspace" (name) VALUES ($1) RETURNING id`, report.Workspace).Scan(&id); err != nil {
+			return report, err
+		}
+		workspace = sql.NullInt64{Int64: id, Valid: true}
+		query := `INSERT INTO "WorkspaceMember" ("workspaceId", "userId", role) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(query, id, userID, models.WorkspaceOwner); err != nil {
+			return report, err
+		}
+	}
+
+	collections := map[int]int{}
+	properties := map[int]int{}
+	relations := map[int]int{}   // new property ID to the backup ID of the related collection
+	holdsNotes := map[int]bool{} // backup IDs of relation properties, whose values are note IDs
+	for _, c := range b.Collections {
+		var id int
+		query := `INSERT INTO "Collection" (name, "userId", "workspaceId", "createdAt") VALUES ($1, $2, $3, $4) RETURNING id`
+		if err := tx.QueryRow(query, c.Name, userID, workspace, c.CreatedAt).Scan(&id); err != nil {
+			return report, err
+		}
+		collections[c.ID] = id
+		report.Collections++
+		for _, p := range c.Properties {
+			options := p.Options
+			if options == nil {
+				options = []string{}
+			}
+			var propertyID int
+			query := `
+                INSERT INTO "CollectionProperty" ("collectionId", name, type, options, position)
+                VALUES ($1, $2, $3, $4, $5) RETURNING id;
+            `
+			if err := tx.QueryRow(query, id, p.Name, p.Type, pq.Array(options), p.Position).Scan(&propertyID); err != nil {
+				return report, err
+			}
+			properties[p.ID] = propertyID
+			holdsNotes[p.ID] = p.Type == models.PropertyRelation
+			if p.RelationID != 0 {
+				relations[propertyID] = p.RelationID
+			}
+		}
+	}
+	for propertyID, relationID := range relations {
+		if _, err := tx.Exec(`UPDATE "CollectionProperty" SET "relationId" = $1 WHERE id = $2`, collections[relationID], propertyID); err != nil {
+			return report, err
+		}
+	}
+
+	// In the transaction, a restored workspace only exists there
+	notes := map[int]int{}
+	noteSealer, err := newSealer(tx, userID, int(workspace.Int64))
+	if err != nil {
+		return report, err
+	}
+	for _, n := range b.Notes {
+		id, err := nextID(tx, "Note")
+		if err != nil {
+			return report, err
+		}
+		title, description, content := n.Title, n.Description, n.Content
+		if err := noteSealer.sealAll(at("Note", id), noteFields(&title, &description, &content)...); err != nil {
+			return report, err
+		}
+		due := sql.NullString{String: n.Due, Valid: n.Due != ""}
+		daily := sql.NullString{String: n.Daily, Valid: n.Daily != ""}
+		if daily.Valid {
+			var taken bool
+			query := `SELECT EXISTS (SELECT 1 FROM "Note" WHERE "userId" = $1 AND "dailyDate" = $2)`
+			if err := tx.QueryRow(query, userID, daily).Scan(&taken); err != nil {
+				return report, err
+			}
+			if taken {
+				daily = sql.NullString{}
+				report.Undated++
+			}
+		}
+		collection := sql.NullInt64{Int64: int64(collections[n.CollectionID]), Valid: n.CollectionID != 0}
+		version := max(n.Version, 1)
+		// Backups made before the flag existed only tell private notes by their sealed content
+		private := n.Private || vault.IsSealed(n.Content)
+
+		query := `
+            INSERT INTO "Note" (id, title, description, content, "private", "userId", "workspaceId", "collectionId", version,
+                "createdAt", "updatedAt", "dueDate", "dailyDate")
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
+        `
+		_, err = tx.Exec(query, id, title, description, content, private, userID, workspace, collection, version,
+			n.CreatedAt, n.UpdatedAt, due, daily)
+		if err != nil {
+			return report, err
+		}
+		if err := indexTasks(tx, noteSealer, id, n.Content); err != nil {
+			return report, err
+		}
+		notes[n.ID] = id
+		report.Notes++
+
+		for _, email := range n.Followers {
+			if email == self {
+				query := `INSERT INTO "NoteFollow" ("noteId", "userId") VALUES ($1, $2) ON CONFLICT DO NOTHING`
+				if _, err := tx.Exec(query, id, userID); err != nil {
+					return report, err
+				}
+			}
+		}
+
+		comments := map[int]int{}
+		for _, c := range n.Comments {
+			// Comments of others keep who wrote them in their text only
+			body := c.Body
+			if c.Author != self {
+				body = "(" + c.Author + ") " + body
+			}
+			commentID, err := nextID(tx, "Comment")
+			if err != nil {
+				return report, err
+			}
+			if body, err = noteSealer.seal(at("Comment", commentID), "body", body); err != nil {
+				return report, err
+			}
+			parent := sql.NullInt64{Int64: int64(comments[c.ParentID]), Valid: c.ParentID != 0}
+			query := `
+                INSERT INTO "Comment" (id, "noteId", "authorId", "parentId", "lineStart", "lineEnd", body, resolved, "createdAt", "updatedAt")
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+            `
+			_, err = tx.Exec(query, commentID, id, userID, parent, c.LineStart, c.LineEnd, body, c.Resolved, c.CreatedAt, c.UpdatedAt)
+			if err != nil {
+				return report, err
+			}
+			comments[c.ID] = commentID
+			report.Comments++
+			for _, email := range c.Mentions {
+				if email == self {
+					query := `INSERT INTO "CommentMention" ("commentId", "userId") VALUES ($1, $2) ON CONFLICT DO NOTHING`
+					if _, err := tx.Exec(query, commentID, userID); err != nil {
+						return report, err
+					}
+				}
+			}
+		}
+	}
+
+	// Values last, relations point at notes that now all have their new IDs
+	for _, n := range b.Notes {
+		for id, value := range n.Values {
+			propertyID, _ := strconv.Atoi(id)
+			if holdsNotes[propertyID] {
+				var ids []string
+				for _, related := range models.SplitList(value) {
+					relatedID, _ := strconv.Atoi(related)
+					ids = append(ids, strconv.Itoa(notes[relatedID]))
+				}
+				value = strings.Join(ids, ",")
+			} else if value, err = noteSealer.seal(at("PropertyValue", notes[n.ID], properties[propertyID]), "value", value); err != nil {
+				return report, err
+			}
+			query := `INSERT INTO "PropertyValue" ("noteId", "propertyId", value) VALUES ($1, $2, $3)`
+			if _, err := tx.Exec(query, notes[n.ID], properties[propertyID], value); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	for _, t := range b.Templates {
+		id, err := nextID(tx, "NoteTemplate")
+		if err != nil {
+			return report, err
+		}
+		if err := noteSealer.sealAll(at("NoteTemplate", id), templateFields(&t.Name, &t.Title, &t.Description, &t.Content)...); err != nil {
+			return report, err
+		}
+		query := `
+            INSERT INTO "NoteTemplate" (id, name, "userId", "workspaceId", title, description, content, "createdAt")
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+        `
+		if _, err := tx.Exec(query, id, t.Name, userID, workspace, t.Title, t.Description, t.Content, t.CreatedAt); err != nil {
+			return report, err
+		}
+		report.Templates++
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	return report, tx.Commit()
+}
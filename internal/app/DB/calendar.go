@@ -0,0 +1,111 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// DateField is a date of a note the calendar can place it by
+type DateField string
+
+const (
+	DateCreated DateField = "created"
+	DateUpdated DateField = "updated"
+	DateDue     DateField = "due"
+)
+
+// dateColumns maps the fields to the columns holding them, so queries never take them from input
+var dateColumns = map[DateField]string{
+	DateCreated: `n."createdAt"`,
+	DateUpdated: `n."updatedAt"`,
+	DateDue:     `n."dueDate"`,
+}
+
+// CalendarEntry is a note placed on a day of the calendar
+type CalendarEntry struct {
+	Date time.Time
+	Item models.ListItemViewModel
+}
+
+// FetchCalendar fetches the notes of a workspace (0 for personal notes) the user has access to
+// whose field falls in [from, to), earliest first. Dates are returned in loc, in which the
+// day boundaries are taken.
+func FetchCalendar(userID, workspaceID int, field DateField, from, to time.Time, loc *time.Location) ([]CalendarEntry, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	column := dateColumns[field]
+	if field == DateDue {
+		// Due dates have no time of day, compare them as dates
+		from, to = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC), time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	query := `
+        SELECT id, version, title, description, content, "private", "userId", role, owner, "workspaceId", "dueDate", date FROM (
+            SELECT n.id, n.version, n.title, n.description, n.content, n."private", n."userId", n."dueDate",
+                ` + noteRoleSQL + ` AS role,
+                CASE WHEN n."userId" = $1 THEN '' ELSE u.email END AS owner,
+                COALESCE(n."workspaceId", 0) AS "workspaceId",
+                ` + column + ` AS date
+            FROM "Note" n
+            JOIN "User" u ON u.id = n."userId"
+            ` + noteAccessSQL + `
+            WHERE COALESCE(n."workspaceId", 0) = $2 AND ` + column + ` >= $3 AND ` + column + ` < $4
+        ) notes
+        WHERE role <> 'none'
+        ORDER BY date, id;
+    `
+	rows, err := db.Query(query, userID, workspaceID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []CalendarEntry
+	for rows.Next() {
+		var e CalendarEntry
+		var role string
+		var due sql.NullTime
+		if err := rows.Scan(&e.Item.ID, &e.Item.Version, &e.Item.ItemTitle, &e.Item.Desc, &e.Item.Content, &e.Item.Private, &e.Item.AuthorID,
+			&role, &e.Item.Owner, &e.Item.WorkspaceID, &due, &e.Date); err != nil {
+			return nil, err
+		}
+		if err := decryptItem(db, &e.Item); err != nil {
+			return nil, err
+		}
+		e.Item.Role = models.ParseRole(role)
+		e.Item.Due = due.Time
+		if field == DateDue {
+			// Keep the calendar day of the due date whatever the zone
+			e.Date = time.Date(e.Date.Year(), e.Date.Month(), e.Date.Day(), 0, 0, 0, 0, loc)
+		} else {
+			e.Date = e.Date.In(loc)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// SetDueDate sets or, with a zero date, clears the due date of a note; editors may change it
+func SetDueDate(noteID, userID int, due time.Time) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleEditor); err != nil {
+		return err
+	}
+
+	var value sql.NullString
+	if !due.IsZero() {
+		value = sql.NullString{String: due.Format(models.DateLayout), Valid: true}
+	}
+	_, err = db.Exec(`UPDATE "Note" SET "dueDate" = $1 WHERE id = $2`, value, noteID)
+	return err
+}
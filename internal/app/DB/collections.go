@@ -0,0 +1,434 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// collectionRoleSQL computes the user in $1's role on the databases aliased c: their
+// creator and workspace owners and admins own them, members edit them
+const collectionRoleSQL = `
+        CASE
+            WHEN c."userId" = $1 OR wm.role IN ('owner', 'admin') THEN 'owner'
+            WHEN wm.role = 'member' THEN 'editor'
+            ELSE 'none'
+        END
+`
+
+// collectionAccessSQL joins what collectionRoleSQL needs
+const collectionAccessSQL = `
+        LEFT JOIN "WorkspaceMember" wm ON wm."workspaceId" = c."workspaceId" AND wm."userId" = $1
+`
+
+// requireCollectionRole fails with ErrForbidden unless the user has at least the given role on the database
+func requireCollectionRole(db *sql.DB, collectionID, userID int, min models.Role) (models.Role, error) {
+	var role string
+	query := `SELECT ` + collectionRoleSQL + ` FROM "Collection" c ` + collectionAccessSQL + ` WHERE c.id = $2`
+	err := db.QueryRow(query, userID, collectionID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return models.RoleNone, ErrForbidden
+	}
+	if err != nil {
+		return models.RoleNone, err
+	}
+	if models.ParseRole(role) < min {
+		return models.ParseRole(role), ErrForbidden
+	}
+	return models.ParseRole(role), nil
+}
+
+// FetchCollections lists the databases of a workspace (0 for personal ones) the user has access to
+func FetchCollections(userID, workspaceID int) ([]models.Collection, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+        SELECT id, name, role FROM (
+            SELECT c.id, c.name, ` + collectionRoleSQL + ` AS role
+            FROM "Collection" c
+            ` + collectionAccessSQL + `
+            WHERE COALESCE(c."workspaceId", 0) = $2
+        ) collections
+        WHERE role <> 'none'
+        ORDER BY name;
+    `
+	rows, err := db.Query(query, userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []models.Collection
+	for rows.Next() {
+		c := models.Collection{WorkspaceID: workspaceID}
+		var role string
+		if err := rows.Scan(&c.ID, &c.Name, &role); err != nil {
+			return nil, err
+		}
+		c.Role = models.ParseRole(role)
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// CreateCollection creates an empty database, in a workspace unless workspaceID is 0.
+// Workspace guests may not create databases.
+func CreateCollection(name string, userID, workspaceID int) (models.Collection, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return models.Collection{}, err
+	}
+	defer db.Close()
+
+	var workspace sql.NullInt64
+	if workspaceID != 0 {
+		role, err := workspaceRole(db, workspaceID, userID)
+		if err != nil {
+			return models.Collection{}, err
+		}
+		if role == "" || role == models.WorkspaceGuest {
+			return models.Collection{}, ErrForbidden
+		}
+		workspace = sql.NullInt64{Int64: int64(workspaceID), Valid: true}
+	}
+
+	c := models.Collection{Name: name, WorkspaceID: workspaceID, Role: models.RoleOwner}
+	query := `INSERT INTO "Collection" (name, "userId", "workspaceId") VALUES ($1, $2, $3) RETURNING id`
+	err = db.QueryRow(query, name, userID, workspace).Scan(&c.ID)
+	return c, err
+}
+
+// FetchCollection loads a database along with its properties
+func FetchCollection(id, userID int) (models.Collection, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return models.Collection{}, err
+	}
+	defer db.Close()
+
+	role, err := requireCollectionRole(db, id, userID, models.RoleViewer)
+	if err != nil {
+		return models.Collection{}, err
+	}
+
+	c := models.Collection{ID: id, Role: role}
+	err = db.QueryRow(`SELECT name, COALESCE("workspaceId", 0) FROM "Collection" WHERE id = $1`, id).Scan(&c.Name, &c.WorkspaceID)
+	if err != nil {
+		return models.Collection{}, err
+	}
+
+	query := `
+        SELECT id, name, type, options, COALESCE("relationId", 0)
+        FROM "CollectionProperty" WHERE "collectionId" = $1
+        ORDER BY position, id;
+    `
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p models.Property
+		if err := rows.Scan(&p.ID, &p.Name, &p.Type, pq.Array(&p.Options), &p.RelationID); err != nil {
+			return models.Collection{}, err
+		}
+		c.Properties = append(c.Properties, p)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Collection{}, err
+	}
+
+	// Relations show the titles of the pages they point at
+	for index, p := range c.Properties {
+		if p.Type == models.PropertyRelation && p.RelationID != 0 {
+			if c.Properties[index].Pages, err = collectionPages(db, p.RelationID, userID); err != nil {
+				return models.Collection{}, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// collectionPages returns the titles of the pages of a database the user can see, by note ID
+func collectionPages(db *sql.DB, collectionID, userID int) (map[int]string, error) {
+	query := `
+        SELECT n.id, n.title FROM "Note" n
+        ` + noteAccessSQL + `
+        WHERE n."collectionId" = $2 AND ` + noteRoleSQL + ` <> 'none';
+    `
+	rows, err := db.Query(query, userID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := map[int]string{}
+	for rows.Next() {
+		var id int
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			return nil, err
+		}
+		if err := decrypt(db, at("Note", id), field{"title", &title}); err != nil {
+			return nil, err
+		}
+		pages[id] = title
+	}
+	return pages, rows.Err()
+}
+
+// AddProperty adds a column to a database; editors may change its layout
+func AddProperty(collectionID, userID int, p models.Property) (models.Property, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return p, err
+	}
+	defer db.Close()
+
+	if _, err := requireCollectionRole(db, collectionID, userID, models.RoleEditor); err != nil {
+		return p, err
+	}
+	var relation sql.NullInt64
+	if p.Type == models.PropertyRelation {
+		if _, err := requireCollectionRole(db, p.RelationID, userID, models.RoleViewer); err != nil {
+			return p, err
+		}
+		relation = sql.NullInt64{Int64: int64(p.RelationID), Valid: true}
+	}
+	if p.Options == nil {
+		p.Options = []string{}
+	}
+
+	query := `
+        INSERT INTO "CollectionProperty" ("collectionId", name, type, options, "relationId", position)
+        SELECT $1, $2, $3, $4, $5, COALESCE(MAX(position), 0) + 1 FROM "CollectionProperty" WHERE "collectionId" = $1
+        RETURNING id;
+    `
+	err = db.QueryRow(query, collectionID, p.Name, p.Type, pq.Array(p.Options), relation).Scan(&p.ID)
+	return p, err
+}
+
+// CollectionRows fetches the pages of a database the user can see, oldest first, with their values
+func CollectionRows(collectionID, userID int) ([]models.Row, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err := requireCollectionRole(db, collectionID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT id, version, title, description, content, "private", "userId", role, "workspaceId" FROM (
+            SELECT n.id, n.version, n.title, n.description, n.content, n."private", n."userId",
+                ` + noteRoleSQL + ` AS role, COALESCE(n."workspaceId", 0) AS "workspaceId"
+            FROM "Note" n
+            ` + noteAccessSQL + `
+            WHERE n."collectionId" = $2
+        ) pages
+        WHERE role <> 'none'
+        ORDER BY id;
+    `
+	rows, err := db.Query(query, userID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pages []models.Row
+	index := map[int]int{}
+	for rows.Next() {
+		row := models.Row{Values: map[int]string{}}
+		var role string
+		if err := rows.Scan(&row.Note.ID, &row.Note.Version, &row.Note.ItemTitle, &row.Note.Desc, &row.Note.Content, &row.Note.Private, &row.Note.AuthorID,
+			&role, &row.Note.WorkspaceID); err != nil {
+			return nil, err
+		}
+		if err := decryptItem(db, &row.Note); err != nil {
+			return nil, err
+		}
+		row.Note.Role = models.ParseRole(role)
+		index[row.Note.ID] = len(pages)
+		pages = append(pages, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	values, err := db.Query(`
+        SELECT v."noteId", v."propertyId", v.value
+        FROM "PropertyValue" v JOIN "Note" n ON n.id = v."noteId"
+        WHERE n."collectionId" = $1;
+    `, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer values.Close()
+	for values.Next() {
+		var noteID, propertyID int
+		var value string
+		if err := values.Scan(&noteID, &propertyID, &value); err != nil {
+			return nil, err
+		}
+		if err := decrypt(db, at("PropertyValue", noteID, propertyID), field{"value", &value}); err != nil {
+			return nil, err
+		}
+		if i, ok := index[noteID]; ok {
+			pages[i].Values[propertyID] = value
+		}
+	}
+	return pages, values.Err()
+}
+
+// AddRow creates an empty page in a database
+func AddRow(collectionID, userID int, title string) (models.Row, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return models.Row{}, err
+	}
+	defer db.Close()
+
+	if _, err := requireCollectionRole(db, collectionID, userID, models.RoleEditor); err != nil {
+		return models.Row{}, err
+	}
+
+	var workspaceID int
+	if err := db.QueryRow(`SELECT COALESCE("workspaceId", 0) FROM "Collection" WHERE id = $1`, collectionID).Scan(&workspaceID); err != nil {
+		return models.Row{}, err
+	}
+	s, err := newSealer(db, userID, workspaceID)
+	if err != nil {
+		return models.Row{}, err
+	}
+	id, err := nextID(db, "Note")
+	if err != nil {
+		return models.Row{}, err
+	}
+	sealed, err := s.seal(at("Note", id), "title", title)
+	if err != nil {
+		return models.Row{}, err
+	}
+
+	row := models.Row{Note: models.ListItemViewModel{ItemTitle: title, Role: models.RoleOwner, AuthorID: userID, WorkspaceID: workspaceID}, Values: map[int]string{}}
+	query := `
+        INSERT INTO "Note" (id, title, description, content, "userId", "workspaceId", "collectionId")
+        SELECT $1, $2, '', '', $3, "workspaceId", id FROM "Collection" WHERE id = $4
+        RETURNING id, version;
+    `
+	err = db.QueryRow(query, id, sealed, userID, collectionID).Scan(&row.Note.ID, &row.Note.Version)
+	return row, err
+}
+
+// SetPropertyValue validates and stores a page's value for a property, returning it the way it
+// was stored. Person values are emails of registered users, relation values are comma separated
+// page titles of the related database. An empty value clears the cell.
+func SetPropertyValue(noteID, propertyID, userID int, raw string) (string, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleEditor); err != nil {
+		return "", err
+	}
+
+	var p models.Property
+	query := `
+        SELECT p.id, p.name, p.type, p.options, COALESCE(p."relationId", 0)
+        FROM "CollectionProperty" p JOIN "Note" n ON n."collectionId" = p."collectionId"
+        WHERE p.id = $1 AND n.id = $2;
+    `
+	err = db.QueryRow(query, propertyID, noteID).Scan(&p.ID, &p.Name, &p.Type, pq.Array(&p.Options), &p.RelationID)
+	if err == sql.ErrNoRows {
+		return "", ErrForbidden
+	}
+	if err != nil {
+		return "", err
+	}
+
+	value, err := p.Normalize(raw)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case value == "":
+	case p.Type == models.PropertyPerson:
+		if err := db.QueryRow(`SELECT email FROM "User" WHERE lower(email) = lower($1)`, value).Scan(&value); err == sql.ErrNoRows {
+			return "", ErrUnknownUser
+		} else if err != nil {
+			return "", err
+		}
+	case p.Type == models.PropertyRelation:
+		if value, err = relationIDs(db, p, userID, value); err != nil {
+			return "", err
+		}
+	}
+
+	if value == "" {
+		_, err = db.Exec(`DELETE FROM "PropertyValue" WHERE "noteId" = $1 AND "propertyId" = $2`, noteID, propertyID)
+		return "", err
+	}
+	stored, err := sealPropertyValue(db, p, noteID, value)
+	if err != nil {
+		return "", err
+	}
+	query = `
+        INSERT INTO "PropertyValue" ("noteId", "propertyId", value) VALUES ($1, $2, $3)
+        ON CONFLICT ("noteId", "propertyId") DO UPDATE SET value = EXCLUDED.value;
+    `
+	_, err = db.Exec(query, noteID, propertyID, stored)
+	return value, err
+}
+
+// sealPropertyValue seals a page's value like the page itself. Relation values stay in
+// plaintext, they only hold note IDs which queries join on.
+func sealPropertyValue(db queryer, p models.Property, noteID int, value string) (string, error) {
+	if p.Type == models.PropertyRelation {
+		return value, nil
+	}
+	s, err := noteSealer(db, noteID)
+	if err != nil {
+		return "", err
+	}
+	return s.seal(at("PropertyValue", noteID, p.ID), "value", value)
+}
+
+// relationIDs resolves comma separated page titles of the related database to their note IDs
+func relationIDs(db *sql.DB, p models.Property, userID int, titles string) (string, error) {
+	if p.RelationID == 0 {
+		return "", errors.New("the related database was deleted")
+	}
+	pages, err := collectionPages(db, p.RelationID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	var ids []string
+	for _, title := range models.SplitList(titles) {
+		found := false
+		for id, pageTitle := range pages {
+			if strings.EqualFold(pageTitle, title) {
+				ids = append(ids, strconv.Itoa(id))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("no page named %q in the related database", title)
+		}
+	}
+	return strings.Join(ids, ","), nil
+}
@@ -0,0 +1,223 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// ErrNoSuchComment is returned when replying to or resolving a comment that is not on the note
+var ErrNoSuchComment = errors.New("no such comment on this note")
+
+// Comment is a remark on a range of lines of a note, or a reply to one
+type Comment struct {
+	ID        int
+	ParentID  int // 0 for the first comment of a thread
+	Author    string
+	LineStart int // 1-based, inclusive
+	LineEnd   int
+	Body      string
+	Resolved  bool
+	CreatedAt time.Time
+	Mentions  []int // users mentioned in Body, filled in by AddComment
+}
+
+// mentionPattern matches @handles, either a full email or the part before the @
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9._%+-]+(?:@[A-Za-z0-9.-]+\.[A-Za-z]+)?)`)
+
+// FetchComments lists the note's comments, each thread starting with its first comment
+// followed by its replies. Anyone who can read the note can read its comments.
+func FetchComments(noteID, userID int) ([]Comment, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT c.id, COALESCE(c."parentId", 0), u.email, c."lineStart", c."lineEnd", c.body, c.resolved, c."createdAt"
+        FROM "Comment" c
+        JOIN "User" u ON u.id = c."authorId"
+        LEFT JOIN "Comment" root ON root.id = c."parentId"
+        WHERE c."noteId" = $1
+        ORDER BY COALESCE(root."lineStart", c."lineStart"), COALESCE(c."parentId", c.id), c."parentId" IS NOT NULL, c."createdAt";
+    `
+	rows, err := db.Query(query, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.ParentID, &c.Author, &c.LineStart, &c.LineEnd, &c.Body, &c.Resolved, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := decrypt(db, at("Comment", c.ID), field{"body", &c.Body}); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// AddComment starts a thread on c's lines, or replies to c.ParentID, and records who
+// it mentions. Commenters, editors and owners may comment.
+func AddComment(noteID, userID int, c Comment) (Comment, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return c, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleCommenter); err != nil {
+		return c, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c, err
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	if c.ParentID != 0 {
+		// Replies live on their thread's lines and reopen it
+		query := `SELECT "lineStart", "lineEnd" FROM "Comment" WHERE id = $1 AND "noteId" = $2 AND "parentId" IS NULL`
+		if err := tx.QueryRow(query, c.ParentID, noteID).Scan(&c.LineStart, &c.LineEnd); err != nil {
+			if err == sql.ErrNoRows {
+				err = ErrNoSuchComment
+			}
+			return c, err
+		}
+		if _, err := tx.Exec(`UPDATE "Comment" SET resolved = false, "updatedAt" = now() WHERE id = $1`, c.ParentID); err != nil {
+			return c, err
+		}
+		parentID = sql.NullInt64{Int64: int64(c.ParentID), Valid: true}
+	}
+
+	// Comments quote the note, so they are sealed like it
+	s, err := noteSealer(tx, noteID)
+	if err != nil {
+		return c, err
+	}
+	if c.ID, err = nextID(tx, "Comment"); err != nil {
+		return c, err
+	}
+	body, err := s.seal(at("Comment", c.ID), "body", c.Body)
+	if err != nil {
+		return c, err
+	}
+	query := `
+        INSERT INTO "Comment" (id, "noteId", "authorId", "parentId", "lineStart", "lineEnd", body)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING "createdAt";
+    `
+	if err := tx.QueryRow(query, c.ID, noteID, userID, parentID, c.LineStart, c.LineEnd, body).Scan(&c.CreatedAt); err != nil {
+		return c, err
+	}
+
+	handles, err := mentionableUsers(tx, noteID)
+	if err != nil {
+		return c, err
+	}
+	seen := map[int]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(c.Body, -1) {
+		mentioned, ok := handles[strings.ToLower(match[1])]
+		if !ok || mentioned == userID || seen[mentioned] {
+			continue
+		}
+		seen[mentioned] = true
+		if _, err := tx.Exec(`INSERT INTO "CommentMention" ("commentId", "userId") VALUES ($1, $2)`, c.ID, mentioned); err != nil {
+			return c, err
+		}
+		c.Mentions = append(c.Mentions, mentioned)
+	}
+	return c, tx.Commit()
+}
+
+// SetCommentResolved resolves or reopens a thread. Commenters, editors and owners may do so.
+func SetCommentResolved(noteID, commentID, userID int, resolved bool) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleCommenter); err != nil {
+		return err
+	}
+	query := `UPDATE "Comment" SET resolved = $1, "updatedAt" = now() WHERE id = $2 AND "noteId" = $3 AND "parentId" IS NULL`
+	res, err := db.Exec(query, resolved, commentID, noteID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNoSuchComment
+	}
+	return nil
+}
+
+// mentionableUsers maps handles to the users who can be mentioned on a note: the members
+// of its workspace, or for personal notes the owner and the users it is shared with, as
+// long as they can read the note. Both the full email and the part before the @ work as handles.
+func mentionableUsers(tx *sql.Tx, noteID int) (map[string]int, error) {
+	query := `
+        SELECT u.id, u.email FROM "Note" n
+        JOIN "WorkspaceMember" m ON m."workspaceId" = n."workspaceId"
+        JOIN "User" u ON u.id = m."userId"
+        WHERE n.id = $1
+        UNION
+        SELECT u.id, u.email FROM "Note" n JOIN "User" u ON u.id = n."userId"
+        WHERE n.id = $1 AND n."workspaceId" IS NULL
+        UNION
+        SELECT u.id, u.email FROM "Note" n
+        JOIN "NoteShare" s ON s."noteId" = n.id
+        JOIN "User" u ON u.id = s."userId"
+        WHERE n.id = $1 AND n."workspaceId" IS NULL;
+    `
+	rows, err := tx.Query(query, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := map[int]string{}
+	for rows.Next() {
+		var id int
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			return nil, err
+		}
+		emails[id] = email
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Guests of a workspace only see the notes shared with them
+	handles := map[string]int{}
+	for id, email := range emails {
+		if role, err := noteRole(tx, noteID, id); err != nil {
+			return nil, err
+		} else if role < models.RoleViewer {
+			continue
+		}
+		email = strings.ToLower(email)
+		handles[email] = id
+		if local, _, ok := strings.Cut(email, "@"); ok {
+			handles[local] = id
+		}
+	}
+	return handles, nil
+}
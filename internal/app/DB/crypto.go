@@ -0,0 +1,626 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// Note titles, descriptions and contents, and the text copied out of them into tasks, comments,
+// notifications, templates and database values, are sealed with AES-GCM under a data key of
+// the note's workspace, or of its owner for personal notes. Data keys are stored wrapped by a
+// master key from the server's configuration, so rotating the master key rewraps the data keys
+// and leaves the notes alone. Encryption is off until a master key is configured, and the web
+// client cannot read sealed notes. Git storage is off while it is on.
+
+// encryptedPrefix starts every sealed value, followed by the data key ID and the base64
+// nonce and ciphertext. The ciphertext is bound to the table, column and row the value is
+// stored in, so a value copied elsewhere does not open. Values without it are plaintext
+// written before encryption was on.
+const encryptedPrefix = "enc:v2:"
+
+// unboundPrefix starts values sealed before they were bound to where they are stored. They
+// still open, until EncryptNotes and EncryptCopies seal them again.
+const unboundPrefix = "enc:v1:"
+
+// row is where sealed values are stored, a row of a table named by its key, which has
+// several IDs in tables with composite keys
+type row struct {
+	table string
+	key   []int
+}
+
+// at returns the row of table with that key
+func at(table string, key ...int) row {
+	return row{table: table, key: key}
+}
+
+// aad is the associated data binding a value to a column of the row
+func (r row) aad(column string) []byte {
+	ids := make([]string, len(r.key))
+	for index, id := range r.key {
+		ids[index] = strconv.Itoa(id)
+	}
+	return []byte(r.table + "." + column + ":" + strings.Join(ids, ","))
+}
+
+// field is a value stored in a column
+type field struct {
+	column string
+	value  *string
+}
+
+// nextID reserves the ID of a row about to be inserted into table, so that values sealed
+// before the insert can be bound to it
+func nextID(db queryer, table string) (int, error) {
+	var id int
+	err := db.QueryRow(`SELECT nextval(pg_get_serial_sequence($1, 'id'))`, `"`+table+`"`).Scan(&id)
+	return id, err
+}
+
+// masterKey unwraps data keys, identified by a hash so the key itself is never stored
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+var (
+	masterOnce sync.Once
+	masterKeys []masterKey // the first wraps new data keys
+	masterErr  error
+
+	// dataKeys caches unwrapped data keys by ID; a data key never changes, only its wrapping
+	dataKeys sync.Map
+)
+
+// loadMasterKeys reads MASTER_KEY, or the file MASTER_KEY_FILE names, once: base64 encoded
+// 32 byte keys separated by commas or whitespace. New data keys are wrapped by the first, the
+// others only unwrap the data keys RotateKeys has not rewrapped yet.
+func loadMasterKeys() ([]masterKey, error) {
+	masterOnce.Do(func() {
+		value := os.Getenv("MASTER_KEY")
+		if path := os.Getenv("MASTER_KEY_FILE"); value == "" && path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				masterErr = err
+				return
+			}
+			value = string(data)
+		}
+		fields := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+		for _, field := range fields {
+			raw, err := base64.StdEncoding.DecodeString(field)
+			if err != nil || len(raw) != 32 {
+				masterErr = errors.New("master keys must be base64 encoded 32 byte keys")
+				return
+			}
+			aead, err := newAEAD(raw)
+			if err != nil {
+				masterErr = err
+				return
+			}
+			sum := sha256.Sum256(raw)
+			masterKeys = append(masterKeys, masterKey{id: hex.EncodeToString(sum[:8]), aead: aead})
+		}
+	})
+	return masterKeys, masterErr
+}
+
+// EncryptionEnabled reports whether notes are encrypted at rest, failing on a malformed master key
+func EncryptionEnabled() (bool, error) {
+	keys, err := loadMasterKeys()
+	return len(keys) > 0, err
+}
+
+// newAEAD returns AES-256-GCM with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext under a random nonce, which it prepends, authenticating aad along
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// unseal reverses seal
+func unseal(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
+
+// unwrapKey decrypts a stored data key with the master key that wrapped it
+func unwrapKey(wrapped, masterKeyID string) ([]byte, error) {
+	keys, err := loadMasterKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if k.id != masterKeyID {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(wrapped)
+		if err != nil {
+			return nil, err
+		}
+		return unseal(k.aead, sealed, nil)
+	}
+	return nil, fmt.Errorf("no configured master key has ID %s", masterKeyID)
+}
+
+// queryer is what data keys are read and created with, satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// sealer encrypts values with the data key of one workspace or user; a nil sealer, used
+// when no master key is configured, leaves them in plaintext
+type sealer struct {
+	keyID int
+	aead  cipher.AEAD
+}
+
+// seal encrypts a value stored in a column of r; empty values stay empty
+func (s *sealer) seal(r row, column, value string) (string, error) {
+	if s == nil || value == "" {
+		return value, nil
+	}
+	sealed, err := seal(s.aead, []byte(value), r.aad(column))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + strconv.Itoa(s.keyID) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// sealAll encrypts the fields of r in place
+func (s *sealer) sealAll(r row, fields ...field) error {
+	for _, f := range fields {
+		sealed, err := s.seal(r, f.column, *f.value)
+		if err != nil {
+			return err
+		}
+		*f.value = sealed
+	}
+	return nil
+}
+
+// newSealer returns the sealer for the notes of a workspace, or of the user's personal notes
+// when workspaceID is 0, creating its data key on first use. A workspace created in a
+// transaction needs its data key created in that transaction.
+func newSealer(db queryer, userID, workspaceID int) (*sealer, error) {
+	keys, err := loadMasterKeys()
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+
+	column, owner := `"userId"`, userID
+	if workspaceID != 0 {
+		column, owner = `"workspaceId"`, workspaceID
+	}
+	var id int
+	var wrapped, masterKeyID string
+	query := `SELECT id, "wrappedKey", "masterKeyId" FROM "DataKey" WHERE ` + column + ` = $1`
+	err = db.QueryRow(query, owner).Scan(&id, &wrapped, &masterKeyID)
+	if err == sql.ErrNoRows {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		sealed, err := seal(keys[0].aead, raw, nil)
+		if err != nil {
+			return nil, err
+		}
+		wrapped, masterKeyID = base64.StdEncoding.EncodeToString(sealed), keys[0].id
+		// A concurrent first save may have created the key meanwhile, then that one is used
+		insert := `INSERT INTO "DataKey" (` + column + `, "wrappedKey", "masterKeyId") VALUES ($1, $2, $3) ON CONFLICT DO NOTHING RETURNING id`
+		err = db.QueryRow(insert, owner, wrapped, masterKeyID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return newSealer(db, userID, workspaceID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := dataKey(db, id, wrapped, masterKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{keyID: id, aead: aead}, nil
+}
+
+// noteSealer returns the sealer for an existing note
+func noteSealer(db queryer, noteID int) (*sealer, error) {
+	if keys, err := loadMasterKeys(); err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	var userID, workspaceID int
+	query := `SELECT "userId", COALESCE("workspaceId", 0) FROM "Note" WHERE id = $1`
+	if err := db.QueryRow(query, noteID).Scan(&userID, &workspaceID); err != nil {
+		return nil, err
+	}
+	return newSealer(db, userID, workspaceID)
+}
+
+// dataKey returns the cipher of a data key, unwrapping it on first use. wrapped is read from
+// the database when empty.
+func dataKey(db queryer, id int, wrapped, masterKeyID string) (cipher.AEAD, error) {
+	if aead, ok := dataKeys.Load(id); ok {
+		return aead.(cipher.AEAD), nil
+	}
+	if wrapped == "" {
+		query := `SELECT "wrappedKey", "masterKeyId" FROM "DataKey" WHERE id = $1`
+		if err := db.QueryRow(query, id).Scan(&wrapped, &masterKeyID); err != nil {
+			return nil, err
+		}
+	}
+	raw, err := unwrapKey(wrapped, masterKeyID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	dataKeys.Store(id, aead)
+	return aead, nil
+}
+
+// decrypt replaces the sealed fields of r with their plaintext, leaving plaintext as it is
+func decrypt(db queryer, r row, fields ...field) error {
+	for _, f := range fields {
+		rest, bound := strings.CutPrefix(*f.value, encryptedPrefix)
+		if !bound {
+			var ok bool
+			if rest, ok = strings.CutPrefix(*f.value, unboundPrefix); !ok {
+				continue
+			}
+		}
+		id, payload, ok := strings.Cut(rest, ":")
+		keyID, err := strconv.Atoi(id)
+		if !ok || err != nil {
+			return errors.New("malformed encrypted value")
+		}
+		sealed, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return err
+		}
+		aead, err := dataKey(db, keyID, "", "")
+		if err != nil {
+			return err
+		}
+		var aad []byte
+		if bound {
+			aad = r.aad(f.column)
+		}
+		plaintext, err := unseal(aead, sealed, aad)
+		if err != nil {
+			return err
+		}
+		*f.value = string(plaintext)
+	}
+	return nil
+}
+
+// noteFields are the sealed columns of a note
+func noteFields(title, description, content *string) []field {
+	return []field{{"title", title}, {"description", description}, {"content", content}}
+}
+
+// decryptItem decrypts the title, description and content of a note
+func decryptItem(db queryer, item *models.ListItemViewModel) error {
+	return decrypt(db, at("Note", item.ID), noteFields(&item.ItemTitle, &item.Desc, &item.Content)...)
+}
+
+// RotateKeys rewraps the data keys still wrapped by an older master key with the current one
+// and returns how many it rewrapped. Notes stay readable throughout because every configured
+// master key unwraps, and once this returns the older keys can be dropped from the config.
+func RotateKeys() (int, error) {
+	keys, err := loadMasterKeys()
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	type stored struct {
+		id                   int
+		wrapped, masterKeyID string
+	}
+	rows, err := db.Query(`SELECT id, "wrappedKey", "masterKeyId" FROM "DataKey" WHERE "masterKeyId" <> $1`, keys[0].id)
+	if err != nil {
+		return 0, err
+	}
+	var stale []stored
+	for rows.Next() {
+		var k stored
+		if err := rows.Scan(&k.id, &k.wrapped, &k.masterKeyID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		stale = append(stale, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, k := range stale {
+		raw, err := unwrapKey(k.wrapped, k.masterKeyID)
+		if err != nil {
+			return rotated, fmt.Errorf("data key %d: %w", k.id, err)
+		}
+		sealed, err := seal(keys[0].aead, raw, nil)
+		if err != nil {
+			return rotated, err
+		}
+		// Another server process may have rewrapped it meanwhile, which is just as good
+		query := `UPDATE "DataKey" SET "wrappedKey" = $1, "masterKeyId" = $2 WHERE id = $3 AND "masterKeyId" = $4`
+		result, err := db.Exec(query, base64.StdEncoding.EncodeToString(sealed), keys[0].id, k.id, k.masterKeyID)
+		if err != nil {
+			return rotated, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			rotated++
+		}
+	}
+	return rotated, nil
+}
+
+// EncryptNotes seals the notes still stored in plaintext, saved before encryption was turned on
+// or by the web client, or sealed before values were bound to where they are stored, and
+// returns how many it sealed. Their version is left alone since their content did not change;
+// a note saved meanwhile is skipped, its save sealed it.
+func EncryptNotes() (int, error) {
+	if keys, err := loadMasterKeys(); err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	query := `
+        SELECT id, "userId", COALESCE("workspaceId", 0), version, title, description, content FROM "Note"
+        WHERE (title <> '' AND title NOT LIKE 'enc:v2:%')
+            OR (description <> '' AND description NOT LIKE 'enc:v2:%')
+            OR (content <> '' AND content NOT LIKE 'enc:v2:%');
+    `
+	rows, err := db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	type plain struct {
+		item                models.ListItemViewModel
+		userID, workspaceID int
+	}
+	var notes []plain
+	for rows.Next() {
+		var n plain
+		if err := rows.Scan(&n.item.ID, &n.userID, &n.workspaceID, &n.item.Version, &n.item.ItemTitle, &n.item.Desc, &n.item.Content); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		notes = append(notes, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sealed := 0
+	for _, n := range notes {
+		s, err := newSealer(db, n.userID, n.workspaceID)
+		if err != nil {
+			return sealed, err
+		}
+		// Fields may be half sealed when the web client rewrote only some of them
+		if err := decryptItem(db, &n.item); err != nil {
+			return sealed, fmt.Errorf("note %d: %w", n.item.ID, err)
+		}
+		content := n.item.Content
+		if err := s.sealAll(at("Note", n.item.ID), noteFields(&n.item.ItemTitle, &n.item.Desc, &n.item.Content)...); err != nil {
+			return sealed, err
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return sealed, err
+		}
+		update := `UPDATE "Note" SET title = $1, description = $2, content = $3 WHERE id = $4 AND version = $5`
+		result, err := tx.Exec(update, n.item.ItemTitle, n.item.Desc, n.item.Content, n.item.ID, n.item.Version)
+		if err != nil {
+			tx.Rollback()
+			return sealed, err
+		}
+		if changed, _ := result.RowsAffected(); changed == 0 {
+			tx.Rollback()
+			continue
+		}
+		// The indexed task text is sealed along with the note
+		if err := indexTasks(tx, s, n.item.ID, content); err != nil {
+			tx.Rollback()
+			return sealed, err
+		}
+		if err := tx.Commit(); err != nil {
+			return sealed, err
+		}
+		sealed++
+	}
+	return sealed, nil
+}
+
+// plaintextCopies select the copies of note text not sealed where they are stored, with the
+// owner and workspace whose key seals them, their values and the key of their row, and
+// update them unless they were sealed meanwhile
+var plaintextCopies = []struct {
+	name, table, query, update string
+	columns                    []string // of the values, which the key of the row follows
+}{
+	{
+		name:  "comments",
+		table: "Comment",
+		query: `
+            SELECT n."userId", COALESCE(n."workspaceId", 0), c.body, c.id::text
+            FROM "Comment" c JOIN "Note" n ON n.id = c."noteId"
+            WHERE c.body <> '' AND c.body NOT LIKE 'enc:v2:%';
+        `,
+		update:  `UPDATE "Comment" SET body = $1 WHERE id = $2::int AND body NOT LIKE 'enc:v2:%'`,
+		columns: []string{"body"},
+	},
+	{
+		name:  "notifications",
+		table: "Notification",
+		query: `
+            SELECT COALESCE(n."userId", x."userId"), COALESCE(n."workspaceId", 0), x.body, x.id::text
+            FROM "Notification" x LEFT JOIN "Note" n ON n.id = x."noteId"
+            WHERE x.body <> '' AND x.body NOT LIKE 'enc:v2:%';
+        `,
+		update:  `UPDATE "Notification" SET body = $1 WHERE id = $2::int AND body NOT LIKE 'enc:v2:%'`,
+		columns: []string{"body"},
+	},
+	{
+		name:  "database values",
+		table: "PropertyValue",
+		query: `
+            SELECT n."userId", COALESCE(n."workspaceId", 0), v.value, v."noteId"::text, v."propertyId"::text
+            FROM "PropertyValue" v JOIN "Note" n ON n.id = v."noteId"
+            JOIN "CollectionProperty" p ON p.id = v."propertyId"
+            WHERE p.type <> 'relation' AND v.value <> '' AND v.value NOT LIKE 'enc:v2:%';
+        `,
+		update:  `UPDATE "PropertyValue" SET value = $1 WHERE "noteId" = $2::int AND "propertyId" = $3::int AND value NOT LIKE 'enc:v2:%'`,
+		columns: []string{"value"},
+	},
+	{
+		name:  "reminders",
+		table: "Reminder",
+		query: `
+            SELECT n."userId", COALESCE(n."workspaceId", 0), r."taskText", r.id::text
+            FROM "Reminder" r JOIN "Note" n ON n.id = r."noteId"
+            WHERE r."taskText" <> '' AND r."taskText" NOT LIKE 'enc:v2:%';
+        `,
+		update:  `UPDATE "Reminder" SET "taskText" = $1 WHERE id = $2::int AND "taskText" NOT LIKE 'enc:v2:%'`,
+		columns: []string{"taskText"},
+	},
+	{
+		name:  "templates",
+		table: "NoteTemplate",
+		query: `
+            SELECT "userId", COALESCE("workspaceId", 0), name, title, description, content, id::text FROM "NoteTemplate"
+            WHERE ` + plaintextTemplateSQL + `;
+        `,
+		update:  `UPDATE "NoteTemplate" SET name = $1, title = $2, description = $3, content = $4 WHERE id = $5::int AND (` + plaintextTemplateSQL + `)`,
+		columns: []string{"name", "title", "description", "content"},
+	},
+}
+
+// plaintextTemplateSQL matches templates with a value not sealed where it is stored; saving a
+// template seals all of them
+const plaintextTemplateSQL = `(name <> '' AND name NOT LIKE 'enc:v2:%') OR (title <> '' AND title NOT LIKE 'enc:v2:%')
+                OR (description <> '' AND description NOT LIKE 'enc:v2:%') OR (content <> '' AND content NOT LIKE 'enc:v2:%')`
+
+// EncryptCopies seals the comments, notifications, reminders, templates and database values
+// still stored in plaintext or sealed unbound, like EncryptNotes does for the notes they quote,
+// and returns how many it sealed
+func EncryptCopies() (int, error) {
+	if keys, err := loadMasterKeys(); err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	sealed := 0
+	for _, copies := range plaintextCopies {
+		rows, err := db.Query(copies.query)
+		if err != nil {
+			return sealed, err
+		}
+		type plain struct {
+			userID, workspaceID int
+			fields              []string
+		}
+		var found []plain
+		for rows.Next() {
+			columns, _ := rows.Columns()
+			p := plain{fields: make([]string, len(columns)-2)}
+			dest := []any{&p.userID, &p.workspaceID}
+			for index := range p.fields {
+				dest = append(dest, &p.fields[index])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return sealed, err
+			}
+			found = append(found, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return sealed, err
+		}
+
+		for _, p := range found {
+			s, err := newSealer(db, p.userID, p.workspaceID)
+			if err != nil {
+				return sealed, err
+			}
+			r := at(copies.table)
+			for _, key := range p.fields[len(copies.columns):] {
+				id, err := strconv.Atoi(key)
+				if err != nil {
+					return sealed, err
+				}
+				r.key = append(r.key, id)
+			}
+			fields := make([]field, len(copies.columns))
+			for index, column := range copies.columns {
+				fields[index] = field{column, &p.fields[index]}
+			}
+			// Values may be half sealed, like notes the web client rewrote
+			if err := decrypt(db, r, fields...); err != nil {
+				return sealed, fmt.Errorf("%s: %w", copies.name, err)
+			}
+			if err := s.sealAll(r, fields...); err != nil {
+				return sealed, err
+			}
+			args := make([]any, len(p.fields))
+			for index := range p.fields {
+				args[index] = p.fields[index]
+			}
+			if _, err := db.Exec(copies.update, args...); err != nil {
+				return sealed, err
+			}
+			sealed++
+		}
+	}
+	return sealed, nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// testSealer returns a sealer whose data key is cached under keyID, so decrypt needs no database
+func testSealer(t *testing.T, keyID int) *sealer {
+	t.Helper()
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKeys.Store(keyID, aead)
+	t.Cleanup(func() { dataKeys.Delete(keyID) })
+	return &sealer{keyID: keyID, aead: aead}
+}
+
+func TestSealDecrypt(t *testing.T) {
+	s := testSealer(t, 1001)
+	other := testSealer(t, 1002)
+	note := at("Note", 7)
+
+	sealed, err := s.seal(note, "content", "meeting notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, encryptedPrefix+"1001:") || strings.Contains(sealed, "meeting") {
+		t.Fatalf("seal() = %q, want a value sealed with key 1001", sealed)
+	}
+	forged, _ := other.seal(note, "content", "meeting notes")
+	forged = strings.Replace(forged, ":1002:", ":1001:", 1)
+
+	// Values sealed before they were bound to where they are stored
+	unbound, err := seal(s.aead, []byte("old sealed note"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := unboundPrefix + "1001:" + base64.StdEncoding.EncodeToString(unbound)
+
+	tests := []struct {
+		name    string
+		row     row
+		column  string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "sealed", row: note, column: "content", value: sealed, want: "meeting notes"},
+		{name: "plaintext from before encryption", row: note, column: "content", value: "old note", want: "old note"},
+		{name: "sealed before values were bound", row: note, column: "content", value: legacy, want: "old sealed note"},
+		{name: "empty", row: note, column: "content", value: "", want: ""},
+		{name: "moved to another row", row: at("Note", 8), column: "content", value: sealed, wantErr: true},
+		{name: "moved to another column", row: note, column: "title", value: sealed, wantErr: true},
+		{name: "moved to another table", row: at("Comment", 7), column: "content", value: sealed, wantErr: true},
+		{name: "sealed with another key than it names", row: note, column: "content", value: forged, wantErr: true},
+		{name: "missing key ID", row: note, column: "content", value: encryptedPrefix + "abc", wantErr: true},
+		{name: "not base64", row: note, column: "content", value: encryptedPrefix + "1001:!!!", wantErr: true},
+		{name: "truncated", row: note, column: "content", value: sealed[:len(encryptedPrefix)+8], wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.value
+			err := decrypt(nil, tt.row, field{tt.column, &got})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decrypt(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("decrypt(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowAAD(t *testing.T) {
+	tests := []struct {
+		row    row
+		column string
+		want   string
+	}{
+		{row: at("Note", 42), column: "title", want: "Note.title:42"},
+		{row: at("PropertyValue", 3, 14), column: "value", want: "PropertyValue.value:3,14"},
+		{row: at("Task", 3, 1), column: "text", want: "Task.text:3,1"},
+	}
+	for _, tt := range tests {
+		if got := string(tt.row.aad(tt.column)); got != tt.want {
+			t.Errorf("aad(%q) = %q, want %q", tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestSealerSealAll(t *testing.T) {
+	s := testSealer(t, 1003)
+	note := at("Note", 9)
+	title, desc, empty := "Title", "Description", ""
+	if err := s.sealAll(note, noteFields(&title, &desc, &empty)...); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(title, encryptedPrefix) || !strings.HasPrefix(desc, encryptedPrefix) || empty != "" {
+		t.Fatalf("sealAll() left %q, %q, %q", title, desc, empty)
+	}
+	if err := decrypt(nil, note, noteFields(&title, &desc, &empty)...); err != nil || title != "Title" || desc != "Description" {
+		t.Errorf("decrypt() = %q, %q, %v", title, desc, err)
+	}
+
+	// Without a master key the sealer is nil and values stay in plaintext
+	var off *sealer
+	value := "plain"
+	if err := off.sealAll(note, field{"content", &value}); err != nil || value != "plain" {
+		t.Errorf("nil sealer changed the value to %q, %v", value, err)
+	}
+}
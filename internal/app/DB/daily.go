@@ -0,0 +1,142 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// DailyTemplateTitle is the title of the personal note whose content prefills new daily notes
+const DailyTemplateTitle = "Daily template"
+
+// dailyNoteSQL selects the daily notes of the user in $1 in the shape scanDailyNote expects
+const dailyNoteSQL = `
+        SELECT id, version, title, description, content, "private", "userId", "dueDate", "dailyDate"
+        FROM "Note" WHERE "userId" = $1 AND "dailyDate" IS NOT NULL
+`
+
+// scanDailyNote reads and decrypts a row selected by dailyNoteSQL
+func scanDailyNote(db *sql.DB, row interface{ Scan(...any) error }) (models.ListItemViewModel, error) {
+	item := models.ListItemViewModel{Role: models.RoleOwner}
+	var due sql.NullTime
+	if err := row.Scan(&item.ID, &item.Version, &item.ItemTitle, &item.Desc, &item.Content, &item.Private, &item.AuthorID, &due, &item.Daily); err != nil {
+		return item, err
+	}
+	item.Due = due.Time
+	return item, decryptItem(db, &item)
+}
+
+// DailyNote returns the user's note for day, creating it with content on first use, which
+// created reports
+func DailyNote(userID int, day time.Time, content string) (item models.ListItemViewModel, created bool, err error) {
+	db, err := OpenDB()
+	if err != nil {
+		return item, false, err
+	}
+	defer db.Close()
+
+	date := day.Format(models.DateLayout)
+	s, err := newSealer(db, userID, 0)
+	if err != nil {
+		return item, false, err
+	}
+	id, err := nextID(db, "Note")
+	if err != nil {
+		return item, false, err
+	}
+	title, description, sealed := date, day.Format("Monday"), content
+	if err := s.sealAll(at("Note", id), noteFields(&title, &description, &sealed)...); err != nil {
+		return item, false, err
+	}
+	query := `
+        INSERT INTO "Note" (id, title, description, content, "userId", "dailyDate") VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT ("userId", "dailyDate") WHERE "dailyDate" IS NOT NULL DO NOTHING
+        RETURNING id;
+    `
+	switch err := db.QueryRow(query, id, title, description, sealed, userID, date).Scan(&id); {
+	case err == nil:
+		// Created just now, the template may hold tasks
+		created = true
+		if err := indexTasks(db, s, id, content); err != nil {
+			return item, false, err
+		}
+	case err != sql.ErrNoRows:
+		return item, false, err
+	}
+	item, err = scanDailyNote(db, db.QueryRow(dailyNoteSQL+` AND "dailyDate" = $2`, userID, date))
+	return item, created, err
+}
+
+// AdjacentDailyNote returns the user's closest daily note after day, or before it when
+// next is false. ok is false when there is none.
+func AdjacentDailyNote(userID int, day time.Time, next bool) (item models.ListItemViewModel, ok bool, err error) {
+	db, err := OpenDB()
+	if err != nil {
+		return item, false, err
+	}
+	defer db.Close()
+
+	query := dailyNoteSQL + ` AND "dailyDate" < $2 ORDER BY "dailyDate" DESC LIMIT 1`
+	if next {
+		query = dailyNoteSQL + ` AND "dailyDate" > $2 ORDER BY "dailyDate" LIMIT 1`
+	}
+	item, err = scanDailyNote(db, db.QueryRow(query, userID, day.Format(models.DateLayout)))
+	if err == sql.ErrNoRows {
+		return item, false, nil
+	}
+	return item, err == nil, err
+}
+
+// FetchDailyNotes lists the user's daily notes, newest first
+func FetchDailyNotes(userID int) ([]models.ListItemViewModel, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(dailyNoteSQL+` ORDER BY "dailyDate" DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.ListItemViewModel
+	for rows.Next() {
+		item, err := scanDailyNote(db, rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// DailyTemplate returns the content of the user's personal note titled DailyTemplateTitle,
+// empty when they have none
+func DailyTemplate(userID int) (string, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	query := `
+        SELECT id, title FROM "Note"
+        WHERE "userId" = $1 AND "workspaceId" IS NULL AND "dailyDate" IS NULL
+        ORDER BY id;
+    `
+	id, err := firstTitled(db, DailyTemplateTitle, query, userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var content string
+	if err := db.QueryRow(`SELECT content FROM "Note" WHERE id = $1`, id).Scan(&content); err != nil {
+		return "", err
+	}
+	return content, decrypt(db, at("Note", id), field{"content", &content})
+}
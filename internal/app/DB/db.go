@@ -2,7 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"log"
 
@@ -13,6 +16,10 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// ErrVersionConflict is returned when a note was saved by another session
+// after the caller loaded it.
+var ErrVersionConflict = errors.New("note was changed by another session")
+
 // OpenDB opens and returns a database connection.
 func OpenDB() (*sql.DB, error) {
 
@@ -55,25 +62,203 @@ func Authenticate(email, password string) (*int, error) {
 	return &userID, nil // User found, return their ID
 }
 
-// AddItemToDB adds a new item to the database for a specific user.
-func AddItemToDB(item models.ListItemViewModel, userId int) error {
+// AddItemToDB adds a new item to the database for a specific user and returns its ID.
+// Items with a WorkspaceID are created in that workspace, which guests may not do.
+func AddItemToDB(item models.ListItemViewModel, userId int) (int, error) {
 	db, err := OpenDB()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer db.Close()
 
+	var workspaceID sql.NullInt64
+	if item.WorkspaceID != 0 {
+		role, err := workspaceRole(db, item.WorkspaceID, userId)
+		if err != nil {
+			return 0, err
+		}
+		if role == "" || role == models.WorkspaceGuest {
+			return 0, ErrForbidden
+		}
+		workspaceID = sql.NullInt64{Int64: int64(item.WorkspaceID), Valid: true}
+	}
+	s, err := newSealer(db, userId, item.WorkspaceID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := nextID(db, "Note")
+	if err != nil {
+		return 0, err
+	}
+	content := item.Content
+	if err := s.sealAll(at("Note", id), noteFields(&item.ItemTitle, &item.Desc, &item.Content)...); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	// Use the provided userId instead of hardcoding it
-	query := `INSERT INTO "Note" (title, description, content, "userId") VALUES ($1, $2, $3, $4)`
-	_, err = db.Exec(query, item.ItemTitle, item.Desc, item.Content, userId)
+	query := `INSERT INTO "Note" (id, title, description, content, "userId", "workspaceId") VALUES ($1, $2, $3, $4, $5, $6)`
+	if _, err = tx.Exec(query, id, item.ItemTitle, item.Desc, item.Content, userId, workspaceID); err != nil {
+		return 0, err
+	}
+	if err := indexTasks(tx, s, id, content); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateItemInDB saves an existing item if nobody else saved it since item.Version
+// was loaded, and returns the new version. A stale save returns ErrVersionConflict,
+// a user who is neither owner nor editor gets ErrForbidden. A private note cannot be
+// saved with attachments, it gets ErrHasAttachments.
+func UpdateItemInDB(item models.ListItemViewModel, userId int) (int, error) {
+	db, err := OpenDB()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	defer db.Close()
+
+	if _, err := requireRole(db, item.ID, userId, models.RoleEditor); err != nil {
+		return 0, err
+	}
+	s, err := noteSealer(db, item.ID)
+	if err != nil {
+		return 0, err
+	}
+	content := item.Content
+	if err := s.sealAll(at("Note", item.ID), noteFields(&item.ItemTitle, &item.Desc, &item.Content)...); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var version int
+	query := `
+        UPDATE "Note" SET title = $1, description = $2, content = $3, "private" = $6, version = version + 1, "updatedAt" = now()
+        WHERE id = $4 AND version = $5
+        RETURNING version;
+    `
+	err = tx.QueryRow(query, item.ItemTitle, item.Desc, item.Content, item.ID, item.Version, item.Private).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, ErrVersionConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	if item.Private {
+		// Attachments are stored unsealed, see ErrPrivateNote
+		var attached bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM "Attachment" WHERE "noteId" = $1)`, item.ID).Scan(&attached); err != nil {
+			return 0, err
+		}
+		if attached {
+			return 0, ErrHasAttachments
+		}
+	}
+	if err := indexTasks(tx, s, item.ID, content); err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
 }
 
-// FetchItems fetches the items for a specific user from the database
-func FetchItems(userID int) tea.Msg {
+// FetchItem fetches the current state of a single item the user has access to
+func FetchItem(id, userID int) (models.ListItemViewModel, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return models.ListItemViewModel{}, err
+	}
+	defer db.Close()
+
+	role, err := requireRole(db, id, userID, models.RoleViewer)
+	if err != nil {
+		return models.ListItemViewModel{}, err
+	}
+
+	item := models.ListItemViewModel{Role: role}
+	var due, daily sql.NullTime
+	query := `
+        SELECT n.id, n.version, n.title, n.description, n.content, n."private", n."userId",
+            CASE WHEN n."userId" = $2 THEN '' ELSE u.email END, COALESCE(n."workspaceId", 0), n."dueDate", n."dailyDate"
+        FROM "Note" n JOIN "User" u ON u.id = n."userId"
+        WHERE n.id = $1;
+    `
+	err = db.QueryRow(query, id, userID).Scan(&item.ID, &item.Version, &item.ItemTitle, &item.Desc, &item.Content, &item.Private, &item.AuthorID,
+		&item.Owner, &item.WorkspaceID, &due, &daily)
+	if err != nil {
+		return item, err
+	}
+	item.Due, item.Daily = due.Time, daily.Time
+	return item, decryptItem(db, &item)
+}
+
+// FindItem fetches a note the user can read by its ID, or by its title when ref is not a
+// number. Among notes sharing a title, the user's own and then the latest saved win.
+func FindItem(ref string, userID int) (models.ListItemViewModel, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return FetchItem(id, userID)
+	}
+
+	db, err := OpenDB()
+	if err != nil {
+		return models.ListItemViewModel{}, err
+	}
+	// Titles may be sealed, so they are compared once decrypted
+	query := `
+        SELECT n.id, n.title FROM "Note" n ` + noteAccessSQL + `
+        WHERE ` + noteRoleSQL + ` <> 'none'
+        ORDER BY n."userId" = $1 DESC, n."updatedAt" DESC;
+    `
+	id, err := firstTitled(db, strings.TrimSpace(ref), query, userID)
+	db.Close()
+	if err == sql.ErrNoRows {
+		return models.ListItemViewModel{}, ErrForbidden
+	}
+	if err != nil {
+		return models.ListItemViewModel{}, err
+	}
+	return FetchItem(id, userID)
+}
+
+// firstTitled returns the ID of the first note query selects whose title is title in any
+// case, sql.ErrNoRows when there is none. query selects the ID and title.
+func firstTitled(db *sql.DB, title, query string, args ...any) (int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var candidate string
+		if err := rows.Scan(&id, &candidate); err != nil {
+			return 0, err
+		}
+		if err := decrypt(db, at("Note", id), field{"title", &candidate}); err != nil {
+			return 0, err
+		}
+		if strings.EqualFold(candidate, title) {
+			return id, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return 0, sql.ErrNoRows
+}
+
+// FetchItems fetches the items of a workspace (0 for personal notes) the user has access to,
+// their own items first, followed by the ones written by others. Database pages are
+// listed by their database and daily notes by the journal instead.
+func FetchItems(userID, workspaceID int) tea.Msg {
 	db, err := OpenDB() // OpenDB is a function that connects to the database
 	if err != nil {
 		fmt.Println("Error connecting to the database:", err)
@@ -85,11 +270,19 @@ func FetchItems(userID int) tea.Msg {
 
 	// Prepare the query to fetch items for the given userID
 	query := `
-        SELECT title, description, content 
-        FROM "Note" 
-        WHERE "userId" = $1;
+        SELECT id, version, title, description, content, "private", "userId", role, owner, "dueDate" FROM (
+            SELECT n.id, n.version, n.title, n.description, n.content, n."private", n."userId", n."dueDate",
+                ` + noteRoleSQL + ` AS role,
+                CASE WHEN n."userId" = $1 THEN '' ELSE u.email END AS owner
+            FROM "Note" n
+            JOIN "User" u ON u.id = n."userId"
+            ` + noteAccessSQL + `
+            WHERE COALESCE(n."workspaceId", 0) = $2 AND n."collectionId" IS NULL AND n."dailyDate" IS NULL
+        ) notes
+        WHERE role <> 'none'
+        ORDER BY owner <> '', id;
     `
-	rows, err := db.Query(query, userID)
+	rows, err := db.Query(query, userID, workspaceID)
 	fmt.Println("after fetching items", rows)
 	if err != nil {
 		fmt.Println("Error querying the database:", err)
@@ -101,10 +294,19 @@ func FetchItems(userID int) tea.Msg {
 	var userItems []models.ListItemViewModel
 	for rows.Next() {
 		var item models.ListItemViewModel
-		if err := rows.Scan(&item.ItemTitle, &item.Desc, &item.Content); err != nil {
+		var role string
+		var due sql.NullTime
+		if err := rows.Scan(&item.ID, &item.Version, &item.ItemTitle, &item.Desc, &item.Content, &item.Private, &item.AuthorID, &role, &item.Owner, &due); err != nil {
 			fmt.Println("Error scanning row:", err)
 			return models.ItemsMsg{Items: []models.ListItemViewModel{}}
 		}
+		if err := decryptItem(db, &item); err != nil {
+			fmt.Println("Error decrypting note:", err)
+			return models.ItemsMsg{Items: []models.ListItemViewModel{}}
+		}
+		item.Role = models.ParseRole(role)
+		item.Due = due.Time
+		item.WorkspaceID = workspaceID
 		userItems = append(userItems, item)
 	}
 
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// ErrExportLinkInvalid is returned for download links that expired, were used or never existed
+var ErrExportLinkInvalid = errors.New("export link is invalid or expired")
+
+// ExportedNote is a note of the user along with where it lives and its database properties
+type ExportedNote struct {
+	models.ListItemViewModel
+	Workspace  string // empty for personal notes
+	Collection string // database the note is a page of, empty otherwise
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Properties []ExportedProperty
+}
+
+// ExportedProperty is a property value of a database page, relations resolved to page titles
+type ExportedProperty struct {
+	Name  string
+	Type  models.PropertyType
+	Value string
+}
+
+// ExportNotes returns every note the user owns, in any workspace, grouped by workspace and database
+func ExportNotes(userID int) ([]ExportedNote, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return exportNotes(db, `n."userId" = $1`, userID)
+}
+
+// ExportNote returns a single note the way ExportNotes does
+func ExportNote(noteID int) (ExportedNote, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return ExportedNote{}, err
+	}
+	defer db.Close()
+
+	notes, err := exportNotes(db, `n.id = $1`, noteID)
+	if err != nil {
+		return ExportedNote{}, err
+	}
+	if len(notes) == 0 {
+		return ExportedNote{}, sql.ErrNoRows
+	}
+	return notes[0], nil
+}
+
+// exportNotes returns the notes matching scope, a condition on the note n with id as $1
+func exportNotes(db *sql.DB, scope string, id int) ([]ExportedNote, error) {
+	query := `
+        SELECT n.id, n.version, n.title, n.description, n.content, n."private", n."userId", n."createdAt", n."updatedAt", n."dueDate", n."dailyDate",
+            COALESCE(n."workspaceId", 0), COALESCE(w.name, ''), COALESCE(c.name, '')
+        FROM "Note" n
+        LEFT JOIN "Workspace" w ON w.id = n."workspaceId"
+        LEFT JOIN "Collection" c ON c.id = n."collectionId"
+        WHERE ` + scope + `
+        ORDER BY w.name NULLS FIRST, c.name NULLS FIRST, n."dailyDate", n.id;
+    `
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []ExportedNote
+	index := map[int]int{}
+	for rows.Next() {
+		n := ExportedNote{ListItemViewModel: models.ListItemViewModel{Role: models.RoleOwner}}
+		var due, daily sql.NullTime
+		err := rows.Scan(&n.ID, &n.Version, &n.ItemTitle, &n.Desc, &n.Content, &n.Private, &n.AuthorID, &n.CreatedAt, &n.UpdatedAt, &due, &daily,
+			&n.WorkspaceID, &n.Workspace, &n.Collection)
+		if err != nil {
+			return nil, err
+		}
+		if err := decryptItem(db, &n.ListItemViewModel); err != nil {
+			return nil, err
+		}
+		n.Due, n.Daily = due.Time, daily.Time
+		index[n.ID] = len(notes)
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+        SELECT v."noteId", v."propertyId", p.name, p.type, v.value,
+            CASE WHEN p.type = 'relation' THEN (
+                SELECT array_agg(r.title ORDER BY r.id) FROM "Note" r
+                WHERE r.id::text = ANY(string_to_array(replace(v.value, ' ', ''), ','))
+            ) END,
+            CASE WHEN p.type = 'relation' THEN (
+                SELECT array_agg(r.id ORDER BY r.id) FROM "Note" r
+                WHERE r.id::text = ANY(string_to_array(replace(v.value, ' ', ''), ','))
+            ) END
+        FROM "PropertyValue" v
+        JOIN "CollectionProperty" p ON p.id = v."propertyId"
+        JOIN "Note" n ON n.id = v."noteId"
+        WHERE ` + scope + ` AND v.value <> ''
+        ORDER BY v."noteId", p.position, p.id;
+    `
+	rows, err = db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var noteID, propertyID int
+		var p ExportedProperty
+		var titles []string
+		var related []int64
+		if err := rows.Scan(&noteID, &propertyID, &p.Name, &p.Type, &p.Value, pq.Array(&titles), pq.Array(&related)); err != nil {
+			return nil, err
+		}
+		if err := decrypt(db, at("PropertyValue", noteID, propertyID), field{"value", &p.Value}); err != nil {
+			return nil, err
+		}
+		if titles != nil {
+			for i := range titles {
+				if err := decrypt(db, at("Note", int(related[i])), field{"title", &titles[i]}); err != nil {
+					return nil, err
+				}
+			}
+			p.Value = strings.Join(titles, ", ")
+		}
+		if i, ok := index[noteID]; ok {
+			notes[i].Properties = append(notes[i].Properties, p)
+		}
+	}
+	return notes, rows.Err()
+}
+
+// NoteOwner returns the ID of the user who owns the note
+func NoteOwner(noteID int) (int, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow(`SELECT "userId" FROM "Note" WHERE id = $1`, noteID).Scan(&userID)
+	return userID, err
+}
+
+// UserEmail returns the email the user registered with
+func UserEmail(userID int) (string, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var email string
+	err = db.QueryRow(`SELECT email FROM "User" WHERE id = $1`, userID).Scan(&email)
+	return email, err
+}
+
+// CreateExportLink returns a token to download the user's export once, before it expires
+func CreateExportLink(userID int, lifetime time.Duration) (string, time.Time, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer db.Close()
+
+	token, err := newSlug()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(lifetime)
+	_, err = db.Exec(`INSERT INTO "ExportLink" (token, "userId", "expiresAt") VALUES ($1, $2, $3)`, token, userID, expiresAt)
+	return token, expiresAt, err
+}
+
+// RedeemExportLink uses up a download token and returns the user whose export it is for
+func RedeemExportLink(token string) (int, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var userID int
+	query := `
+        UPDATE "ExportLink" SET "usedAt" = now()
+        WHERE token = $1 AND "usedAt" IS NULL AND "expiresAt" > now()
+        RETURNING "userId";
+    `
+	err = db.QueryRow(query, token).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrExportLinkInvalid
+	}
+	return userID, err
+}
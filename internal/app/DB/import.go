@@ -0,0 +1,123 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// ImportedCollection is a database read from another tool; its columns become text properties
+type ImportedCollection struct {
+	Name    string
+	Columns []string
+	Rows    []ImportedRow
+}
+
+// ImportedRow is a page of an imported database, its values in the order of the columns
+type ImportedRow struct {
+	Note   models.ListItemViewModel
+	Values []string
+}
+
+// ImportNotes creates the notes and databases in the user's personal space, or in a workspace
+// they may write to, all at once or not at all
+func ImportNotes(userID, workspaceID int, notes []models.ListItemViewModel, collections []ImportedCollection) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var workspace sql.NullInt64
+	if workspaceID != 0 {
+		role, err := workspaceRole(db, workspaceID, userID)
+		if err != nil {
+			return err
+		}
+		if role == "" || role == models.WorkspaceGuest {
+			return ErrForbidden
+		}
+		workspace = sql.NullInt64{Int64: int64(workspaceID), Valid: true}
+	}
+	s, err := newSealer(db, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insertNote := func(item models.ListItemViewModel, collection sql.NullInt64) (int, error) {
+		var due sql.NullString
+		if !item.Due.IsZero() {
+			due = sql.NullString{String: item.Due.Format(models.DateLayout), Valid: true}
+		}
+		id, err := nextID(tx, "Note")
+		if err != nil {
+			return 0, err
+		}
+		content := item.Content
+		if err := s.sealAll(at("Note", id), noteFields(&item.ItemTitle, &item.Desc, &item.Content)...); err != nil {
+			return 0, err
+		}
+		query := `
+            INSERT INTO "Note" (id, title, description, content, "userId", "workspaceId", "collectionId", "dueDate")
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+        `
+		if _, err := tx.Exec(query, id, item.ItemTitle, item.Desc, item.Content, userID, workspace, collection, due); err != nil {
+			return 0, err
+		}
+		return id, indexTasks(tx, s, id, content)
+	}
+
+	for _, item := range notes {
+		if _, err := insertNote(item, sql.NullInt64{}); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range collections {
+		var collectionID int
+		query := `INSERT INTO "Collection" (name, "userId", "workspaceId") VALUES ($1, $2, $3) RETURNING id`
+		if err := tx.QueryRow(query, c.Name, userID, workspace).Scan(&collectionID); err != nil {
+			return err
+		}
+		propertyIDs := make([]int, len(c.Columns))
+		for index, column := range c.Columns {
+			query := `
+                INSERT INTO "CollectionProperty" ("collectionId", name, type, options, position)
+                VALUES ($1, $2, $3, $4, $5) RETURNING id;
+            `
+			err := tx.QueryRow(query, collectionID, column, models.PropertyText, pq.Array([]string{}), index+1).Scan(&propertyIDs[index])
+			if err != nil {
+				return err
+			}
+		}
+		for _, row := range c.Rows {
+			noteID, err := insertNote(row.Note, sql.NullInt64{Int64: int64(collectionID), Valid: true})
+			if err != nil {
+				return err
+			}
+			for index, value := range row.Values {
+				if index >= len(propertyIDs) || value == "" {
+					continue
+				}
+				// Imported columns are all text, sealed like the page
+				sealed, err := s.seal(at("PropertyValue", noteID, propertyIDs[index]), "value", value)
+				if err != nil {
+					return err
+				}
+				query := `INSERT INTO "PropertyValue" ("noteId", "propertyId", value) VALUES ($1, $2, $3)`
+				if _, err := tx.Exec(query, noteID, propertyIDs[index], sealed); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return tx.Commit()
+}
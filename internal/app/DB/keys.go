@@ -0,0 +1,53 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrUnknownKey is returned for SSH keys nobody logged in with yet
+var ErrUnknownKey = errors.New("this SSH key is not linked to an account")
+
+// LinkKey makes the SSH key of that fingerprint identify the user, who signed in with it and
+// their password. Whoever holds a key decides, so linking takes it from another account.
+func LinkKey(userID int, fingerprint string) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := `
+        INSERT INTO "UserKey" (fingerprint, "userId", verified) VALUES ($1, $2, true)
+        ON CONFLICT (fingerprint) DO UPDATE SET "userId" = EXCLUDED."userId", verified = true, "createdAt" = now();
+    `
+	_, err = db.Exec(query, fingerprint, userID)
+	return err
+}
+
+// KeyLinked reports whether the SSH key of that fingerprint identifies the user
+func KeyLinked(userID int, fingerprint string) (bool, error) {
+	id, _, err := UserByKey(fingerprint)
+	if err == ErrUnknownKey {
+		return false, nil
+	}
+	return id == userID, err
+}
+
+// UserByKey returns the ID and email of the user the SSH key of that fingerprint is linked to
+func UserByKey(fingerprint string) (int, string, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return 0, "", err
+	}
+	defer db.Close()
+
+	var userID int
+	var email string
+	query := `SELECT u.id, u.email FROM "UserKey" k JOIN "User" u ON u.id = k."userId" WHERE k.fingerprint = $1 AND k.verified`
+	err = db.QueryRow(query, fingerprint).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrUnknownKey
+	}
+	return userID, email, err
+}
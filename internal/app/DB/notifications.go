@@ -0,0 +1,234 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// Notification is an entry of a user's inbox
+type Notification struct {
+	ID        int
+	UserID    int
+	Kind      string
+	ActorID   int
+	Actor     string // email of ActorID, filled in when fetching
+	NoteID    int
+	Body      string
+	Read      bool
+	CreatedAt time.Time
+}
+
+// nullableID stores 0 as NULL for optional references
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// notificationSealer returns the sealer for a notification's body, which quotes the note it is
+// about, or the recipient's own for notifications about no note
+func notificationSealer(db queryer, n Notification) (*sealer, error) {
+	if n.NoteID != 0 {
+		return noteSealer(db, n.NoteID)
+	}
+	return newSealer(db, n.UserID, 0)
+}
+
+// AddNotification records a notification in n.UserID's inbox
+func AddNotification(n Notification) (Notification, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return n, err
+	}
+	defer db.Close()
+
+	s, err := notificationSealer(db, n)
+	if err != nil {
+		return n, err
+	}
+	if n.ID, err = nextID(db, "Notification"); err != nil {
+		return n, err
+	}
+	body, err := s.seal(at("Notification", n.ID), "body", n.Body)
+	if err != nil {
+		return n, err
+	}
+	query := `
+        INSERT INTO "Notification" (id, "userId", kind, "actorId", "noteId", body)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING "createdAt";
+    `
+	err = db.QueryRow(query, n.ID, n.UserID, n.Kind, nullableID(n.ActorID), nullableID(n.NoteID), body).Scan(&n.CreatedAt)
+	return n, err
+}
+
+// FetchNotifications returns the user's most recent notifications, newest first
+func FetchNotifications(userID, limit int) ([]Notification, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+        SELECT n.id, n.kind, COALESCE(n."actorId", 0), COALESCE(u.email, ''), COALESCE(n."noteId", 0), n.body, n."readAt" IS NOT NULL, n."createdAt"
+        FROM "Notification" n LEFT JOIN "User" u ON u.id = n."actorId"
+        WHERE n."userId" = $1
+        ORDER BY n."createdAt" DESC
+        LIMIT $2;
+    `
+	rows, err := db.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		n := Notification{UserID: userID}
+		if err := rows.Scan(&n.ID, &n.Kind, &n.ActorID, &n.Actor, &n.NoteID, &n.Body, &n.Read, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := decrypt(db, at("Notification", n.ID), field{"body", &n.Body}); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// UnreadNotifications counts the notifications the user has not opened yet
+func UnreadNotifications(userID int) (int, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow(`SELECT count(*) FROM "Notification" WHERE "userId" = $1 AND "readAt" IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationsRead marks the given notifications of the user as read, or all of them when no IDs are given
+func MarkNotificationsRead(userID int, ids ...int) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if len(ids) == 0 {
+		_, err = db.Exec(`UPDATE "Notification" SET "readAt" = now() WHERE "userId" = $1 AND "readAt" IS NULL`, userID)
+		return err
+	}
+	_, err = db.Exec(`UPDATE "Notification" SET "readAt" = now() WHERE "userId" = $1 AND id = ANY($2) AND "readAt" IS NULL`, userID, pq.Array(ids))
+	return err
+}
+
+// FollowNote subscribes the user to saves of a note they can read, or unsubscribes them
+func FollowNote(noteID, userID int, follow bool) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleViewer); err != nil {
+		return err
+	}
+	if !follow {
+		_, err = db.Exec(`DELETE FROM "NoteFollow" WHERE "noteId" = $1 AND "userId" = $2`, noteID, userID)
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO "NoteFollow" ("noteId", "userId") VALUES ($1, $2) ON CONFLICT DO NOTHING`, noteID, userID)
+	return err
+}
+
+// IsFollowing reports whether the user follows the note
+func IsFollowing(noteID, userID int) (bool, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var following bool
+	query := `SELECT EXISTS (SELECT 1 FROM "NoteFollow" WHERE "noteId" = $1 AND "userId" = $2)`
+	err = db.QueryRow(query, noteID, userID).Scan(&following)
+	return following, err
+}
+
+// NoteFollowers lists the users following a note who can still read it
+func NoteFollowers(noteID int) ([]int, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT "userId" FROM "NoteFollow" WHERE "noteId" = $1`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var followers []int
+	for _, userID := range candidates {
+		if role, err := noteRole(db, noteID, userID); err == nil && role >= models.RoleViewer {
+			followers = append(followers, userID)
+		}
+	}
+	return followers, nil
+}
+
+// ThreadParticipants lists the authors of a comment thread who can still read its note
+func ThreadParticipants(threadID int) ([]int, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `SELECT DISTINCT c."authorId", t."noteId" FROM "Comment" c JOIN "Comment" t ON t.id = $1 WHERE c.id = $1 OR c."parentId" = $1`
+	rows, err := db.Query(query, threadID)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []int
+	noteID := 0
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID, &noteID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var authors []int
+	for _, userID := range candidates {
+		if role, err := noteRole(db, noteID, userID); err == nil && role >= models.RoleViewer {
+			authors = append(authors, userID)
+		}
+	}
+	return authors, nil
+}
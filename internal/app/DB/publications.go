@@ -0,0 +1,135 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// ErrNotPublished is returned for slugs that never existed, were revoked or expired
+var ErrNotPublished = errors.New("note is not published")
+
+// Publication is a public read-only link to a note
+type Publication struct {
+	Slug      string
+	ExpiresAt *time.Time
+}
+
+// activePublicationSQL restricts "NotePublication" p to links that still work
+const activePublicationSQL = `p."revokedAt" IS NULL AND (p."expiresAt" IS NULL OR p."expiresAt" > now())`
+
+// newSlug returns an unguessable URL-safe identifier
+func newSlug() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PublishNote makes the note readable by anyone with the returned link, until expiresAt
+// if set. Publishing again replaces the previous link. Only the owner may publish.
+func PublishNote(noteID, userID int, expiresAt *time.Time) (Publication, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return Publication{}, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleOwner); err != nil {
+		return Publication{}, err
+	}
+	slug, err := newSlug()
+	if err != nil {
+		return Publication{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Publication{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE "NotePublication" SET "revokedAt" = now() WHERE "noteId" = $1 AND "revokedAt" IS NULL`, noteID); err != nil {
+		return Publication{}, err
+	}
+	query := `INSERT INTO "NotePublication" (slug, "noteId", "createdBy", "expiresAt") VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(query, slug, noteID, userID, expiresAt); err != nil {
+		return Publication{}, err
+	}
+	return Publication{Slug: slug, ExpiresAt: expiresAt}, tx.Commit()
+}
+
+// RevokePublication turns off the note's public link. Only the owner may revoke.
+func RevokePublication(noteID, userID int) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleOwner); err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE "NotePublication" SET "revokedAt" = now() WHERE "noteId" = $1 AND "revokedAt" IS NULL`, noteID)
+	return err
+}
+
+// NotePublication returns the note's working public link, nil when it has none
+func NotePublication(noteID, userID int) (*Publication, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	var p Publication
+	query := `SELECT p.slug, p."expiresAt" FROM "NotePublication" p WHERE p."noteId" = $1 AND ` + activePublicationSQL
+	err = db.QueryRow(query, noteID).Scan(&p.Slug, &p.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PublishedNote fetches the note behind a public link, without any user
+func PublishedNote(slug string) (models.ListItemViewModel, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return models.ListItemViewModel{}, err
+	}
+	defer db.Close()
+
+	var item models.ListItemViewModel
+	query := `
+        SELECT n.id, n.title, n.description, n.content, n."private"
+        FROM "NotePublication" p JOIN "Note" n ON n.id = p."noteId"
+        WHERE p.slug = $1 AND ` + activePublicationSQL
+	err = db.QueryRow(query, slug).Scan(&item.ID, &item.ItemTitle, &item.Desc, &item.Content, &item.Private)
+	if err == sql.ErrNoRows {
+		return item, ErrNotPublished
+	}
+	if err != nil {
+		return item, err
+	}
+	item.Role = models.RoleViewer
+	if err := decryptItem(db, &item); err != nil {
+		return item, err
+	}
+	if item.Locked() {
+		// Made private after it was published, it is not readable anymore
+		return item, ErrNotPublished
+	}
+	return item, nil
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"time"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// Reminder is a pending reminder of the current user
+type Reminder struct {
+	ID       int
+	NoteID   int
+	TaskText string // empty for reminders about the whole note
+	RemindAt time.Time
+}
+
+// AddReminder schedules a reminder for the user about a note they can read, or one of its tasks
+func AddReminder(userID, noteID int, taskText string, remindAt time.Time) (Reminder, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return Reminder{}, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, userID, models.RoleViewer); err != nil {
+		return Reminder{}, err
+	}
+
+	// The task text is part of the note, so it is sealed like the note
+	s, err := noteSealer(db, noteID)
+	if err != nil {
+		return Reminder{}, err
+	}
+	r := Reminder{NoteID: noteID, TaskText: taskText, RemindAt: remindAt}
+	if r.ID, err = nextID(db, "Reminder"); err != nil {
+		return r, err
+	}
+	sealed, err := s.seal(at("Reminder", r.ID), "taskText", taskText)
+	if err != nil {
+		return r, err
+	}
+
+	query := `INSERT INTO "Reminder" (id, "userId", "noteId", "taskText", "remindAt") VALUES ($1, $2, $3, $4, $5)`
+	_, err = db.Exec(query, r.ID, userID, noteID, sealed, remindAt)
+	return r, err
+}
+
+// PendingReminders lists the user's reminders on a note that have not gone off yet, soonest first
+func PendingReminders(noteID, userID int) ([]Reminder, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+        SELECT id, "noteId", "taskText", "remindAt" FROM "Reminder"
+        WHERE "noteId" = $1 AND "userId" = $2 AND "firedAt" IS NULL
+        ORDER BY "remindAt";
+    `
+	rows, err := db.Query(query, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []Reminder
+	for rows.Next() {
+		var r Reminder
+		if err := rows.Scan(&r.ID, &r.NoteID, &r.TaskText, &r.RemindAt); err != nil {
+			return nil, err
+		}
+		if err := decrypt(db, at("Reminder", r.ID), field{"taskText", &r.TaskText}); err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
+
+// CancelReminders drops the user's pending reminders on a note
+func CancelReminders(noteID, userID int) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM "Reminder" WHERE "noteId" = $1 AND "userId" = $2 AND "firedAt" IS NULL`, noteID, userID)
+	return err
+}
+
+// FireDueReminders marks every reminder whose time has come as fired and records it in its
+// user's inbox, in one transaction so a restart neither loses nor repeats reminders. Reminders
+// that came due while the server was down fire on the first call.
+func FireDueReminders() ([]Notification, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED lets several server processes share the table without firing twice
+	query := `
+        UPDATE "Reminder" r SET "firedAt" = now()
+        FROM "Note" n
+        WHERE n.id = r."noteId" AND r.id IN (
+            SELECT id FROM "Reminder" WHERE "firedAt" IS NULL AND "remindAt" <= now()
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING r.id, r."userId", r."noteId", r."taskText", n.title, n."private";
+    `
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	var notifications []Notification
+	for rows.Next() {
+		n := Notification{Kind: "reminder"}
+		var reminderID int
+		var task, title string
+		var private bool
+		if err := rows.Scan(&reminderID, &n.UserID, &n.NoteID, &task, &title, &private); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := decrypt(db, at("Reminder", reminderID), field{"taskText", &task}); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := decrypt(db, at("Note", n.NoteID), field{"title", &title}); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if private {
+			title = "a private note"
+		}
+		n.Body = "Reminder: " + title
+		if task != "" {
+			n.Body = "Reminder: " + task + " (" + title + ")"
+		}
+		notifications = append(notifications, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Reminders of notes the user lost access to fire without a word
+	sent := notifications[:0]
+	for _, n := range notifications {
+		if role, err := noteRole(tx, n.NoteID, n.UserID); err != nil {
+			return nil, err
+		} else if role < models.RoleViewer {
+			continue
+		}
+		s, err := notificationSealer(tx, n)
+		if err != nil {
+			return nil, err
+		}
+		if n.ID, err = nextID(tx, "Notification"); err != nil {
+			return nil, err
+		}
+		body, err := s.seal(at("Notification", n.ID), "body", n.Body)
+		if err != nil {
+			return nil, err
+		}
+		query := `INSERT INTO "Notification" (id, "userId", kind, "noteId", body) VALUES ($1, $2, $3, $4, $5) RETURNING "createdAt"`
+		if err := tx.QueryRow(query, n.ID, n.UserID, n.Kind, n.NoteID, body).Scan(&n.CreatedAt); err != nil {
+			return nil, err
+		}
+		sent = append(sent, n)
+	}
+	return sent, tx.Commit()
+}
@@ -0,0 +1,231 @@
+package db
+
+// migrations are applied in order on every start, so each statement must be idempotent.
+// The "User" and "Note" tables themselves are owned by the web client.
+var migrations = []string{
+	// version is bumped on every save and used to reject stale writes
+	`ALTER TABLE "Note" ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1`,
+	// roles granted on a note to users other than its owner
+	`CREATE TABLE IF NOT EXISTS "NoteShare" (
+		"noteId" INTEGER NOT NULL REFERENCES "Note"(id) ON DELETE CASCADE,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		role TEXT NOT NULL CHECK (role IN ('viewer', 'commenter', 'editor')),
+		"createdAt" TIMESTAMP NOT NULL DEFAULT now(),
+		PRIMARY KEY ("noteId", "userId")
+	)`,
+	// team spaces; notes without a workspace are their owner's personal notes
+	`CREATE TABLE IF NOT EXISTS "Workspace" (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		"createdAt" TIMESTAMP NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS "WorkspaceMember" (
+		"workspaceId" INTEGER NOT NULL REFERENCES "Workspace"(id) ON DELETE CASCADE,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'member', 'guest')),
+		PRIMARY KEY ("workspaceId", "userId")
+	)`,
+	`ALTER TABLE "Note" ADD COLUMN IF NOT EXISTS "workspaceId" INTEGER REFERENCES "Workspace"(id) ON DELETE CASCADE`,
+	// public read-only links; revoked and expired rows are kept so old slugs never come back to life
+	`CREATE TABLE IF NOT EXISTS "NotePublication" (
+		slug TEXT PRIMARY KEY,
+		"noteId" INTEGER NOT NULL REFERENCES "Note"(id) ON DELETE CASCADE,
+		"createdBy" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now(),
+		"expiresAt" TIMESTAMPTZ,
+		"revokedAt" TIMESTAMPTZ
+	)`,
+	// comment threads anchored to a line range of a note; replies point at the first comment
+	`CREATE TABLE IF NOT EXISTS "Comment" (
+		id SERIAL PRIMARY KEY,
+		"noteId" INTEGER NOT NULL REFERENCES "Note"(id) ON DELETE CASCADE,
+		"authorId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		"parentId" INTEGER REFERENCES "Comment"(id) ON DELETE CASCADE,
+		"lineStart" INTEGER NOT NULL,
+		"lineEnd" INTEGER NOT NULL,
+		body TEXT NOT NULL,
+		resolved BOOLEAN NOT NULL DEFAULT false,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now(),
+		"updatedAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS "CommentMention" (
+		"commentId" INTEGER NOT NULL REFERENCES "Comment"(id) ON DELETE CASCADE,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		PRIMARY KEY ("commentId", "userId")
+	)`,
+	// inbox entries; body is rendered when the event happens so it survives the note being renamed
+	`CREATE TABLE IF NOT EXISTS "Notification" (
+		id SERIAL PRIMARY KEY,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		kind TEXT NOT NULL,
+		"actorId" INTEGER REFERENCES "User"(id) ON DELETE SET NULL,
+		"noteId" INTEGER REFERENCES "Note"(id) ON DELETE CASCADE,
+		body TEXT NOT NULL,
+		"readAt" TIMESTAMPTZ,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS "Notification_userId_createdAt_idx" ON "Notification" ("userId", "createdAt")`,
+	// users who get notified when a note is saved
+	`CREATE TABLE IF NOT EXISTS "NoteFollow" (
+		"noteId" INTEGER NOT NULL REFERENCES "Note"(id) ON DELETE CASCADE,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		PRIMARY KEY ("noteId", "userId")
+	)`,
+	// databases: their rows are notes pointing at them, the columns are typed properties
+	`CREATE TABLE IF NOT EXISTS "Collection" (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		"workspaceId" INTEGER REFERENCES "Workspace"(id) ON DELETE CASCADE,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS "CollectionProperty" (
+		id SERIAL PRIMARY KEY,
+		"collectionId" INTEGER NOT NULL REFERENCES "Collection"(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL CHECK (type IN ('text', 'number', 'select', 'multi-select', 'date', 'checkbox', 'person', 'relation')),
+		options TEXT[] NOT NULL DEFAULT '{}',
+		"relationId" INTEGER REFERENCES "Collection"(id) ON DELETE SET NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		UNIQUE ("collectionId", name)
+	)`,
+	`ALTER TABLE "Note" ADD COLUMN IF NOT EXISTS "collectionId" INTEGER REFERENCES "Collection"(id) ON DELETE CASCADE`,
+	// values are stored in their normalized text form, see models.Property.Normalize
+	`CREATE TABLE IF NOT EXISTS "PropertyValue" (
+		"noteId" INTEGER NOT NULL REFERENCES "Note"(id) ON DELETE CASCADE,
+		"propertyId" INTEGER NOT NULL REFERENCES "CollectionProperty"(id) ON DELETE CASCADE,
+		value TEXT NOT NULL,
+		PRIMARY KEY ("noteId", "propertyId")
+	)`,
+	// dates the calendar places notes by; the web client may already keep the first two
+	`ALTER TABLE "Note" ADD COLUMN IF NOT EXISTS "createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()`,
+	`ALTER TABLE "Note" ADD COLUMN IF NOT EXISTS "updatedAt" TIMESTAMPTZ NOT NULL DEFAULT now()`,
+	`ALTER TABLE "Note" ADD COLUMN IF NOT EXISTS "dueDate" DATE`,
+	// daily notes are personal notes marked with their day, one per user and day
+	`ALTER TABLE "Note" ADD COLUMN IF NOT EXISTS "dailyDate" DATE`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "Note_userId_dailyDate_key" ON "Note" ("userId", "dailyDate") WHERE "dailyDate" IS NOT NULL`,
+	// starting points for new notes, personal ones have no workspace
+	`CREATE TABLE IF NOT EXISTS "NoteTemplate" (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		"workspaceId" INTEGER REFERENCES "Workspace"(id) ON DELETE CASCADE,
+		title TEXT NOT NULL,
+		description TEXT NOT NULL,
+		content TEXT NOT NULL,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	// checklist items of notes, rebuilt from the content on every save
+	`CREATE TABLE IF NOT EXISTS "Task" (
+		"noteId" INTEGER NOT NULL REFERENCES "Note"(id) ON DELETE CASCADE,
+		line INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		done BOOLEAN NOT NULL DEFAULT false,
+		"dueDate" DATE,
+		PRIMARY KEY ("noteId", line)
+	)`,
+	// reminders on a note, or on one of its tasks; fired ones are kept with the time they went off
+	`CREATE TABLE IF NOT EXISTS "Reminder" (
+		id SERIAL PRIMARY KEY,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		"noteId" INTEGER NOT NULL REFERENCES "Note"(id) ON DELETE CASCADE,
+		"taskText" TEXT NOT NULL DEFAULT '',
+		"remindAt" TIMESTAMPTZ NOT NULL,
+		"firedAt" TIMESTAMPTZ,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS "Reminder_pending_idx" ON "Reminder" ("remindAt") WHERE "firedAt" IS NULL`,
+	// SSH keys users logged in to the TUI with, identifying them for exec commands like export
+	`CREATE TABLE IF NOT EXISTS "UserKey" (
+		fingerprint TEXT PRIMARY KEY,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	// keys linked on login were offered, not proven, and identify nobody until linked again
+	`ALTER TABLE "UserKey" ADD COLUMN IF NOT EXISTS verified BOOLEAN NOT NULL DEFAULT false`,
+	// single-use links to download an export over HTTP
+	`CREATE TABLE IF NOT EXISTS "ExportLink" (
+		token TEXT PRIMARY KEY,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		"expiresAt" TIMESTAMPTZ NOT NULL,
+		"usedAt" TIMESTAMPTZ
+	)`,
+	// keys sealing note content, one per user for personal notes and one per workspace, wrapped
+	// by a master key from the server's configuration that masterKeyId identifies
+	`CREATE TABLE IF NOT EXISTS "DataKey" (
+		id SERIAL PRIMARY KEY,
+		"userId" INTEGER REFERENCES "User"(id) ON DELETE CASCADE,
+		"workspaceId" INTEGER REFERENCES "Workspace"(id) ON DELETE CASCADE,
+		"wrappedKey" TEXT NOT NULL,
+		"masterKeyId" TEXT NOT NULL,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now(),
+		CHECK (("userId" IS NULL) <> ("workspaceId" IS NULL))
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "DataKey_userId_key" ON "DataKey" ("userId") WHERE "userId" IS NOT NULL`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "DataKey_workspaceId_key" ON "DataKey" ("workspaceId") WHERE "workspaceId" IS NOT NULL`,
+	// salt of the passphrase sealing a user's private notes, and a value sealed with it to tell
+	// a wrong passphrase; neither the passphrase nor the key derived from it is stored
+	`CREATE TABLE IF NOT EXISTS "PrivateVault" (
+		"userId" INTEGER PRIMARY KEY REFERENCES "User"(id) ON DELETE CASCADE,
+		salt TEXT NOT NULL,
+		"check" TEXT NOT NULL,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	// files attached to notes, whose contents live in the blob store under blobKey; size counts
+	// against the quota of the user who uploaded them
+	`CREATE TABLE IF NOT EXISTS "Attachment" (
+		id SERIAL PRIMARY KEY,
+		"noteId" INTEGER NOT NULL REFERENCES "Note"(id) ON DELETE CASCADE,
+		"userId" INTEGER NOT NULL REFERENCES "User"(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		"contentType" TEXT NOT NULL,
+		"blobKey" TEXT NOT NULL UNIQUE,
+		"createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS "Attachment_noteId_idx" ON "Attachment" ("noteId")`,
+	`CREATE INDEX IF NOT EXISTS "Attachment_userId_idx" ON "Attachment" ("userId")`,
+	// blobs of deleted attachments, until they are removed from the blob store. A trigger fills
+	// it so that attachments deleted along with their note or user are caught too.
+	`CREATE TABLE IF NOT EXISTS "BlobTrash" (
+		"blobKey" TEXT PRIMARY KEY,
+		"deletedAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE OR REPLACE FUNCTION "Attachment_trash"() RETURNS trigger AS $$
+	BEGIN
+		INSERT INTO "BlobTrash" ("blobKey") VALUES (OLD."blobKey") ON CONFLICT DO NOTHING;
+		RETURN OLD;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS "Attachment_trash" ON "Attachment"`,
+	`CREATE TRIGGER "Attachment_trash" AFTER DELETE ON "Attachment" FOR EACH ROW EXECUTE FUNCTION "Attachment_trash"()`,
+	// links to download an attachment over HTTP until they expire
+	`CREATE TABLE IF NOT EXISTS "AttachmentLink" (
+		token TEXT PRIMARY KEY,
+		"attachmentId" INTEGER NOT NULL REFERENCES "Attachment"(id) ON DELETE CASCADE,
+		"expiresAt" TIMESTAMPTZ NOT NULL
+	)`,
+	// private notes are sealed with their author's passphrase, NULL until backfillPrivate
+	// looked at the notes saved before the flag existed
+	`ALTER TABLE "Note" ADD COLUMN IF NOT EXISTS "private" BOOLEAN`,
+	`ALTER TABLE "Note" ALTER COLUMN "private" SET DEFAULT false`,
+}
+
+// Migrate adds the columns and tables the ssh app needs on top of the web client's schema.
+func Migrate() error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, stmt := range migrations {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if err := backfillPrivate(db); err != nil {
+		return err
+	}
+	return backfillTasks(db)
+}
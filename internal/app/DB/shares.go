@@ -0,0 +1,162 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// ErrForbidden is returned when the user's role on a note does not allow the operation
+var ErrForbidden = errors.New("you do not have access to this note")
+
+// ErrUnknownUser is returned when sharing with an email nobody registered
+var ErrUnknownUser = errors.New("no user with that email")
+
+// Share is a grant of a role on a note to another user
+type Share struct {
+	Email string
+	Role  models.Role
+}
+
+// noteAccessSQL joins what decides a user's role on the notes aliased n, for the user in $1
+const noteAccessSQL = `
+        LEFT JOIN "NoteShare" s ON s."noteId" = n.id AND s."userId" = $1
+        LEFT JOIN "WorkspaceMember" wm ON wm."workspaceId" = n."workspaceId" AND wm."userId" = $1
+`
+
+// noteRoleSQL computes the role granted by noteAccessSQL: the author and workspace
+// owners and admins own a note, members edit it, guests and outsiders get what
+// "NoteShare" grants them. Notes have no children, so a grant covers exactly one note.
+const noteRoleSQL = `
+        CASE
+            WHEN n."userId" = $1 OR wm.role IN ('owner', 'admin') THEN 'owner'
+            WHEN wm.role = 'member' THEN 'editor'
+            ELSE COALESCE(s.role, 'none')
+        END
+`
+
+// noteRole returns what the user may do with the note
+func noteRole(db queryer, noteID, userID int) (models.Role, error) {
+	var role string
+	query := `SELECT ` + noteRoleSQL + ` FROM "Note" n ` + noteAccessSQL + ` WHERE n.id = $2`
+	err := db.QueryRow(query, userID, noteID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return models.RoleNone, nil
+	}
+	if err != nil {
+		return models.RoleNone, err
+	}
+	return models.ParseRole(role), nil
+}
+
+// requireRole fails with ErrForbidden unless the user has at least the given role on the note
+func requireRole(db *sql.DB, noteID, userID int, min models.Role) (models.Role, error) {
+	role, err := noteRole(db, noteID, userID)
+	if err != nil {
+		return role, err
+	}
+	if role < min {
+		return role, ErrForbidden
+	}
+	return role, nil
+}
+
+// NoteAccess tells whether the user may still read the note, and whether it is private, for
+// what is sent about it after the fact
+func NoteAccess(noteID, userID int) (readable, private bool, err error) {
+	db, err := OpenDB()
+	if err != nil {
+		return false, false, err
+	}
+	defer db.Close()
+
+	role, err := noteRole(db, noteID, userID)
+	if err != nil {
+		return false, false, err
+	}
+	err = db.QueryRow(`SELECT "private" FROM "Note" WHERE id = $1`, noteID).Scan(&private)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	return role >= models.RoleViewer, private, err
+}
+
+// ShareNote grants the user registered under email a role on the note, replacing
+// any previous grant, and returns that user's ID. RoleNone revokes access. Only the
+// owner may share.
+func ShareNote(noteID, ownerID int, email string, role models.Role) (int, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, ownerID, models.RoleOwner); err != nil {
+		return 0, err
+	}
+
+	var userID int
+	err = db.QueryRow(`SELECT id FROM "User" WHERE email = $1`, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrUnknownUser
+	}
+	if err != nil {
+		return 0, err
+	}
+	if userID == ownerID {
+		return userID, nil
+	}
+	if role == models.RoleOwner {
+		// Ownership comes from authorship or workspace administration, not from shares
+		return 0, ErrForbidden
+	}
+
+	if role == models.RoleNone {
+		_, err = db.Exec(`DELETE FROM "NoteShare" WHERE "noteId" = $1 AND "userId" = $2`, noteID, userID)
+		return userID, err
+	}
+	query := `
+        INSERT INTO "NoteShare" ("noteId", "userId", role) VALUES ($1, $2, $3)
+        ON CONFLICT ("noteId", "userId") DO UPDATE SET role = EXCLUDED.role;
+    `
+	_, err = db.Exec(query, noteID, userID, role.String())
+	return userID, err
+}
+
+// NoteShares lists who the note is shared with. Only the owner may see it.
+func NoteShares(noteID, ownerID int) ([]Share, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, noteID, ownerID, models.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT u.email, s.role
+        FROM "NoteShare" s JOIN "User" u ON u.id = s."userId"
+        WHERE s."noteId" = $1
+        ORDER BY u.email;
+    `
+	rows, err := db.Query(query, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []Share
+	for rows.Next() {
+		var share Share
+		var role string
+		if err := rows.Scan(&share.Email, &role); err != nil {
+			return nil, err
+		}
+		share.Role = models.ParseRole(role)
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// execer is what the task index needs, satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// indexTasks replaces the indexed tasks of a note with the ones in its plaintext content,
+// sealing their text like the note's
+func indexTasks(ex execer, s *sealer, noteID int, content string) error {
+	if _, err := ex.Exec(`DELETE FROM "Task" WHERE "noteId" = $1`, noteID); err != nil {
+		return err
+	}
+	for _, t := range models.ParseTasks(content) {
+		var due sql.NullString
+		if !t.Due.IsZero() {
+			due = sql.NullString{String: t.Due.Format(models.DateLayout), Valid: true}
+		}
+		text, err := s.seal(at("Task", noteID, t.Line), "text", t.Text)
+		if err != nil {
+			return err
+		}
+		query := `INSERT INTO "Task" ("noteId", line, text, done, "dueDate") VALUES ($1, $2, $3, $4, $5)`
+		if _, err := ex.Exec(query, noteID, t.Line, text, t.Done, due); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillTasks indexes notes that hold checklist items but have no indexed tasks, such as
+// notes written before the index existed or by the web client. Those are in plaintext, notes
+// sealed by this app are indexed whenever they are saved.
+func backfillTasks(db *sql.DB) error {
+	query := `
+        SELECT n.id, n.content FROM "Note" n
+        WHERE n.content ~ '[-*+]\s+\[[ xX]\]'
+            AND NOT EXISTS (SELECT 1 FROM "Task" t WHERE t."noteId" = n.id);
+    `
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	contents := map[int]string{}
+	for rows.Next() {
+		var id int
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return err
+		}
+		contents[id] = content
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, content := range contents {
+		s, err := noteSealer(db, id)
+		if err != nil {
+			return err
+		}
+		if err := indexTasks(db, s, id, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchTasks lists the tasks of every note the user has access to, in any workspace, open
+// tasks first by due date, tasks without one last. Done tasks are left out unless showDone.
+func FetchTasks(userID int, showDone bool) ([]models.Task, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+        SELECT "noteId", title, role, line, text, done, "dueDate" FROM (
+            SELECT t."noteId", n.title, t.line, t.text, t.done, t."dueDate",
+                ` + noteRoleSQL + ` AS role
+            FROM "Task" t
+            JOIN "Note" n ON n.id = t."noteId"
+            ` + noteAccessSQL + `
+            WHERE $2 OR NOT t.done
+        ) tasks
+        WHERE role <> 'none'
+        ORDER BY done, "dueDate" NULLS LAST, "noteId", line;
+    `
+	rows, err := db.Query(query, userID, showDone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		var t models.Task
+		var role string
+		var due sql.NullTime
+		if err := rows.Scan(&t.NoteID, &t.NoteTitle, &role, &t.Line, &t.Text, &t.Done, &due); err != nil {
+			return nil, err
+		}
+		if err := decrypt(db, at("Note", t.NoteID), field{"title", &t.NoteTitle}); err != nil {
+			return nil, err
+		}
+		if err := decrypt(db, at("Task", t.NoteID, t.Line), field{"text", &t.Text}); err != nil {
+			return nil, err
+		}
+		t.Role = models.ParseRole(role)
+		t.Due = due.Time
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// SetTaskDone checks or unchecks a task in its note and returns the note's new version.
+// ErrVersionConflict means the line changed since the task was read.
+func SetTaskDone(userID int, task models.Task, done bool) (int, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if _, err := requireRole(db, task.NoteID, userID, models.RoleEditor); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	s, err := noteSealer(db, task.NoteID)
+	if err != nil {
+		return 0, err
+	}
+	var content string
+	if err := tx.QueryRow(`SELECT content FROM "Note" WHERE id = $1 FOR UPDATE`, task.NoteID).Scan(&content); err != nil {
+		return 0, err
+	}
+	if err := decrypt(db, at("Note", task.NoteID), field{"content", &content}); err != nil {
+		return 0, err
+	}
+	content, ok := models.SetTaskDone(content, task, done)
+	if !ok {
+		return 0, ErrVersionConflict
+	}
+	sealed, err := s.seal(at("Note", task.NoteID), "content", content)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	query := `UPDATE "Note" SET content = $1, version = version + 1, "updatedAt" = now() WHERE id = $2 RETURNING version`
+	if err := tx.QueryRow(query, sealed, task.NoteID).Scan(&version); err != nil {
+		return 0, err
+	}
+	if err := indexTasks(tx, s, task.NoteID, content); err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// FetchTemplates lists the user's personal templates followed by those of the workspace
+// (0 for none), which guests do not see
+func FetchTemplates(userID, workspaceID int) ([]models.Template, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+        SELECT t.id, t.name, COALESCE(t."workspaceId", 0), t.title, t.description, t.content,
+            t."userId" = $1 OR COALESCE(wm.role IN ('owner', 'admin'), false)
+        FROM "NoteTemplate" t
+        LEFT JOIN "WorkspaceMember" wm ON wm."workspaceId" = t."workspaceId" AND wm."userId" = $1
+        WHERE (t."workspaceId" IS NULL AND t."userId" = $1)
+            OR (t."workspaceId" = $2 AND wm.role IN ('owner', 'admin', 'member'))
+        ORDER BY t."workspaceId" NULLS FIRST;
+    `
+	rows, err := db.Query(query, userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []models.Template
+	for rows.Next() {
+		var t models.Template
+		if err := rows.Scan(&t.ID, &t.Name, &t.WorkspaceID, &t.Title, &t.Desc, &t.Content, &t.CanDelete); err != nil {
+			return nil, err
+		}
+		if err := decrypt(db, at("NoteTemplate", t.ID), templateFields(&t.Name, &t.Title, &t.Desc, &t.Content)...); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Sealed names only sort once decrypted
+	sort.SliceStable(templates, func(i, j int) bool {
+		a, b := templates[i], templates[j]
+		if (a.WorkspaceID == 0) != (b.WorkspaceID == 0) {
+			return a.WorkspaceID == 0
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	return templates, nil
+}
+
+// SaveTemplate adds a template to the library, shared with the workspace when it has a
+// WorkspaceID. Guests may not add workspace templates.
+func SaveTemplate(userID int, t models.Template) (models.Template, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return t, err
+	}
+	defer db.Close()
+
+	var workspaceID sql.NullInt64
+	if t.WorkspaceID != 0 {
+		role, err := workspaceRole(db, t.WorkspaceID, userID)
+		if err != nil {
+			return t, err
+		}
+		if role == "" || role == models.WorkspaceGuest {
+			return t, ErrForbidden
+		}
+		workspaceID = sql.NullInt64{Int64: int64(t.WorkspaceID), Valid: true}
+	}
+
+	// Templates are often made from a note, so they are sealed like the notes of their scope
+	s, err := newSealer(db, userID, t.WorkspaceID)
+	if err != nil {
+		return t, err
+	}
+	if t.ID, err = nextID(db, "NoteTemplate"); err != nil {
+		return t, err
+	}
+	sealed := t
+	if err := s.sealAll(at("NoteTemplate", t.ID), templateFields(&sealed.Name, &sealed.Title, &sealed.Desc, &sealed.Content)...); err != nil {
+		return t, err
+	}
+	query := `
+        INSERT INTO "NoteTemplate" (id, name, "userId", "workspaceId", title, description, content)
+        VALUES ($1, $2, $3, $4, $5, $6, $7);
+    `
+	t.CanDelete = true
+	_, err = db.Exec(query, t.ID, sealed.Name, userID, workspaceID, sealed.Title, sealed.Desc, sealed.Content)
+	return t, err
+}
+
+// templateFields are the sealed columns of a template
+func templateFields(name, title, description, content *string) []field {
+	return []field{{"name", name}, {"title", title}, {"description", description}, {"content", content}}
+}
+
+// DeleteTemplate removes a template; its creator and the owners and admins of its workspace may
+func DeleteTemplate(id, userID int) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := `
+        DELETE FROM "NoteTemplate" t
+        WHERE t.id = $1 AND (t."userId" = $2 OR EXISTS (
+            SELECT 1 FROM "WorkspaceMember" wm
+            WHERE wm."workspaceId" = t."workspaceId" AND wm."userId" = $2 AND wm.role IN ('owner', 'admin')
+        ));
+    `
+	res, err := db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrForbidden
+	}
+	return nil
+}
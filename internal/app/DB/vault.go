@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+
+	"notion_ssh_app/internal/app/vault"
+)
+
+// Vault is what the server keeps of the passphrase sealing a user's private notes
+type Vault struct {
+	Salt  string
+	Check string
+}
+
+// FetchVault returns the user's vault, ok is false until they made a note private
+func FetchVault(userID int) (v Vault, ok bool, err error) {
+	db, err := OpenDB()
+	if err != nil {
+		return v, false, err
+	}
+	defer db.Close()
+
+	err = db.QueryRow(`SELECT salt, "check" FROM "PrivateVault" WHERE "userId" = $1`, userID).Scan(&v.Salt, &v.Check)
+	if err == sql.ErrNoRows {
+		return v, false, nil
+	}
+	return v, err == nil, err
+}
+
+// CreateVault stores the user's vault and returns the one stored, which is an older one when
+// another session created it first
+func CreateVault(userID int, v Vault) (Vault, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return v, err
+	}
+	defer db.Close()
+
+	query := `
+        INSERT INTO "PrivateVault" ("userId", salt, "check") VALUES ($1, $2, $3)
+        ON CONFLICT ("userId") DO UPDATE SET "userId" = EXCLUDED."userId"
+        RETURNING salt, "check";
+    `
+	err = db.QueryRow(query, userID, v.Salt, v.Check).Scan(&v.Salt, &v.Check)
+	return v, err
+}
+
+// backfillPrivate flags the notes saved before the private flag existed, which are private
+// when their content is sealed with a passphrase
+func backfillPrivate(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, content FROM "Note" WHERE "private" IS NULL`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var private []int
+	for rows.Next() {
+		var id int
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return err
+		}
+		if err := decrypt(db, at("Note", id), field{"content", &content}); err != nil {
+			return err
+		}
+		if vault.IsSealed(content) {
+			private = append(private, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, id := range private {
+		if _, err := db.Exec(`UPDATE "Note" SET "private" = true WHERE id = $1`, id); err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec(`UPDATE "Note" SET "private" = false WHERE "private" IS NULL`)
+	return err
+}
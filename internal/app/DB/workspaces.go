@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// Workspace is a team space along with the current user's role in it
+type Workspace struct {
+	ID   int
+	Name string
+	Role models.WorkspaceRole
+}
+
+// Member is a user belonging to a workspace
+type Member struct {
+	UserID int
+	Email  string
+	Role   models.WorkspaceRole
+}
+
+// workspaceRole returns the user's role in the workspace, empty when they are not a member
+func workspaceRole(db *sql.DB, workspaceID, userID int) (models.WorkspaceRole, error) {
+	var role string
+	query := `SELECT role FROM "WorkspaceMember" WHERE "workspaceId" = $1 AND "userId" = $2`
+	err := db.QueryRow(query, workspaceID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return models.WorkspaceRole(role), err
+}
+
+// FetchWorkspaces lists the workspaces the user belongs to
+func FetchWorkspaces(userID int) ([]Workspace, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+        SELECT w.id, w.name, m.role
+        FROM "Workspace" w JOIN "WorkspaceMember" m ON m."workspaceId" = w.id
+        WHERE m."userId" = $1
+        ORDER BY w.name;
+    `
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []Workspace
+	for rows.Next() {
+		var w Workspace
+		if err := rows.Scan(&w.ID, &w.Name, &w.Role); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, w)
+	}
+	return workspaces, rows.Err()
+}
+
+// CreateWorkspace creates a workspace owned by the user
+func CreateWorkspace(name string, userID int) (Workspace, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return Workspace{}, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Workspace{}, err
+	}
+	defer tx.Rollback()
+
+	w := Workspace{Name: name, Role: models.WorkspaceOwner}
+	if err := tx.QueryRow(`INSERT INTO "Workspace" (name) VALUES ($1) RETURNING id`, name).Scan(&w.ID); err != nil {
+		return Workspace{}, err
+	}
+	query := `INSERT INTO "WorkspaceMember" ("workspaceId", "userId", role) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(query, w.ID, userID, w.Role); err != nil {
+		return Workspace{}, err
+	}
+	return w, tx.Commit()
+}
+
+// SetWorkspaceMember adds the user registered under email to the workspace, or changes
+// their role. An empty role removes them. Owners and admins manage members, but only
+// owners may hand out or take away ownership and admin rights.
+func SetWorkspaceMember(workspaceID, actorID int, email string, role models.WorkspaceRole) error {
+	db, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	actorRole, err := workspaceRole(db, workspaceID, actorID)
+	if err != nil {
+		return err
+	}
+	if !actorRole.CanManage() {
+		return ErrForbidden
+	}
+
+	var userID int
+	err = db.QueryRow(`SELECT id FROM "User" WHERE email = $1`, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrUnknownUser
+	}
+	if err != nil {
+		return err
+	}
+	current, err := workspaceRole(db, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if actorRole != models.WorkspaceOwner && (role.CanManage() || current.CanManage()) {
+		return ErrForbidden
+	}
+
+	if role == "" {
+		_, err = db.Exec(`DELETE FROM "WorkspaceMember" WHERE "workspaceId" = $1 AND "userId" = $2`, workspaceID, userID)
+		return err
+	}
+	query := `
+        INSERT INTO "WorkspaceMember" ("workspaceId", "userId", role) VALUES ($1, $2, $3)
+        ON CONFLICT ("workspaceId", "userId") DO UPDATE SET role = EXCLUDED.role;
+    `
+	_, err = db.Exec(query, workspaceID, userID, role)
+	return err
+}
+
+// WorkspaceMembers lists the members of a workspace the user belongs to
+func WorkspaceMembers(workspaceID, userID int) ([]Member, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if role, err := workspaceRole(db, workspaceID, userID); err != nil || role == "" {
+		if err == nil {
+			err = ErrForbidden
+		}
+		return nil, err
+	}
+
+	query := `
+        SELECT u.id, u.email, m.role
+        FROM "WorkspaceMember" m JOIN "User" u ON u.id = m."userId"
+        WHERE m."workspaceId" = $1
+        ORDER BY u.email;
+    `
+	rows, err := db.Query(query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []Member
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(&member.UserID, &member.Email, &member.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
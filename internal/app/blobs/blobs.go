@@ -0,0 +1,128 @@
+// Package blobs keeps the contents of attachments out of the database, under random keys the
+// attachment rows point to. Store is all a backend has to provide; files on local disk are
+// the default.
+package blobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"notion_ssh_app/internal/app/db"
+)
+
+// defaultDir is where attachments are kept when BLOB_DIR is not set
+const defaultDir = "attachments"
+
+// ErrInvalidKey is returned for keys NewKey could not have made
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Store keeps the contents of attachments by key
+type Store interface {
+	// Put stores everything r reads under key and returns its size
+	Put(key string, r io.Reader) (int64, error)
+	// Open reads what was stored under key
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes what was stored under key, keys that are gone already are not an error
+	Delete(key string) error
+}
+
+// Default is the store attachments are kept in
+var Default Store = Local{Dir: dir()}
+
+// dir is where Local keeps attachments, set with BLOB_DIR
+func dir() string {
+	if dir := os.Getenv("BLOB_DIR"); dir != "" {
+		return dir
+	}
+	return defaultDir
+}
+
+// NewKey returns a random key for a new blob
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Local keeps blobs as files under Dir, spread over subdirectories named after the first
+// two characters of their key
+type Local struct {
+	Dir string
+}
+
+// path is where the blob of key is kept
+func (l Local) path(key string) (string, error) {
+	if len(key) < 3 {
+		return "", ErrInvalidKey
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.Dir, key[:2], key), nil
+}
+
+// Put writes r to a temporary file first, so a failed upload never leaves half a blob
+func (l Local) Put(key string, r io.Reader) (int64, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return n, err
+	}
+	if err := f.Close(); err != nil {
+		return n, err
+	}
+	return n, os.Rename(f.Name(), path)
+}
+
+func (l Local) Open(key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (l Local) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Purge deletes the blobs of attachments that are gone, whether they were deleted on their
+// own or along with their note or uploader
+func Purge() error {
+	keys, err := db.TrashedBlobs()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := Default.Delete(key); err != nil && !errors.Is(err, ErrInvalidKey) {
+			return err
+		}
+	}
+	return db.ForgetBlobs(keys)
+}
@@ -0,0 +1,191 @@
+package collab
+
+import (
+	"sync"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// Cursor is where a peer's cursor sits in a shared document, as a rune offset
+type Cursor struct {
+	PeerID int
+	Name   string
+	Color  lipgloss.Color
+	Offset int
+}
+
+// UpdateMsg carries the state of a shared document after someone edited it or moved their cursor
+type UpdateMsg struct {
+	NoteID  int
+	Rev     int
+	Text    string
+	Cursors []Cursor
+}
+
+// SavedMsg tells the peers of a document that it was stored under a new version
+type SavedMsg struct {
+	NoteID  int
+	Version int
+}
+
+// document is the server-side copy of a note being edited by several sessions.
+// Every op is applied here first, so the hub's text is the one all peers converge to.
+type document struct {
+	noteID  int
+	version int
+	text    []rune
+	base    int  // revision of the text the log starts from
+	log     []Op // log[i] turned revision base+i into base+i+1
+	cursors map[*Peer]int
+	dirty   bool // edited since it was last saved
+}
+
+// Hub holds the documents currently open in an editor
+type Hub struct {
+	mu   sync.Mutex
+	docs map[int]*document
+}
+
+var hub = &Hub{docs: map[int]*document{}}
+
+// Join opens the note for collaborative editing and returns the shared text and revision.
+// The first peer seeds the document, later peers pick up its current state.
+func Join(p *Peer, item models.ListItemViewModel, text string) (string, int) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	doc, ok := hub.docs[item.ID]
+	if !ok {
+		doc = &document{noteID: item.ID, version: item.Version, text: []rune(text), cursors: map[*Peer]int{}}
+		hub.docs[item.ID] = doc
+	} else if !doc.dirty && item.Version > doc.version {
+		// A newer save was loaded. Revisions carry on past the old log, so edits the other
+		// peers made against the old text are refused and the broadcast below resyncs them.
+		doc.base = doc.rev() + 1
+		doc.version, doc.text, doc.log = item.Version, []rune(text), nil
+		for other, offset := range doc.cursors {
+			doc.cursors[other] = min(offset, len(doc.text))
+		}
+	}
+	doc.cursors[p] = 0
+	hub.broadcast(doc, p)
+	return string(doc.text), doc.rev()
+}
+
+// rev is the revision of the document's current text
+func (d *document) rev() int {
+	return d.base + len(d.log)
+}
+
+// Edit applies an op the peer made against revision rev, along with its cursor
+// position afterwards, and returns the resulting shared text, revision and cursor.
+func Edit(p *Peer, noteID, rev int, op Op, cursor int) (string, int, int) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	doc, ok := hub.docs[noteID]
+	if !ok {
+		return "", 0, 0
+	}
+	// Edits against text replaced since cannot be transformed, the peer takes the current text
+	if rev < doc.base || rev > doc.rev() {
+		return string(doc.text), doc.rev(), min(doc.cursors[p], len(doc.text))
+	}
+	// Catch up with the ops the peer had not seen yet
+	for _, applied := range doc.log[rev-doc.base:] {
+		op = op.transform(applied)
+		cursor = transformIndex(cursor, applied, false)
+	}
+	if op.Pos+op.Del > len(doc.text) {
+		return string(doc.text), doc.rev(), min(cursor, len(doc.text))
+	}
+	doc.text = op.apply(doc.text)
+	doc.log = append(doc.log, op)
+	doc.dirty = true
+	for other, offset := range doc.cursors {
+		if other != p {
+			doc.cursors[other] = transformIndex(offset, op, false)
+		}
+	}
+	doc.cursors[p] = min(cursor, len(doc.text))
+	hub.broadcast(doc, p)
+	return string(doc.text), doc.rev(), doc.cursors[p]
+}
+
+// MoveCursor records where the peer's cursor is without changing the text
+func MoveCursor(p *Peer, noteID, cursor int) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	doc, ok := hub.docs[noteID]
+	if !ok || doc.cursors[p] == cursor {
+		return
+	}
+	doc.cursors[p] = min(cursor, len(doc.text))
+	hub.broadcast(doc, p)
+}
+
+// Saved records that a peer stored the shared text under version
+func Saved(p *Peer, noteID, version int) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	doc, ok := hub.docs[noteID]
+	if !ok {
+		return
+	}
+	doc.version = version
+	doc.dirty = false
+	for other := range doc.cursors {
+		if other != p {
+			other.Send(SavedMsg{NoteID: noteID, Version: version})
+		}
+	}
+}
+
+// Leave takes the peer out of the note's document. Edits nobody saved are
+// dropped with the document when the last peer leaves, only saving stores them.
+func Leave(p *Peer, noteID int) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.leave(p, noteID)
+}
+
+func (h *Hub) leaveAll(p *Peer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for noteID, doc := range h.docs {
+		if _, ok := doc.cursors[p]; ok {
+			h.leave(p, noteID)
+		}
+	}
+}
+
+func (h *Hub) leave(p *Peer, noteID int) {
+	doc, ok := h.docs[noteID]
+	if !ok {
+		return
+	}
+	delete(doc.cursors, p)
+	if len(doc.cursors) > 0 {
+		h.broadcast(doc, nil)
+		return
+	}
+	delete(h.docs, noteID)
+}
+
+// broadcast sends the document state to every peer but the one who caused the change
+func (h *Hub) broadcast(doc *document, from *Peer) {
+	msg := UpdateMsg{NoteID: doc.noteID, Rev: doc.rev(), Text: string(doc.text)}
+	for p, offset := range doc.cursors {
+		_, name := p.Identity()
+		msg.Cursors = append(msg.Cursors, Cursor{PeerID: p.ID, Name: name, Color: p.Color, Offset: offset})
+	}
+	for p := range doc.cursors {
+		if p != from {
+			p.Send(msg)
+		}
+	}
+}
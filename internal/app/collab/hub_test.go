@@ -0,0 +1,37 @@
+package collab
+
+import (
+	"testing"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+func TestEditAfterReload(t *testing.T) {
+	a, b := NewPeer(), NewPeer()
+	defer a.Close()
+	defer b.Close()
+	note := models.ListItemViewModel{ID: -1, Version: 1}
+
+	_, revA := Join(a, note, "hello world")
+	Edit(a, note.ID, revA, Op{Pos: 0, Ins: []rune(">")}, 1)
+	Saved(a, note.ID, 2)
+
+	// b loads a newer save than the one a is editing, which replaces the shared text
+	note.Version = 3
+	text, revB := Join(b, note, "fresh text")
+	if text != "fresh text" || revB <= revA+1 {
+		t.Fatalf("Join() = %q, %d, want the newer text at a revision past %d", text, revB, revA+1)
+	}
+
+	// a's edit was made against the old text and is refused rather than misplaced
+	text, rev, _ := Edit(a, note.ID, revA+1, Op{Pos: 7, Ins: []rune("!")}, 8)
+	if text != "fresh text" || rev != revB {
+		t.Errorf("stale Edit() = %q, %d, want %q, %d", text, rev, "fresh text", revB)
+	}
+
+	// Once resynced, a's edits apply again
+	text, _, _ = Edit(a, note.ID, rev, Op{Pos: 10, Ins: []rune("!")}, 11)
+	if text != "fresh text!" {
+		t.Errorf("Edit() = %q, want %q", text, "fresh text!")
+	}
+}
@@ -0,0 +1,61 @@
+package collab
+
+// Op replaces Del runes at Pos with Ins
+type Op struct {
+	Pos int
+	Del int
+	Ins []rune
+}
+
+// Diff describes the change from old to new as a single replacement,
+// which is all a keystroke or a paste can produce
+func Diff(old, new string) (Op, bool) {
+	a, b := []rune(old), []rune(new)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	op := Op{Pos: prefix, Del: len(a) - prefix - suffix, Ins: b[prefix : len(b)-suffix]}
+	return op, op.Del > 0 || len(op.Ins) > 0
+}
+
+// apply runs the op against text
+func (o Op) apply(text []rune) []rune {
+	out := make([]rune, 0, len(text)-o.Del+len(o.Ins))
+	out = append(out, text[:o.Pos]...)
+	out = append(out, o.Ins...)
+	return append(out, text[o.Pos+o.Del:]...)
+}
+
+// transform rewrites o so it applies after a, which was applied concurrently first
+func (o Op) transform(a Op) Op {
+	start := transformIndex(o.Pos, a, false)
+	end := transformIndex(o.Pos+o.Del, a, true)
+	if end < start {
+		end = start
+	}
+	return Op{Pos: start, Del: end - start, Ins: o.Ins}
+}
+
+// transformIndex maps a position in the text before a to the text after it.
+// Starts and cursors at a's position move past its insertion, ends stay before it.
+func transformIndex(p int, a Op, isEnd bool) int {
+	switch {
+	case p < a.Pos || (isEnd && p == a.Pos):
+		return p
+	case p == a.Pos:
+		return a.Pos + len(a.Ins)
+	case p < a.Pos+a.Del:
+		// Inside the range a deleted
+		if isEnd {
+			return a.Pos
+		}
+		return a.Pos + len(a.Ins)
+	default:
+		return p - a.Del + len(a.Ins)
+	}
+}
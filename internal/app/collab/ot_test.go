@@ -0,0 +1,94 @@
+package collab
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		old, new    string
+		want        Op
+		wantChanged bool
+	}{
+		{name: "unchanged", old: "abc", new: "abc", want: Op{Pos: 3, Ins: []rune{}}},
+		{name: "typed at the end", old: "ab", new: "abc", want: Op{Pos: 2, Ins: []rune("c")}, wantChanged: true},
+		{name: "typed in the middle", old: "ac", new: "abc", want: Op{Pos: 1, Ins: []rune("b")}, wantChanged: true},
+		{name: "deleted", old: "abc", new: "ac", want: Op{Pos: 1, Del: 1, Ins: []rune{}}, wantChanged: true},
+		{name: "replaced", old: "a cat", new: "a dog", want: Op{Pos: 2, Del: 3, Ins: []rune("dog")}, wantChanged: true},
+		{name: "repeated rune", old: "aa", new: "aaa", want: Op{Pos: 2, Ins: []rune("a")}, wantChanged: true},
+		{name: "multibyte runes", old: "héllo", new: "hélo", want: Op{Pos: 3, Del: 1, Ins: []rune{}}, wantChanged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := Diff(tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) || changed != tt.wantChanged {
+				t.Errorf("Diff(%q, %q) = %+v, %v, want %+v, %v", tt.old, tt.new, got, changed, tt.want, tt.wantChanged)
+			}
+			if applied := string(got.apply([]rune(tt.old))); applied != tt.new {
+				t.Errorf("applying the diff gives %q, want %q", applied, tt.new)
+			}
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		a, o Op // a is applied first, o concurrently against the same text
+		want string
+	}{
+		{
+			name: "insertions at different places",
+			text: "hello world",
+			a:    Op{Pos: 0, Ins: []rune(">")},
+			o:    Op{Pos: 11, Ins: []rune("!")},
+			want: ">hello world!",
+		},
+		{
+			name: "insertions at the same place keep the first one first",
+			text: "ac",
+			a:    Op{Pos: 1, Ins: []rune("x")},
+			o:    Op{Pos: 1, Ins: []rune("y")},
+			want: "axyc",
+		},
+		{
+			name: "insertion before a deletion",
+			text: "abcdef",
+			a:    Op{Pos: 0, Ins: []rune("__")},
+			o:    Op{Pos: 2, Del: 2},
+			want: "__abef",
+		},
+		{
+			name: "deletion before an insertion",
+			text: "abcdef",
+			a:    Op{Pos: 0, Del: 3},
+			o:    Op{Pos: 5, Ins: []rune("x")},
+			want: "dexf",
+		},
+		{
+			name: "overlapping deletions",
+			text: "abcdef",
+			a:    Op{Pos: 1, Del: 3},
+			o:    Op{Pos: 2, Del: 3},
+			want: "af",
+		},
+		{
+			name: "insertion inside a deleted range",
+			text: "abcdef",
+			a:    Op{Pos: 1, Del: 4},
+			o:    Op{Pos: 3, Ins: []rune("x")},
+			want: "axf",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(tt.o.transform(tt.a).apply(tt.a.apply([]rune(tt.text))))
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package collab
+
+import (
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Colors handed out to peers so remote cursors can be told apart
+var palette = []lipgloss.Color{"#F25D94", "#04B575", "#FFB454", "#3C9EFF", "#E88388", "#A4D65E", "#CC8BFF", "#4DD0E1"}
+
+// Peer is a single SSH session taking part in collaboration
+type Peer struct {
+	ID    int
+	Color lipgloss.Color
+
+	mu      sync.Mutex
+	userID  int    // 0 until the session logs in
+	name    string // shown to the other sessions
+	program *tea.Program
+}
+
+var (
+	peersMu    sync.Mutex
+	lastPeerID int
+)
+
+// NewPeer creates a peer with its own ID and cursor color
+func NewPeer() *Peer {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	lastPeerID++
+	return &Peer{ID: lastPeerID, Color: palette[(lastPeerID-1)%len(palette)]}
+}
+
+// SetProgram attaches the session's program, which receives the peer's messages
+func (p *Peer) SetProgram(program *tea.Program) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.program = program
+}
+
+// SetIdentity records who logged in with the session; other sessions read it concurrently
+func (p *Peer) SetIdentity(userID int, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.userID, p.name = userID, name
+}
+
+// Identity returns the user logged in with the session and the name shown to others
+func (p *Peer) Identity() (int, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.userID, p.name
+}
+
+// Send delivers msg to the peer's program without blocking the caller.
+// Messages may arrive out of order, so they carry enough state to be applied idempotently.
+func (p *Peer) Send(msg tea.Msg) {
+	p.mu.Lock()
+	program := p.program
+	p.mu.Unlock()
+	if program != nil {
+		go program.Send(msg)
+	}
+}
+
+// Close removes the peer from every document and presence list it is part of, once its session is over
+func (p *Peer) Close() {
+	hub.leaveAll(p)
+	forgetPresence(p)
+}
@@ -0,0 +1,102 @@
+package collab
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// PresenceMsg tells sessions that someone opened or closed a note, so badges get redrawn
+type PresenceMsg struct{}
+
+// Viewer is a peer looking at a note
+type Viewer struct {
+	PeerID   int
+	Name     string
+	Initials string
+	Color    lipgloss.Color
+}
+
+// presence tracks which note every connected session has open, 0 meaning none
+var presence = struct {
+	sync.Mutex
+	viewing map[*Peer]int
+}{viewing: map[*Peer]int{}}
+
+// SetViewing records the note the peer has open and lets every session know when it changed
+func SetViewing(p *Peer, noteID int) {
+	presence.Lock()
+	defer presence.Unlock()
+	if current, ok := presence.viewing[p]; ok && current == noteID {
+		return
+	}
+	presence.viewing[p] = noteID
+	broadcastPresence()
+}
+
+// Viewers lists the sessions that have the note open, oldest session first
+func Viewers(noteID int) []Viewer {
+	presence.Lock()
+	defer presence.Unlock()
+
+	var viewers []Viewer
+	for p, viewing := range presence.viewing {
+		if viewing == noteID && noteID != 0 {
+			_, name := p.Identity()
+			viewers = append(viewers, Viewer{PeerID: p.ID, Name: name, Initials: initials(name), Color: p.Color})
+		}
+	}
+	sort.Slice(viewers, func(i, j int) bool { return viewers[i].PeerID < viewers[j].PeerID })
+	return viewers
+}
+
+// forgetPresence drops a session whose connection is gone
+func forgetPresence(p *Peer) {
+	presence.Lock()
+	defer presence.Unlock()
+	if _, ok := presence.viewing[p]; ok {
+		delete(presence.viewing, p)
+		broadcastPresence()
+	}
+}
+
+func broadcastPresence() {
+	for p := range presence.viewing {
+		p.Send(PresenceMsg{})
+	}
+}
+
+// initials turns "jane.doe@example.com" into "JD"
+func initials(name string) string {
+	local, _, _ := strings.Cut(name, "@")
+	parts := strings.FieldsFunc(local, func(r rune) bool { return r == '.' || r == '_' || r == '-' || r == ' ' })
+	var out []rune
+	for _, part := range parts {
+		out = append(out, []rune(strings.ToUpper(part))[0])
+		if len(out) == 2 {
+			break
+		}
+	}
+	if len(out) == 0 {
+		return "?"
+	}
+	return string(out)
+}
+
+// SendToUser delivers msg to every session the user is logged in with, reporting whether
+// they had any
+func SendToUser(userID int, msg tea.Msg) bool {
+	presence.Lock()
+	defer presence.Unlock()
+	delivered := false
+	for p := range presence.viewing {
+		if id, _ := p.Identity(); id == userID {
+			p.Send(msg)
+			delivered = true
+		}
+	}
+	return delivered
+}
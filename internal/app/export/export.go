@@ -0,0 +1,153 @@
+// Package export bundles a user's notes as markdown files with YAML front-matter
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+)
+
+// Filename is what exported archives are saved as
+const Filename = "notes.zip"
+
+// personalDir holds the notes outside of any workspace
+const personalDir = "Personal"
+
+// dailyDir holds the daily notes within personalDir
+const dailyDir = "Daily"
+
+// Zip writes the user's notes to w as a zip archive, one directory per workspace and a
+// subdirectory per database
+func Zip(w io.Writer, userID int) error {
+	notes, err := db.ExportNotes(userID)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	paths := Paths(notes)
+	for _, n := range notes {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: paths[n.ID], Method: zip.Deflate, Modified: n.UpdatedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, Markdown(n)); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Paths lays the notes out the way Zip archives them, keyed by note ID
+func Paths(notes []db.ExportedNote) map[int]string {
+	used := map[string]bool{}
+	paths := map[int]string{}
+	for _, n := range notes {
+		paths[n.ID] = NotePath(n, used)
+	}
+	return paths
+}
+
+// NotePath places a note in the archive, numbering notes whose titles collide with the
+// lowercased paths in used, which the path returned is added to
+func NotePath(n db.ExportedNote, used map[string]bool) string {
+	dir := personalDir
+	if n.Workspace != "" {
+		dir = models.FileName(n.Workspace)
+	}
+	switch {
+	case !n.Daily.IsZero():
+		dir = path.Join(dir, dailyDir)
+	case n.Collection != "":
+		dir = path.Join(dir, models.FileName(n.Collection))
+	}
+
+	base := models.FileName(n.ItemTitle)
+	if n.Locked() {
+		// Sealed titles would make for unreadable file names
+		base = models.FileName("Private note")
+	}
+	name := path.Join(dir, base+".md")
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		name = path.Join(dir, fmt.Sprintf("%s (%d).md", base, i))
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// Markdown renders a note as markdown with its metadata in YAML front-matter
+func Markdown(n db.ExportedNote) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	field(&b, "title", n.ItemTitle)
+	if n.Desc != "" {
+		field(&b, "description", n.Desc)
+	}
+	if tags := tags(n.Properties); len(tags) > 0 {
+		b.WriteString("tags:\n")
+		for _, tag := range tags {
+			b.WriteString("  - " + quote(tag) + "\n")
+		}
+	}
+	if n.Workspace != "" {
+		field(&b, "workspace", n.Workspace)
+	}
+	if n.Collection != "" {
+		field(&b, "database", n.Collection)
+	}
+	if !n.Daily.IsZero() {
+		field(&b, "daily", n.Daily.Format(models.DateLayout))
+	}
+	if !n.Due.IsZero() {
+		field(&b, "due", n.Due.Format(models.DateLayout))
+	}
+	field(&b, "created", n.CreatedAt.UTC().Format(time.RFC3339))
+	field(&b, "updated", n.UpdatedAt.UTC().Format(time.RFC3339))
+	if n.Locked() {
+		// Only the app can open private notes, with their owner's passphrase
+		b.WriteString("private: true\n")
+	}
+	if len(n.Properties) > 0 {
+		b.WriteString("properties:\n")
+		for _, p := range n.Properties {
+			b.WriteString("  " + quote(p.Name) + ": " + quote(p.Value) + "\n")
+		}
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(n.Content)
+	if !strings.HasSuffix(n.Content, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// tags are the values of a page's select and multi-select properties
+func tags(properties []db.ExportedProperty) []string {
+	var tags []string
+	for _, p := range properties {
+		if p.Type == models.PropertySelect || p.Type == models.PropertyMultiSelect {
+			tags = append(tags, models.SplitList(p.Value)...)
+		}
+	}
+	return tags
+}
+
+func field(b *strings.Builder, key, value string) {
+	b.WriteString(key + ": " + quote(value) + "\n")
+}
+
+// quote writes a string as a double-quoted scalar, JSON strings being valid YAML
+func quote(s string) string {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"testing"
+	"time"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+)
+
+func TestMarkdown(t *testing.T) {
+	created := time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC)
+	updated := time.Date(2026, 10, 2, 18, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	tests := []struct {
+		name string
+		note db.ExportedNote
+		want string
+	}{
+		{
+			name: "personal note",
+			note: db.ExportedNote{
+				ListItemViewModel: models.ListItemViewModel{ItemTitle: "Groceries", Content: "- [ ] milk"},
+				CreatedAt:         created, UpdatedAt: updated,
+			},
+			want: "---\ntitle: \"Groceries\"\ncreated: \"2026-10-01T09:30:00Z\"\nupdated: \"2026-10-02T16:00:00Z\"\n---\n\n- [ ] milk\n",
+		},
+		{
+			name: "database page with quoting",
+			note: db.ExportedNote{
+				ListItemViewModel: models.ListItemViewModel{
+					ItemTitle: `Say "hi"`, Desc: "a: b", Content: "body\n",
+					Due: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+				},
+				Workspace: "Team", Collection: "Tasks", CreatedAt: created, UpdatedAt: created,
+				Properties: []db.ExportedProperty{
+					{Name: "Tags", Type: models.PropertyMultiSelect, Value: "bug, ui"},
+					{Name: "Status", Type: models.PropertySelect, Value: "Done"},
+					{Name: "Estimate", Type: models.PropertyNumber, Value: "3"},
+				},
+			},
+			want: "---\ntitle: \"Say \\\"hi\\\"\"\ndescription: \"a: b\"\ntags:\n  - \"bug\"\n  - \"ui\"\n  - \"Done\"\n" +
+				"workspace: \"Team\"\ndatabase: \"Tasks\"\ndue: \"2026-11-01\"\ncreated: \"2026-10-01T09:30:00Z\"\n" +
+				"updated: \"2026-10-01T09:30:00Z\"\nproperties:\n  \"Tags\": \"bug, ui\"\n  \"Status\": \"Done\"\n  \"Estimate\": \"3\"\n---\n\nbody\n",
+		},
+		{
+			name: "daily note",
+			note: db.ExportedNote{
+				ListItemViewModel: models.ListItemViewModel{ItemTitle: "2026-10-19", Daily: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+				CreatedAt:         created, UpdatedAt: created,
+			},
+			want: "---\ntitle: \"2026-10-19\"\ndaily: \"2026-10-19\"\ncreated: \"2026-10-01T09:30:00Z\"\nupdated: \"2026-10-01T09:30:00Z\"\n---\n\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Markdown(tt.note); got != tt.want {
+				t.Errorf("Markdown() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaths(t *testing.T) {
+	notes := []db.ExportedNote{
+		{ListItemViewModel: models.ListItemViewModel{ID: 1, ItemTitle: "Plan"}},
+		{ListItemViewModel: models.ListItemViewModel{ID: 2, ItemTitle: "plan"}},
+		{ListItemViewModel: models.ListItemViewModel{ID: 3, ItemTitle: "Plan"}, Workspace: "Team", Collection: "Tasks"},
+		{ListItemViewModel: models.ListItemViewModel{ID: 4, ItemTitle: "2026-10-19", Daily: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)}},
+	}
+	want := map[int]string{1: "Personal/Plan.md", 2: "Personal/plan (2).md", 3: "Team/Tasks/Plan.md", 4: "Personal/Daily/2026-10-19.md"}
+	got := Paths(notes)
+	for id, path := range want {
+		if got[id] != path {
+			t.Errorf("Paths()[%d] = %q, want %q", id, got[id], path)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Package gitstore mirrors each user's notes into a bare git repository of their own, one
+// commit per save, which they can clone over ssh to get their notes with their history.
+// Commits are made in the background; when they fail the user is told in their inbox and
+// the next full sync, like the one every clone runs, catches the repository up.
+package gitstore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/export"
+	"notion_ssh_app/internal/app/notify"
+)
+
+// Branch is the branch the notes are committed to
+const Branch = "main"
+
+// RepoName is the path users clone, whatever their account
+const RepoName = "notes.git"
+
+// locks serialises the writes to each user's repository
+var locks sync.Map
+
+// Dir is where the repositories live, set with GIT_STORAGE_DIR; git storage is off when empty
+func Dir() string {
+	return os.Getenv("GIT_STORAGE_DIR")
+}
+
+// Enabled reports whether notes are mirrored into git. The repositories hold the notes in
+// plaintext, so they are not written when notes are encrypted at rest.
+func Enabled() bool {
+	if Dir() == "" {
+		return false
+	}
+	encrypted, err := db.EncryptionEnabled()
+	return !encrypted && err == nil
+}
+
+// RepoPath is the bare repository holding the user's notes
+func RepoPath(userID int) string {
+	return filepath.Join(Dir(), fmt.Sprintf("%d.git", userID))
+}
+
+// indexPath is the file of each repository listing the path of every note, one "<id> <path>"
+// per line, so that a save rewrites only the note saved
+const indexPath = ".notes"
+
+// failing holds why the last commit to a user's repository failed, until one succeeds
+var failing sync.Map
+
+// NoteSaved commits the note to its owner's repository in the background after authorID saved it
+func NoteSaved(noteID, authorID int, message string) {
+	if !Enabled() {
+		return
+	}
+	go func() {
+		ownerID, err := db.NoteOwner(noteID)
+		if err != nil {
+			fmt.Println("Error fetching note owner:", err)
+			return
+		}
+		// After a failure the repository may miss other notes too, so all are committed
+		if LastError(ownerID) != nil {
+			report(ownerID, Sync(ownerID, authorID, message))
+			return
+		}
+		report(ownerID, commitNote(ownerID, authorID, noteID, message))
+	}()
+}
+
+// Changed commits all of the user's notes in the background after authorID changed many at once
+func Changed(userID, authorID int, message string) {
+	if !Enabled() {
+		return
+	}
+	go func() {
+		report(userID, Sync(userID, authorID, message))
+	}()
+}
+
+// LastError returns why the user's repository is behind their notes, nil when it is not
+func LastError(userID int) error {
+	if err, ok := failing.Load(userID); ok {
+		return err.(error)
+	}
+	return nil
+}
+
+// report records the outcome of a commit to the user's repository, telling them in their
+// inbox when it starts failing
+func report(userID int, err error) {
+	if err == nil {
+		failing.Delete(userID)
+		return
+	}
+	fmt.Println("Error committing notes to git:", err)
+	if _, told := failing.Swap(userID, err); !told {
+		notify.Send(db.Notification{
+			UserID: userID,
+			Kind:   notify.KindGit,
+			Body:   "Your notes could not be committed to git, clones miss the latest saves: " + err.Error(),
+		})
+	}
+}
+
+// Sync creates the user's repository when missing and commits all of their notes as authorID
+// when they differ from the last commit, deleting the ones gone since
+func Sync(userID, authorID int, message string) error {
+	lock, _ := locks.LoadOrStore(userID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	return syncAll(userID, authorID, message)
+}
+
+// syncAll is Sync with the user's repository locked
+func syncAll(userID, authorID int, message string) error {
+	repo, err := openRepo(userID)
+	if err != nil {
+		return err
+	}
+	notes, err := db.ExportNotes(userID)
+	if err != nil {
+		return err
+	}
+	paths := export.Paths(notes)
+	return commit(repo, authorID, message, func(stream *bytes.Buffer) {
+		stream.WriteString("deleteall\n")
+		for _, n := range notes {
+			fmt.Fprintf(stream, "M 100644 inline %s\n", paths[n.ID])
+			writeData(stream, export.Markdown(n))
+		}
+		writeIndex(stream, paths)
+	})
+}
+
+// commitNote commits a single note of the user's, moving its file when its title or place
+// changed. The first commit of a repository holds all of the user's notes.
+func commitNote(userID, authorID, noteID int, message string) error {
+	lock, _ := locks.LoadOrStore(userID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	repo, err := openRepo(userID)
+	if err != nil {
+		return err
+	}
+	index, ok, err := readIndex(repo)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return syncAll(userID, authorID, message)
+	}
+	n, err := db.ExportNote(noteID)
+	if err != nil {
+		return err
+	}
+
+	old := index[noteID]
+	used := map[string]bool{}
+	for id, path := range index {
+		if id != noteID {
+			used[strings.ToLower(path)] = true
+		}
+	}
+	path := export.NotePath(n, used)
+	if old != "" && keeps(old, export.NotePath(n, map[string]bool{})) && !used[strings.ToLower(old)] {
+		path = old
+	}
+	index[noteID] = path
+	return commit(repo, authorID, message, func(stream *bytes.Buffer) {
+		if old != "" && old != path {
+			fmt.Fprintf(stream, "D %s\n", old)
+		}
+		fmt.Fprintf(stream, "M 100644 inline %s\n", path)
+		writeData(stream, export.Markdown(n))
+		writeIndex(stream, index)
+	})
+}
+
+// keeps reports whether a note placed at fresh may stay at old, which differs at most by the
+// number telling apart notes of the same title
+func keeps(old, fresh string) bool {
+	if old == fresh {
+		return true
+	}
+	rest, ok := strings.CutPrefix(old, strings.TrimSuffix(fresh, ".md")+" (")
+	if !ok || !strings.HasSuffix(rest, ").md") {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimSuffix(rest, ").md"))
+	return err == nil
+}
+
+// openRepo returns the user's repository, creating it when missing
+func openRepo(userID int) (string, error) {
+	repo := RepoPath(userID)
+	if _, err := os.Stat(repo); os.IsNotExist(err) {
+		if err := os.MkdirAll(Dir(), 0o700); err != nil {
+			return "", err
+		}
+		if _, err := git("", "init", "--quiet", "--bare", "--initial-branch="+Branch, repo); err != nil {
+			return "", err
+		}
+	}
+	return repo, nil
+}
+
+// readIndex reads the paths of the notes in the last commit; ok is false when there is no
+// commit yet, or it was made before the index was
+func readIndex(repo string) (index map[int]string, ok bool, err error) {
+	if parent, _ := git(repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+Branch); parent == "" {
+		return nil, false, nil
+	}
+	out, err := exec.Command("git", "--git-dir="+repo, "cat-file", "-p", Branch+":"+indexPath).Output()
+	if err != nil {
+		return nil, false, nil
+	}
+	index = map[int]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		id, path, found := strings.Cut(line, " ")
+		noteID, err := strconv.Atoi(id)
+		if !found || err != nil {
+			continue
+		}
+		index[noteID] = path
+	}
+	return index, true, nil
+}
+
+// writeIndex writes the index of the notes' paths to a fast-import stream
+func writeIndex(stream *bytes.Buffer, paths map[int]string) {
+	ids := make([]int, 0, len(paths))
+	for id := range paths {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	var index strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&index, "%d %s\n", id, paths[id])
+	}
+	fmt.Fprintf(stream, "M 100644 inline %s\n", indexPath)
+	writeData(stream, index.String())
+}
+
+// commit makes a commit as authorID on top of the branch with the changes files writes
+func commit(repo string, authorID int, message string, files func(*bytes.Buffer)) error {
+	email, err := db.UserEmail(authorID)
+	if err != nil {
+		return err
+	}
+	parent, _ := git(repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+Branch)
+
+	// fast-import writes the tree without a work tree
+	var stream bytes.Buffer
+	signature := fmt.Sprintf("%s <%s> %d +0000", identity(strings.SplitN(email, "@", 2)[0]), identity(email), time.Now().Unix())
+	fmt.Fprintf(&stream, "commit refs/heads/%s\nauthor %s\ncommitter %s\n", Branch, signature, signature)
+	writeData(&stream, message+"\n")
+	if parent != "" {
+		fmt.Fprintf(&stream, "from %s\n", parent)
+	}
+	files(&stream)
+	stream.WriteString("\n")
+
+	cmd := exec.Command("git", "--git-dir="+repo, "fast-import", "--quiet", "--date-format=raw")
+	cmd.Stdin = &stream
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git fast-import: %v: %s", err, out)
+	}
+
+	// Saves that changed nothing in markdown, like reordering, leave no empty commits behind
+	if parent != "" {
+		trees, err := git(repo, "rev-parse", Branch+"^{tree}", parent+"^{tree}")
+		if err != nil {
+			return err
+		}
+		if t := strings.Fields(trees); len(t) == 2 && t[0] == t[1] {
+			_, err = git(repo, "update-ref", "refs/heads/"+Branch, parent)
+			return err
+		}
+	}
+	return nil
+}
+
+// writeData appends a fast-import data block
+func writeData(stream *bytes.Buffer, data string) {
+	fmt.Fprintf(stream, "data %d\n%s\n", len(data), data)
+}
+
+// identity strips what git does not allow in a name or email
+func identity(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '<' || r == '>' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// git runs a git command against repo, or none when empty, and returns its trimmed output
+func git(repo string, args ...string) (string, error) {
+	name := args[0]
+	if repo != "" {
+		args = append([]string{"--git-dir=" + repo}, args...)
+	}
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
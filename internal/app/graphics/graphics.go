@@ -0,0 +1,254 @@
+// Package graphics draws images in a terminal, with the kitty graphics protocol, sixel or,
+// where neither is known to work, coloured half blocks. What a terminal supports is guessed
+// from what its ssh session tells, and everything is kept small since it goes over ssh.
+package graphics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // decoders of the formats attachments are read in
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+)
+
+// Limits on what is decoded and sent, images past them are left as text
+const (
+	MaxImageBytes  = 10 << 20   // size of an attachment decoded for preview
+	MaxImagePixels = 25_000_000 // width times height of an attachment decoded for preview
+	MaxSixelBytes  = 256 << 10  // sixel data drawn for one image, sent again whenever it is redrawn
+	MaxKittyBytes  = 512 << 10  // PNG sent once for one image
+)
+
+// ErrTooLarge is returned for images past MaxImageBytes or MaxImagePixels
+var ErrTooLarge = errors.New("the image is too large to preview")
+
+// ErrOff is returned when drawing for terminals that do not show images
+var ErrOff = errors.New("images are off")
+
+// Protocol is how images are drawn
+type Protocol int
+
+const (
+	Off Protocol = iota
+	HalfBlocks
+	Sixel
+	Kitty
+)
+
+// protocolNames are how protocols are named in NOTES_IMAGES
+var protocolNames = map[Protocol]string{Off: "off", HalfBlocks: "blocks", Sixel: "sixel", Kitty: "kitty"}
+
+func (p Protocol) String() string {
+	return protocolNames[p]
+}
+
+// ParseProtocol reads a protocol by name, as NOTES_IMAGES sets it
+func ParseProtocol(name string) (Protocol, bool) {
+	for p, n := range protocolNames {
+		if strings.EqualFold(n, strings.TrimSpace(name)) {
+			return p, true
+		}
+	}
+	return Off, false
+}
+
+// Caps is what a terminal can draw
+type Caps struct {
+	Protocol   Protocol
+	TrueColor  bool
+	CellWidth  int // size of a character cell in pixels
+	CellHeight int
+}
+
+// Detect guesses what a terminal draws from its TERM and the environment its ssh client sent.
+// Since TERM rarely tells, users can pick with `ssh -o SetEnv=NOTES_IMAGES=sixel`, or kitty,
+// blocks or off.
+func Detect(term string, env []string) Caps {
+	term = strings.ToLower(term)
+	caps := Caps{Protocol: HalfBlocks, CellWidth: 10, CellHeight: 20}
+	switch {
+	case term == "" || term == "dumb" || term == "linux":
+		caps.Protocol = Off
+	case strings.Contains(term, "kitty") || strings.Contains(term, "ghostty"):
+		caps.Protocol = Kitty
+		caps.TrueColor = true
+	case strings.Contains(term, "sixel") || strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") ||
+		strings.HasPrefix(term, "contour") || strings.HasPrefix(term, "yaft"):
+		caps.Protocol = Sixel
+		caps.TrueColor = true
+	case strings.Contains(term, "direct") || strings.Contains(term, "wezterm"):
+		caps.TrueColor = true
+	}
+
+	for _, e := range env {
+		name, value, _ := strings.Cut(e, "=")
+		switch name {
+		case "NOTES_IMAGES":
+			if p, ok := ParseProtocol(value); ok {
+				caps.Protocol = p
+			}
+		case "COLORTERM":
+			if value == "truecolor" || value == "24bit" {
+				caps.TrueColor = true
+			}
+		}
+	}
+	return caps
+}
+
+// Picture is an image laid out in a box of character cells
+type Picture struct {
+	Cols, Rows int
+	Lines      []string // Rows lines of Cols cells, the image itself unless Overlay is set
+	Overlay    string   // drawn from the top left of Lines over them, for sixel
+	Transmit   string   // sent to the terminal once, before Lines can show the image
+}
+
+// Decode reads an image, refusing ones past the preview limits before decoding them
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageBytes {
+		return nil, ErrTooLarge
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxImagePixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Draw lays an image out in at most maxCols by maxRows cells, never enlarging it. id tells
+// the images of a session apart with kitty and must be between 1 and 255. Images whose
+// sixel or kitty data would be past the limits are drawn with half blocks instead.
+func Draw(img image.Image, caps Caps, id, maxCols, maxRows int) (Picture, error) {
+	if caps.CellWidth <= 0 || caps.CellHeight <= 0 {
+		caps.CellWidth, caps.CellHeight = 10, 20
+	}
+	switch caps.Protocol {
+	case Kitty:
+		if p, err := drawKitty(img, caps, id, maxCols, maxRows); err != ErrTooLarge {
+			return p, err
+		}
+	case Sixel:
+		if p := drawSixel(img, caps, maxCols, maxRows); len(p.Overlay) <= MaxSixelBytes {
+			return p, nil
+		}
+	case Off:
+		return Picture{}, ErrOff
+	}
+	return drawHalfBlocks(img, caps, maxCols, maxRows), nil
+}
+
+// fit returns the size in pixels an image is scaled to and the cells that takes, with cells
+// of cellWidth by cellHeight pixels
+func fit(bounds image.Rectangle, cellWidth, cellHeight, maxCols, maxRows int) (w, h, cols, rows int) {
+	w, h = max(bounds.Dx(), 1), max(bounds.Dy(), 1)
+	factor := min(1, float64(maxCols*cellWidth)/float64(w), float64(maxRows*cellHeight)/float64(h))
+	w, h = max(int(float64(w)*factor), 1), max(int(float64(h)*factor), 1)
+	cols = min((w+cellWidth-1)/cellWidth, maxCols)
+	rows = min((h+cellHeight-1)/cellHeight, maxRows)
+	return w, h, cols, rows
+}
+
+// scale resizes an image by averaging the pixels each new pixel covers, sampling at most
+// 8 by 8 of them
+func scale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(b.Min.X+(x+1)*b.Dx()/w, x0+1)
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy += max((y1-y0)/8, 1) {
+				for sx := x0; sx < x1; sx += max((x1-x0)/8, 1) {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+pr>>8, g+pg>>8, bl+pb>>8, a+pa>>8, n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+// cubeLevels are the channel values of the 6x6x6 colour cube of 256 colour terminals
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// cubeIndex returns the level of the colour cube closest to a channel value
+func cubeIndex(v uint8) int {
+	best := 0
+	for i, level := range cubeLevels {
+		if abs(int(v)-level) < abs(int(v)-cubeLevels[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// sgrColor sets the foreground (38) or background (48) to c
+func sgrColor(layer int, c color.RGBA, trueColor bool) string {
+	if trueColor {
+		return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", layer, c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("\x1b[%d;5;%dm", layer, 16+36*cubeIndex(c.R)+6*cubeIndex(c.G)+cubeIndex(c.B))
+}
+
+// drawHalfBlocks draws two pixels per cell, the upper one in the foreground colour of ▀ and
+// the lower one in its background. Transparent pixels show the terminal's background.
+func drawHalfBlocks(img image.Image, caps Caps, maxCols, maxRows int) Picture {
+	w, h, cols, rows := fit(img.Bounds(), 1, 2, maxCols, maxRows)
+	pixels := scale(img, w, h)
+
+	p := Picture{Cols: cols, Rows: rows}
+	for row := 0; row < rows; row++ {
+		var line strings.Builder
+		for x := 0; x < cols; x++ {
+			// Past the last row, the lower pixel is transparent
+			top, bottom := pixels.RGBAAt(x, row*2), pixels.RGBAAt(x, row*2+1)
+			switch {
+			case top.A < 128 && bottom.A < 128:
+				line.WriteString("\x1b[0m ")
+			case bottom.A < 128:
+				line.WriteString("\x1b[0m" + sgrColor(38, top, caps.TrueColor) + "▀")
+			case top.A < 128:
+				line.WriteString("\x1b[0m" + sgrColor(38, bottom, caps.TrueColor) + "▄")
+			default:
+				line.WriteString(sgrColor(38, top, caps.TrueColor) + sgrColor(48, bottom, caps.TrueColor) + "▀")
+			}
+		}
+		line.WriteString("\x1b[0m")
+		p.Lines = append(p.Lines, line.String())
+	}
+	return p
+}
+
+// blankLines are rows lines of cols spaces, for images drawn over them
+func blankLines(cols, rows int) []string {
+	lines := make([]string, rows)
+	for i := range lines {
+		lines[i] = strings.Repeat(" ", cols)
+	}
+	return lines
+}
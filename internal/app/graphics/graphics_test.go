@@ -0,0 +1,37 @@
+package graphics
+
+import (
+	"image"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name                       string
+		width, height              int
+		cellWidth, cellHeight      int
+		maxCols, maxRows           int
+		wantW, wantH, wantC, wantR int
+	}{
+		{name: "small images keep their size", width: 40, height: 20, cellWidth: 10, cellHeight: 20, maxCols: 80, maxRows: 20,
+			wantW: 40, wantH: 20, wantC: 4, wantR: 1},
+		{name: "partly covered cells count", width: 41, height: 21, cellWidth: 10, cellHeight: 20, maxCols: 80, maxRows: 20,
+			wantW: 41, wantH: 21, wantC: 5, wantR: 2},
+		{name: "wide images shrink to the columns", width: 1600, height: 400, cellWidth: 10, cellHeight: 20, maxCols: 80, maxRows: 20,
+			wantW: 800, wantH: 200, wantC: 80, wantR: 10},
+		{name: "tall images shrink to the rows", width: 200, height: 1600, cellWidth: 10, cellHeight: 20, maxCols: 80, maxRows: 20,
+			wantW: 50, wantH: 400, wantC: 5, wantR: 20},
+		{name: "empty images take a pixel", width: 0, height: 0, cellWidth: 10, cellHeight: 20, maxCols: 80, maxRows: 20,
+			wantW: 1, wantH: 1, wantC: 1, wantR: 1},
+		{name: "slivers keep a pixel", width: 10000, height: 1, cellWidth: 10, cellHeight: 20, maxCols: 10, maxRows: 10,
+			wantW: 100, wantH: 1, wantC: 10, wantR: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, cols, rows := fit(image.Rect(0, 0, tt.width, tt.height), tt.cellWidth, tt.cellHeight, tt.maxCols, tt.maxRows)
+			if w != tt.wantW || h != tt.wantH || cols != tt.wantC || rows != tt.wantR {
+				t.Errorf("fit() = %d, %d, %d, %d, want %d, %d, %d, %d", w, h, cols, rows, tt.wantW, tt.wantH, tt.wantC, tt.wantR)
+			}
+		})
+	}
+}
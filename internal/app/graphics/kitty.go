@@ -0,0 +1,62 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+)
+
+// kittyChunk is the most base64 the kitty protocol takes in one escape sequence
+const kittyChunk = 4096
+
+// placeholder is the character kitty replaces with a part of the image its colour names
+const placeholder = "\U0010EEEE"
+
+// diacritics number the rows and columns of placeholders, as listed by kitty's
+// rowcolumn-diacritics.txt; pictures are never taller than this
+var diacritics = []rune{
+	0x0305, 0x030D, 0x030E, 0x0310, 0x0312, 0x033D, 0x033E, 0x033F,
+	0x0346, 0x034A, 0x034B, 0x034C, 0x0350, 0x0351, 0x0352, 0x0357,
+	0x035B, 0x0363, 0x0364, 0x0365, 0x0366, 0x0367, 0x0368, 0x0369,
+	0x036A, 0x036B, 0x036C, 0x036D, 0x036E, 0x036F, 0x0483, 0x0484,
+}
+
+// drawKitty sends the image as PNG with a virtual placement, shown wherever its placeholder
+// characters are written. Being text, they scroll and redraw like the rest of the note.
+func drawKitty(img image.Image, caps Caps, id, maxCols, maxRows int) (Picture, error) {
+	maxRows = min(maxRows, len(diacritics))
+	w, h, cols, rows := fit(img.Bounds(), caps.CellWidth, caps.CellHeight, maxCols, maxRows)
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, scale(img, w, h)); err != nil {
+		return Picture{}, err
+	}
+	if encoded.Len() > MaxKittyBytes {
+		return Picture{}, ErrTooLarge
+	}
+
+	data := base64.StdEncoding.EncodeToString(encoded.Bytes())
+	var transmit strings.Builder
+	for i := 0; i < len(data); i += kittyChunk {
+		chunk := data[i:min(i+kittyChunk, len(data))]
+		more := 0
+		if i+kittyChunk < len(data) {
+			more = 1
+		}
+		if i == 0 {
+			fmt.Fprintf(&transmit, "\x1b_Ga=T,U=1,f=100,q=2,i=%d,c=%d,r=%d,m=%d;%s\x1b\\", id, cols, rows, more, chunk)
+		} else {
+			fmt.Fprintf(&transmit, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+
+	// The first cell of a row names its row and column, the cells after it follow on
+	p := Picture{Cols: cols, Rows: rows, Transmit: transmit.String()}
+	for row := 0; row < rows; row++ {
+		p.Lines = append(p.Lines, fmt.Sprintf("\x1b[38;5;%dm", id)+placeholder+string(diacritics[row])+string(diacritics[0])+
+			strings.Repeat(placeholder, cols-1)+"\x1b[39m")
+	}
+	return p, nil
+}
@@ -0,0 +1,91 @@
+package graphics
+
+import (
+	"image"
+	"strconv"
+	"strings"
+)
+
+// drawSixel encodes an image as sixel with the 216 colours of the 6x6x6 cube, leaving
+// transparent pixels as they are
+func drawSixel(img image.Image, caps Caps, maxCols, maxRows int) Picture {
+	w, h, cols, rows := fit(img.Bounds(), caps.CellWidth, caps.CellHeight, maxCols, maxRows)
+	pixels := scale(img, w, h)
+
+	// Colour register of each pixel, -1 for transparent ones
+	registers := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := pixels.RGBAAt(x, y)
+			registers[y*w+x] = -1
+			if c.A >= 128 {
+				registers[y*w+x] = 36*cubeIndex(c.R) + 6*cubeIndex(c.G) + cubeIndex(c.B)
+			}
+		}
+	}
+
+	var b strings.Builder
+	// Transparent background, square pixels, then the palette
+	b.WriteString("\x1bP0;1;0q\"1;1;" + strconv.Itoa(w) + ";" + strconv.Itoa(h))
+	for i := 0; i < 216; i++ {
+		b.WriteString("#" + strconv.Itoa(i) + ";2;" +
+			strconv.Itoa(cubeLevels[i/36]*100/255) + ";" +
+			strconv.Itoa(cubeLevels[i/6%6]*100/255) + ";" +
+			strconv.Itoa(cubeLevels[i%6]*100/255))
+	}
+
+	// Each band of six rows is painted once per colour it uses
+	band := make([]byte, w)
+	for y0 := 0; y0 < h; y0 += 6 {
+		used := map[int]bool{}
+		for y := y0; y < min(y0+6, h); y++ {
+			for x := 0; x < w; x++ {
+				if r := registers[y*w+x]; r >= 0 {
+					used[r] = true
+				}
+			}
+		}
+		first := true
+		for register := 0; register < 216; register++ {
+			if !used[register] {
+				continue
+			}
+			for x := range band {
+				var bits byte
+				for k := 0; k < 6 && y0+k < h; k++ {
+					if registers[(y0+k)*w+x] == register {
+						bits |= 1 << k
+					}
+				}
+				band[x] = '?' + bits
+			}
+			if !first {
+				b.WriteByte('$')
+			}
+			first = false
+			b.WriteString("#" + strconv.Itoa(register))
+			writeSixelRuns(&b, strings.TrimRight(string(band), "?"))
+		}
+		b.WriteByte('-')
+	}
+	b.WriteString("\x1b\\")
+
+	return Picture{Cols: cols, Rows: rows, Lines: blankLines(cols, rows), Overlay: b.String()}
+}
+
+// writeSixelRuns writes sixels, repeating runs of the same one with !
+func writeSixelRuns(b *strings.Builder, sixels string) {
+	for i := 0; i < len(sixels); {
+		j := i
+		for j < len(sixels) && sixels[j] == sixels[i] {
+			j++
+		}
+		if j-i > 3 {
+			b.WriteString("!" + strconv.Itoa(j-i))
+			b.WriteByte(sixels[i])
+		} else {
+			b.WriteString(sixels[i:j])
+		}
+		i = j
+	}
+}
@@ -0,0 +1,287 @@
+// Package importer reads notes exported from other tools, sent as an archive over ssh stdin
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+)
+
+// MaxArchiveSize bounds what is read from stdin, and what all of the archive's files
+// decompress to together, since both are held in memory
+const MaxArchiveSize = 64 << 20
+
+// ErrTooLarge is returned for archives, or their decompressed contents, over MaxArchiveSize
+var ErrTooLarge = fmt.Errorf("the archive or its contents are larger than %d MB", MaxArchiveSize>>20)
+
+// ErrUnknownArchive is returned for input that is neither a zip nor a tarball
+var ErrUnknownArchive = errors.New("expected a zip archive or a tarball, optionally gzipped")
+
+// Format is the tool an archive was exported from
+type Format string
+
+// Formats the importer understands
+const (
+	FormatNotion   Format = "notion"   // markdown and csv export of Notion
+	FormatObsidian Format = "obsidian" // an Obsidian vault
+	FormatMarkdown Format = "markdown" // any folder of markdown files
+)
+
+// Formats lists the formats in the order they are offered
+var Formats = []Format{FormatNotion, FormatObsidian, FormatMarkdown}
+
+// File is a file of the archive, Data is only read for the ones that get imported
+type File struct {
+	Path string
+	Data []byte
+}
+
+// Plan is what an import creates, shown as a summary before anything is saved
+type Plan struct {
+	Format      Format
+	Notes       []models.ListItemViewModel
+	Collections []db.ImportedCollection
+	Skipped     []string // files that are not notes, like images
+	Links       int      // links between notes that were translated
+	Unresolved  int      // links whose target is not part of the archive
+}
+
+// importable tells the files whose content is read from the ones only listed as skipped
+func importable(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown", ".csv":
+		return true
+	}
+	return false
+}
+
+// ReadArchive reads a zip or a tarball, gzipped or not, from r. Zips inside the archive, which
+// Notion produces for large workspaces, are opened too.
+func ReadArchive(r io.Reader) ([]File, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxArchiveSize {
+		return nil, ErrTooLarge
+	}
+
+	var files []File
+	left := &budget{left: MaxArchiveSize}
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		files, err = readZip(data, true, left)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			files, err = readTar(left.reader(gz))
+		}
+	case len(data) > 262 && string(data[257:262]) == "ustar":
+		files, err = readTar(bytes.NewReader(data))
+	default:
+		return nil, ErrUnknownArchive
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stripRoot(files), nil
+}
+
+// budget is what is left of MaxArchiveSize for decompressing, shared by every file of an archive
+// and the archives nested in it, so that a small archive cannot unpack to gigabytes
+type budget struct {
+	left int64
+}
+
+// reader reads r, failing with ErrTooLarge once the budget is spent
+func (b *budget) reader(r io.Reader) io.Reader {
+	return &budgetReader{r: r, budget: b}
+}
+
+type budgetReader struct {
+	r      io.Reader
+	budget *budget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	if r.budget.left <= 0 {
+		// Running out only matters when there was more to read
+		var probe [1]byte
+		n, err := r.r.Read(probe[:])
+		if n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > r.budget.left {
+		p = p[:r.budget.left]
+	}
+	n, err := r.r.Read(p)
+	r.budget.left -= int64(n)
+	return n, err
+}
+
+func readZip(data []byte, nested bool, left *budget) ([]File, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	for _, f := range archive.File {
+		name, ok := cleanPath(f.Name)
+		if !ok || f.FileInfo().IsDir() {
+			continue
+		}
+		isZip := strings.EqualFold(path.Ext(name), ".zip")
+		if !importable(name) && !(nested && isZip) {
+			files = append(files, File{Path: name})
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(left.reader(rc))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if isZip {
+			inner, err := readZip(content, false, left)
+			if err == ErrTooLarge {
+				return nil, err
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			files = append(files, inner...)
+			continue
+		}
+		files = append(files, File{Path: name, Data: content})
+	}
+	return files, nil
+}
+
+func readTar(r io.Reader) ([]File, error) {
+	archive := tar.NewReader(r)
+	var files []File
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, ok := cleanPath(header.Name)
+		if !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if !importable(name) {
+			files = append(files, File{Path: name})
+			continue
+		}
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: name, Data: content})
+	}
+}
+
+// cleanPath normalizes a path of the archive, refusing the ones escaping it and macOS litter
+func cleanPath(name string) (string, bool) {
+	name = path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))[1:]
+	if name == "" || strings.HasPrefix(name, "__MACOSX/") || path.Base(name) == ".DS_Store" {
+		return "", false
+	}
+	return name, true
+}
+
+// stripRoot drops the directory every file is in, like the one tar -czf vault/ adds
+func stripRoot(files []File) []File {
+	if len(files) == 0 {
+		return files
+	}
+	root, _, found := strings.Cut(files[0].Path, "/")
+	if !found {
+		return files
+	}
+	for _, f := range files {
+		if !strings.HasPrefix(f.Path, root+"/") {
+			return files
+		}
+	}
+	for index := range files {
+		files[index].Path = strings.TrimPrefix(files[index].Path, root+"/")
+	}
+	return files
+}
+
+// Detect guesses the tool the files were exported from
+func Detect(files []File) Format {
+	notion := false
+	for _, f := range files {
+		if strings.HasPrefix(f.Path, ".obsidian/") {
+			return FormatObsidian
+		}
+		base := path.Base(f.Path)
+		if _, id := notionName(strings.TrimSuffix(base, path.Ext(base))); id {
+			notion = true
+		}
+	}
+	if notion {
+		return FormatNotion
+	}
+	return FormatMarkdown
+}
+
+// Build turns the files into the notes and databases to create
+func Build(files []File, format Format) Plan {
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	if format == FormatNotion {
+		return buildNotion(files)
+	}
+	return buildMarkdown(files, format)
+}
+
+// Summary describes the plan for the user, before or after it was saved
+func (p Plan) Summary() string {
+	var b strings.Builder
+	tasks := 0
+	for _, n := range p.Notes {
+		tasks += len(models.ParseTasks(n.Content))
+	}
+	fmt.Fprintf(&b, "%d notes with %d tasks\n", len(p.Notes), tasks)
+	for _, c := range p.Collections {
+		fmt.Fprintf(&b, "database %q: %d pages, %d properties\n", c.Name, len(c.Rows), len(c.Columns))
+	}
+	if p.Links > 0 {
+		fmt.Fprintf(&b, "%d links translated", p.Links)
+		if p.Unresolved > 0 {
+			fmt.Fprintf(&b, ", %d point outside the archive", p.Unresolved)
+		}
+		b.WriteString("\n")
+	}
+	if len(p.Skipped) > 0 {
+		fmt.Fprintf(&b, "%d files skipped, only markdown and csv are imported:\n", len(p.Skipped))
+		for index, name := range p.Skipped {
+			if index == 10 {
+				fmt.Fprintf(&b, "  … and %d more\n", len(p.Skipped)-index)
+				break
+			}
+			b.WriteString("  " + name + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{name: "notes/plan.md", want: "notes/plan.md", wantOK: true},
+		{name: "./notes//plan.md", want: "notes/plan.md", wantOK: true},
+		{name: `notes\windows.md`, want: "notes/windows.md", wantOK: true},
+		{name: "../../etc/passwd", want: "etc/passwd", wantOK: true},
+		{name: "/abs/path.md", want: "abs/path.md", wantOK: true},
+		{name: "__MACOSX/._plan.md"},
+		{name: "notes/.DS_Store"},
+		{name: "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cleanPath(tt.name)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("cleanPath(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestStripRoot(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{name: "empty"},
+		{name: "common root", paths: []string{"vault/a.md", "vault/sub/b.md"}, want: []string{"a.md", "sub/b.md"}},
+		{name: "different roots", paths: []string{"one/a.md", "two/b.md"}, want: []string{"one/a.md", "two/b.md"}},
+		{name: "file at the top", paths: []string{"a.md", "vault/b.md"}, want: []string{"a.md", "vault/b.md"}},
+		{name: "root is only a prefix", paths: []string{"vault/a.md", "vaults/b.md"}, want: []string{"vault/a.md", "vaults/b.md"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []File
+			for _, p := range tt.paths {
+				files = append(files, File{Path: p})
+			}
+			var got []string
+			for _, f := range stripRoot(files) {
+				got = append(got, f.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stripRoot(%q) = %q, want %q", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
+
+// note is what the tests compare of an imported note
+type note struct {
+	Title, Desc, Content string
+}
+
+func notes(items []models.ListItemViewModel) []note {
+	var out []note
+	for _, item := range items {
+		out = append(out, note{item.ItemTitle, item.Desc, item.Content})
+	}
+	return out
+}
+
+func TestBuildMarkdown(t *testing.T) {
+	files := []File{
+		{Path: "projects/plan.md", Data: []byte("---\ntitle: \"The plan\"\ntags: [work, q4 goals]\ndue: 2026-11-01\n---\n# The plan\nSee [[ideas|my ideas]] and [[missing]].")},
+		{Path: "ideas.md", Data: []byte("# Ideas\r\n\r\nLink to [plan](projects/plan.md)\r\n")},
+		{Path: "image.png"},
+		{Path: ".obsidian/app.json", Data: []byte("{}")},
+	}
+	plan := Build(files, FormatObsidian)
+	want := []note{
+		{Title: "Ideas", Content: "Link to **plan**"},
+		{Title: "The plan", Desc: "projects", Content: "#work #q4-goals\n\nSee **my ideas** and missing."},
+	}
+	if got := notes(plan.Notes); !reflect.DeepEqual(got, want) {
+		t.Errorf("notes = %+v, want %+v", got, want)
+	}
+	if plan.Notes[1].Due.Format(models.DateLayout) != "2026-11-01" {
+		t.Errorf("due = %v, want 2026-11-01", plan.Notes[1].Due)
+	}
+	if plan.Links != 3 || plan.Unresolved != 1 {
+		t.Errorf("links = %d, unresolved = %d, want 3 and 1", plan.Links, plan.Unresolved)
+	}
+	if !reflect.DeepEqual(plan.Skipped, []string{"image.png"}) {
+		t.Errorf("skipped = %q, want only image.png", plan.Skipped)
+	}
+}
+
+func TestBuildNotion(t *testing.T) {
+	const id = " 0123456789abcdef0123456789abcdef"
+	files := []File{
+		{Path: "Home" + id + ".md", Data: []byte("# Home\n\nSee [Tasks](Tasks%20" + id[1:] + ".csv)")},
+		{Path: "Tasks" + id + ".csv", Data: []byte("Name,Status\nWrite,Done\n")},
+		{Path: "Tasks" + id + "_all.csv", Data: []byte("\ufeffName,Status\nWrite,Done\nShip,Todo\n")},
+		{Path: "Tasks" + id + "/Write" + id + ".md", Data: []byte("# Write\n\nStatus: Done\n\nThe draft")},
+		{Path: "Tasks" + id + "/photo.jpg"},
+	}
+	if format := Detect(files); format != FormatNotion {
+		t.Fatalf("Detect() = %s, want %s", format, FormatNotion)
+	}
+	plan := Build(files, FormatNotion)
+
+	if want := []note{{Title: "Home", Content: "See **Tasks**"}}; !reflect.DeepEqual(notes(plan.Notes), want) {
+		t.Errorf("notes = %+v, want %+v", notes(plan.Notes), want)
+	}
+	if len(plan.Collections) != 1 {
+		t.Fatalf("collections = %+v, want one", plan.Collections)
+	}
+	c := plan.Collections[0]
+	if c.Name != "Tasks" || !reflect.DeepEqual(c.Columns, []string{"Status"}) || len(c.Rows) != 2 {
+		t.Fatalf("collection = %+v, want Tasks with Status and two rows", c)
+	}
+	if row := c.Rows[0]; row.Note.ItemTitle != "Write" || row.Note.Content != "The draft" || !reflect.DeepEqual(row.Values, []string{"Done"}) {
+		t.Errorf("first row = %+v, want Write with its page's content", row)
+	}
+	if row := c.Rows[1]; row.Note.ItemTitle != "Ship" || row.Note.Content != "" {
+		t.Errorf("second row = %+v, want Ship without content", row)
+	}
+	if !reflect.DeepEqual(plan.Skipped, []string{"Tasks" + id + "/photo.jpg"}) {
+		t.Errorf("skipped = %q", plan.Skipped)
+	}
+}
@@ -0,0 +1,207 @@
+package importer
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+var (
+	// [[Target]], [[Target#heading]], [[Target|alias]] and embeds ![[Target]]
+	wikiLinkPattern = regexp.MustCompile(`!?\[\[([^\]|#]*)(#[^\]|]*)?(?:\|([^\]]*))?\]\]`)
+	// markdown links to other files of the archive, [text](Other%20page.md)
+	fileLinkPattern = regexp.MustCompile(`\[([^\]]*)\]\(([^)\s]+\.(?:md|csv))\)`)
+	headingPattern  = regexp.MustCompile(`^#\s+(.+)$`)
+)
+
+// buildMarkdown reads every markdown file as a note; obsidian vaults leave out their settings
+func buildMarkdown(files []File, format Format) Plan {
+	plan := Plan{Format: format}
+	titles := map[string]bool{}
+	var pages []File
+	for _, f := range files {
+		if format == FormatObsidian && (strings.HasPrefix(f.Path, ".obsidian/") || strings.HasPrefix(f.Path, ".trash/")) {
+			continue
+		}
+		if ext := strings.ToLower(path.Ext(f.Path)); ext != ".md" && ext != ".markdown" {
+			plan.Skipped = append(plan.Skipped, f.Path)
+			continue
+		}
+		pages = append(pages, f)
+		titles[strings.ToLower(strings.TrimSuffix(path.Base(f.Path), path.Ext(f.Path)))] = true
+	}
+
+	for _, f := range pages {
+		item := parseNote(string(f.Data), strings.TrimSuffix(path.Base(f.Path), path.Ext(f.Path)), folder(f.Path, false))
+		item.Content = plan.translateLinks(item.Content, func(target string) bool { return titles[strings.ToLower(target)] })
+		plan.Notes = append(plan.Notes, item)
+	}
+	return plan
+}
+
+// folder is where a file sits in the archive, kept as the description of its note
+func folder(name string, notion bool) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	if notion {
+		segments := strings.Split(dir, "/")
+		for index, segment := range segments {
+			segments[index], _ = notionName(segment)
+		}
+		dir = strings.Join(segments, "/")
+	}
+	return dir
+}
+
+// parseNote reads a markdown file: its front-matter for the title, description, due date and
+// tags, otherwise a leading heading or the file name for the title and the folder as description
+func parseNote(text, name, dir string) models.ListItemViewModel {
+	text = strings.TrimPrefix(strings.ReplaceAll(text, "\r\n", "\n"), "\ufeff")
+	fields, body := splitFrontMatter(text)
+
+	item := models.ListItemViewModel{ItemTitle: first(fields["title"]), Desc: first(fields["description"])}
+	if item.Desc == "" {
+		item.Desc = dir
+	}
+	if due := first(fields["due"]); len(due) >= len(models.DateLayout) {
+		item.Due, _ = time.Parse(models.DateLayout, due[:len(models.DateLayout)])
+	}
+
+	// A heading on the first line is the title, Notion always writes one
+	lines := strings.Split(strings.TrimLeft(body, "\n"), "\n")
+	if match := headingPattern.FindStringSubmatch(lines[0]); match != nil {
+		if item.ItemTitle == "" {
+			item.ItemTitle = strings.TrimSpace(match[1])
+		}
+		if strings.TrimSpace(match[1]) == item.ItemTitle {
+			lines = lines[1:]
+		}
+	}
+	if item.ItemTitle == "" {
+		item.ItemTitle = name
+	}
+	item.Content = strings.Trim(strings.Join(lines, "\n"), "\n")
+
+	tags := append(fields["tags"], fields["tag"]...)
+	if len(tags) > 0 {
+		for index, tag := range tags {
+			tags[index] = "#" + strings.TrimPrefix(strings.ReplaceAll(tag, " ", "-"), "#")
+		}
+		item.Content = strings.Join(tags, " ") + "\n\n" + item.Content
+	}
+	return item
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// splitFrontMatter separates YAML front-matter from the body. Only what notes use of YAML is
+// understood: "key: value", "key: [a, b]" and lists of "- item" lines; nested maps are skipped.
+func splitFrontMatter(text string) (map[string][]string, string) {
+	fields := map[string][]string{}
+	if !strings.HasPrefix(text, "---\n") {
+		return fields, text
+	}
+	end := strings.Index(text[4:], "\n---")
+	if end < 0 {
+		return fields, text
+	}
+	header, body := text[4:4+end], text[4+end+4:]
+	body = strings.TrimPrefix(body, "\n")
+
+	key := ""
+	for _, line := range strings.Split(header, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "- ") && key != "":
+			fields[key] = append(fields[key], unquote(strings.TrimPrefix(trimmed, "- ")))
+		case line[0] == ' ' || line[0] == '\t':
+			// Nested under a map key, like the properties of our own export
+			key = ""
+		default:
+			name, value, ok := strings.Cut(trimmed, ":")
+			if !ok {
+				key = ""
+				continue
+			}
+			key = strings.ToLower(unquote(strings.TrimSpace(name)))
+			value = strings.TrimSpace(value)
+			if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+				for _, v := range strings.Split(value[1:len(value)-1], ",") {
+					if v = unquote(strings.TrimSpace(v)); v != "" {
+						fields[key] = append(fields[key], v)
+					}
+				}
+			} else if value != "" {
+				fields[key] = append(fields[key], unquote(value))
+			}
+		}
+	}
+	return fields, body
+}
+
+// unquote reads a YAML scalar that may be single or double quoted
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// translateLinks rewrites wiki links and links to other files of the archive as text, since
+// notes here link to nothing. Links to notes of the archive are kept in bold.
+func (p *Plan) translateLinks(content string, known func(target string) bool) string {
+	render := func(text, target string) string {
+		p.Links++
+		if known(target) {
+			return "**" + text + "**"
+		}
+		p.Unresolved++
+		return text
+	}
+
+	content = wikiLinkPattern.ReplaceAllStringFunc(content, func(link string) string {
+		match := wikiLinkPattern.FindStringSubmatch(link)
+		target := strings.TrimSpace(match[1])
+		target = strings.TrimSuffix(target, path.Ext(target))
+		target = path.Base(target)
+		text := strings.TrimSpace(match[3])
+		if text == "" {
+			text = target
+			if heading := strings.TrimPrefix(match[2], "#"); heading != "" {
+				text = strings.TrimSpace(target + " › " + heading)
+			}
+		}
+		return render(text, target)
+	})
+
+	return fileLinkPattern.ReplaceAllStringFunc(content, func(link string) string {
+		match := fileLinkPattern.FindStringSubmatch(link)
+		if strings.Contains(match[2], "://") {
+			return link
+		}
+		target, err := url.PathUnescape(match[2])
+		if err != nil {
+			target = match[2]
+		}
+		target, _ = notionName(strings.TrimSuffix(path.Base(target), path.Ext(target)))
+		return render(match[1], target)
+	})
+}
@@ -0,0 +1,129 @@
+package importer
+
+import (
+	"encoding/csv"
+	"path"
+	"regexp"
+	"strings"
+
+	"notion_ssh_app/internal/app/db"
+)
+
+var (
+	// Notion appends the page ID to every file and folder name
+	notionIDPattern = regexp.MustCompile(`^(.*) [0-9a-f]{32}$`)
+	// property lines Notion writes under the title of database pages
+	notionPropertyPattern = regexp.MustCompile(`^[^:\n]{1,60}: `)
+)
+
+// notionName strips the page ID Notion appends to a name, reporting whether there was one
+func notionName(name string) (string, bool) {
+	if match := notionIDPattern.FindStringSubmatch(name); match != nil {
+		return match[1], true
+	}
+	return name, false
+}
+
+// buildNotion turns a Notion export into notes, and its csv files into databases whose pages
+// take their content from the markdown file of the same row
+func buildNotion(files []File) Plan {
+	plan := Plan{Format: FormatNotion}
+	titles := map[string]bool{}
+	pages := map[string]File{} // markdown files by path, removed once a database row takes them
+	var tables []File
+	for _, f := range files {
+		switch strings.ToLower(path.Ext(f.Path)) {
+		case ".md":
+			pages[f.Path] = f
+			title, _ := notionName(strings.TrimSuffix(path.Base(f.Path), ".md"))
+			titles[strings.ToLower(title)] = true
+		case ".csv":
+			tables = append(tables, f)
+			name, _ := notionName(strings.TrimSuffix(strings.TrimSuffix(path.Base(f.Path), ".csv"), "_all"))
+			titles[strings.ToLower(name)] = true
+		default:
+			plan.Skipped = append(plan.Skipped, f.Path)
+		}
+	}
+	known := func(target string) bool { return titles[strings.ToLower(target)] }
+
+	// Notion writes "Name id.csv" and "Name id_all.csv" for the same database, _all has every row
+	seen := map[string]bool{}
+	for index := len(tables) - 1; index >= 0; index-- {
+		f := tables[index]
+		base := strings.TrimSuffix(strings.TrimSuffix(f.Path, path.Ext(f.Path)), "_all")
+		if seen[base] {
+			continue
+		}
+		seen[base] = true
+		name, _ := notionName(path.Base(base))
+		c, ok := readTable(f.Data, name)
+		if !ok {
+			plan.Skipped = append(plan.Skipped, f.Path)
+			continue
+		}
+
+		// The pages of the rows sit in the folder named like the csv
+		for row := range c.Rows {
+			for pagePath, page := range pages {
+				title, _ := notionName(strings.TrimSuffix(path.Base(pagePath), ".md"))
+				if path.Dir(pagePath) != base || title != c.Rows[row].Note.ItemTitle {
+					continue
+				}
+				item := parseNote(string(page.Data), title, "")
+				c.Rows[row].Note.Content = plan.translateLinks(stripProperties(item.Content), known)
+				delete(pages, pagePath)
+				break
+			}
+		}
+		plan.Collections = append([]db.ImportedCollection{c}, plan.Collections...)
+	}
+
+	for _, f := range files {
+		page, ok := pages[f.Path]
+		if !ok {
+			continue
+		}
+		title, _ := notionName(strings.TrimSuffix(path.Base(page.Path), ".md"))
+		item := parseNote(string(page.Data), title, folder(page.Path, true))
+		item.Content = plan.translateLinks(item.Content, known)
+		plan.Notes = append(plan.Notes, item)
+	}
+	return plan
+}
+
+// readTable reads a database exported as csv, its first column holding the page titles
+func readTable(data []byte, name string) (db.ImportedCollection, bool) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), "\ufeff")))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 || len(records[0]) == 0 {
+		return db.ImportedCollection{}, false
+	}
+
+	c := db.ImportedCollection{Name: name, Columns: records[0][1:]}
+	for _, record := range records[1:] {
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		row := db.ImportedRow{}
+		row.Note.ItemTitle = strings.TrimSpace(record[0])
+		for _, value := range record[1:] {
+			row.Values = append(row.Values, strings.TrimSpace(value))
+		}
+		c.Rows = append(c.Rows, row)
+	}
+	return c, true
+}
+
+// stripProperties drops the "Property: value" lines Notion writes at the top of database
+// pages, their values being imported as properties
+func stripProperties(content string) string {
+	lines := strings.Split(content, "\n")
+	index := 0
+	for index < len(lines) && notionPropertyPattern.MatchString(lines[index]) {
+		index++
+	}
+	return strings.TrimLeft(strings.Join(lines[index:], "\n"), "\n")
+}
@@ -0,0 +1,140 @@
+package merge
+
+import "strings"
+
+// hunk replaces base lines [start, end) with lines
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+// ThreeWay merges the changes made in mine and theirs since base, line by line.
+// Regions changed differently on both sides are wrapped in conflict markers and
+// reported through the returned bool.
+func ThreeWay(base, mine, theirs string) (string, bool) {
+	baseLines := strings.Split(base, "\n")
+	mineHunks := diff(baseLines, strings.Split(mine, "\n"))
+	theirHunks := diff(baseLines, strings.Split(theirs, "\n"))
+
+	var out []string
+	conflicted := false
+	pos := 0
+	for len(mineHunks) > 0 || len(theirHunks) > 0 {
+		// Start a group with the earliest hunk and pull in everything overlapping it
+		var group []hunk
+		var mineGroup, theirGroup []hunk
+		if len(theirHunks) == 0 || (len(mineHunks) > 0 && mineHunks[0].start <= theirHunks[0].start) {
+			mineGroup, mineHunks = append(mineGroup, mineHunks[0]), mineHunks[1:]
+			group = mineGroup
+		} else {
+			theirGroup, theirHunks = append(theirGroup, theirHunks[0]), theirHunks[1:]
+			group = theirGroup
+		}
+		start, end := group[0].start, group[0].end
+		for {
+			if len(mineHunks) > 0 && overlaps(mineHunks[0], start, end) {
+				mineGroup, mineHunks = append(mineGroup, mineHunks[0]), mineHunks[1:]
+				end = max(end, mineGroup[len(mineGroup)-1].end)
+				continue
+			}
+			if len(theirHunks) > 0 && overlaps(theirHunks[0], start, end) {
+				theirGroup, theirHunks = append(theirGroup, theirHunks[0]), theirHunks[1:]
+				end = max(end, theirGroup[len(theirGroup)-1].end)
+				continue
+			}
+			break
+		}
+
+		out = append(out, baseLines[pos:start]...)
+		mineRegion := apply(baseLines, start, end, mineGroup)
+		theirRegion := apply(baseLines, start, end, theirGroup)
+		switch {
+		case len(theirGroup) == 0:
+			out = append(out, mineRegion...)
+		case len(mineGroup) == 0 || equal(mineRegion, theirRegion):
+			out = append(out, theirRegion...)
+		default:
+			conflicted = true
+			out = append(out, "<<<<<<< mine")
+			out = append(out, mineRegion...)
+			out = append(out, "=======")
+			out = append(out, theirRegion...)
+			out = append(out, ">>>>>>> theirs")
+		}
+		pos = end
+	}
+	out = append(out, baseLines[pos:]...)
+	return strings.Join(out, "\n"), conflicted
+}
+
+// overlaps reports whether h touches the base range [start, end)
+func overlaps(h hunk, start, end int) bool {
+	return (h.start < end && start < h.end) || h.start == start
+}
+
+// apply returns base[start:end] with the given hunks applied
+func apply(base []string, start, end int, hunks []hunk) []string {
+	var out []string
+	pos := start
+	for _, h := range hunks {
+		out = append(out, base[pos:h.start]...)
+		out = append(out, h.lines...)
+		pos = h.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+// diff returns the hunks turning base into other, based on their longest common subsequence
+func diff(base, other []string) []hunk {
+	// lcs[i][j] is the LCS length of base[i:] and other[j:]
+	lcs := make([][]int, len(base)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(other)+1)
+	}
+	for i := len(base) - 1; i >= 0; i-- {
+		for j := len(other) - 1; j >= 0; j-- {
+			if base[i] == other[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var hunks []hunk
+	i, j := 0, 0
+	bi, oj := 0, 0
+	flush := func() {
+		if bi < i || oj < j {
+			hunks = append(hunks, hunk{start: bi, end: i, lines: other[oj:j]})
+		}
+	}
+	for i < len(base) && j < len(other) {
+		switch {
+		case base[i] == other[j]:
+			flush()
+			i++
+			j++
+			bi, oj = i, j
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	i, j = len(base), len(other)
+	flush()
+	return hunks
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
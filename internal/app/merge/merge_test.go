@@ -0,0 +1,63 @@
+package merge
+
+import "testing"
+
+func TestThreeWay(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, mine, theirs string
+		want               string
+		wantConflicted     bool
+	}{
+		{
+			name: "nothing changed",
+			base: "a\nb\nc", mine: "a\nb\nc", theirs: "a\nb\nc",
+			want: "a\nb\nc",
+		},
+		{
+			name: "only mine changed",
+			base: "a\nb\nc", mine: "a\nB\nc", theirs: "a\nb\nc",
+			want: "a\nB\nc",
+		},
+		{
+			name: "only theirs changed",
+			base: "a\nb\nc", mine: "a\nb\nc", theirs: "a\nb\nc\nd",
+			want: "a\nb\nc\nd",
+		},
+		{
+			name: "same change on both sides",
+			base: "a\nb\nc", mine: "a\nB\nc", theirs: "a\nB\nc",
+			want: "a\nB\nc",
+		},
+		{
+			name: "changes to different lines",
+			base: "a\nb\nc\nd\ne", mine: "A\nb\nc\nd\ne", theirs: "a\nb\nc\nd\nE",
+			want: "A\nb\nc\nd\nE",
+		},
+		{
+			name: "line deleted on one side and another changed on the other",
+			base: "a\nb\nc\nd", mine: "a\nc\nd", theirs: "a\nb\nc\nD",
+			want: "a\nc\nD",
+		},
+		{
+			name: "same line changed differently",
+			base: "a\nb\nc", mine: "a\nmine\nc", theirs: "a\ntheirs\nc",
+			want:           "a\n<<<<<<< mine\nmine\n=======\ntheirs\n>>>>>>> theirs\nc",
+			wantConflicted: true,
+		},
+		{
+			name: "insertions at the same place",
+			base: "a\nb", mine: "a\nx\nb", theirs: "a\ny\nb",
+			want:           "a\n<<<<<<< mine\nx\n=======\ny\n>>>>>>> theirs\nb",
+			wantConflicted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicted := ThreeWay(tt.base, tt.mine, tt.theirs)
+			if got != tt.want || conflicted != tt.wantConflicted {
+				t.Errorf("ThreeWay() = %q, %v, want %q, %v", got, conflicted, tt.want, tt.wantConflicted)
+			}
+		})
+	}
+}
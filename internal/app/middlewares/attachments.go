@@ -0,0 +1,365 @@
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/blobs"
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/graphics"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/web"
+)
+
+// attachmentLinkLifetime is how long a download link of an attachment works
+const attachmentLinkLifetime = 15 * time.Minute
+
+// maxPaste bounds the base64 pasted into the attachments view, larger files go through scp
+const maxPaste = 512 << 10
+
+// errAttachmentName is returned for file names that are empty once cleaned up
+var errAttachmentName = errors.New("the file needs a name")
+
+// Define the attachments model struct, listing the files attached to the note in the viewer
+type AttachmentsViewModel struct {
+	Note      models.ListItemViewModel
+	List      list.Model
+	Used      int64
+	Link      string // download link of the selected attachment, empty until asked for
+	LinkName  string
+	ExpiresAt time.Time
+	Paste     *huh.Form // base64 file being pasted, nil otherwise
+	Status    string
+	Images    graphics.Protocol // how the viewer draws images linked from the note
+}
+
+// attachmentItem makes an attachment selectable in the attachments list
+type attachmentItem struct {
+	db.Attachment
+}
+
+func (i attachmentItem) FilterValue() string { return i.Name }
+func (i attachmentItem) Title() string       { return i.Name }
+func (i attachmentItem) Description() string {
+	return formatSize(i.Size) + " · " + i.ContentType + " · " + attachmentRef(i.Attachment)
+}
+
+// attachmentRef is how a note's content links to an attachment, as an image for images
+func attachmentRef(a db.Attachment) string {
+	if strings.HasPrefix(a.ContentType, "image/") {
+		return fmt.Sprintf("![%s](attachment:%d)", a.Name, a.ID)
+	}
+	return fmt.Sprintf("[%s](attachment:%d)", a.Name, a.ID)
+}
+
+// formatSize prints a number of bytes for people
+func formatSize(n int64) string {
+	switch {
+	case n < 1<<10:
+		return strconv.FormatInt(n, 10) + " B"
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	case n < 1<<30:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+}
+
+// attachmentName keeps the last element of an uploaded file's path, without control characters
+func attachmentName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[:255])
+	}
+	return name
+}
+
+// storeAttachment puts what r reads into the blob store and attaches it to the note, as long
+// as it fits in the user's quota. size is what the client announced, -1 when unknown.
+func storeAttachment(userID, noteID int, name string, size int64, r io.Reader) (db.Attachment, error) {
+	name = attachmentName(name)
+	if name == "" {
+		return db.Attachment{}, errAttachmentName
+	}
+	left, err := db.AttachmentSpace(noteID, userID)
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	if size > left {
+		return db.Attachment{}, db.ErrQuotaExceeded
+	}
+
+	br := bufio.NewReaderSize(r, 512)
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		head, _ := br.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+	key, err := blobs.NewKey()
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	n, err := blobs.Default.Put(key, io.LimitReader(br, left+1))
+	if err == nil && n > left {
+		err = db.ErrQuotaExceeded
+	}
+	if err != nil {
+		if err := blobs.Default.Delete(key); err != nil {
+			fmt.Println("Error deleting blob:", err)
+		}
+		return db.Attachment{}, err
+	}
+
+	a, err := db.AddAttachment(db.Attachment{NoteID: noteID, UserID: userID, Name: name, Size: n, ContentType: contentType, BlobKey: key})
+	if err != nil {
+		if err := blobs.Default.Delete(key); err != nil {
+			fmt.Println("Error deleting blob:", err)
+		}
+	}
+	return a, err
+}
+
+// purgeBlobs removes the blobs of deleted attachments in the background
+func purgeBlobs() {
+	go func() {
+		if err := blobs.Purge(); err != nil {
+			fmt.Println("Error purging blobs:", err)
+		}
+	}()
+}
+
+// decodePaste reads pasted base64, with or without line breaks or a data: URL prefix
+func decodePaste(text string) ([]byte, error) {
+	if i := strings.Index(text, ";base64,"); strings.HasPrefix(text, "data:") && i >= 0 {
+		text = text[i+len(";base64,"):]
+	}
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, text)
+	if data, err := base64.StdEncoding.DecodeString(text); err == nil {
+		return data, nil
+	}
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(text, "="))
+}
+
+// openAttachments lists the files attached to the note in the viewer
+func (m Model) openAttachments() (tea.Model, tea.Cmd) {
+	l := list.New(nil, list.NewDefaultDelegate(), 70, max(m.Dimensions.TotalHeight-16, 10))
+	l.Title = "attachments of " + m.ListItemView.Title()
+	m.Attachments = AttachmentsViewModel{Note: m.ListItemView, List: l, Images: m.Graphics.Protocol}
+	m.CurrentView = attachmentsView
+	return m.loadAttachments(), nil
+}
+
+// loadAttachments fetches the attachments and the user's quota usage again
+func (m Model) loadAttachments() Model {
+	attachments, err := db.NoteAttachments(m.Attachments.Note.ID, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching attachments:", err)
+		m.Attachments.Status = "Could not load the attachments"
+		return m
+	}
+	used, err := db.AttachmentUsage(m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching attachment usage:", err)
+	}
+	m.Attachments.Used = used
+
+	var items []list.Item
+	for _, a := range attachments {
+		items = append(items, attachmentItem{a})
+	}
+	index := m.Attachments.List.Index()
+	m.Attachments.List.SetItems(items)
+	m.Attachments.List.Select(min(index, max(len(items)-1, 0)))
+	return m
+}
+
+// newPasteForm asks for the name and base64 contents of a file to attach
+func newPasteForm() *huh.Form {
+	return huh.NewForm(huh.NewGroup(
+		huh.NewInput().Title("File name").Key("name").
+			Validate(func(s string) error {
+				if attachmentName(s) == "" {
+					return errAttachmentName
+				}
+				return nil
+			}),
+		huh.NewText().Title("Contents as base64").Key("data").CharLimit(maxPaste).
+			Description("Paste the output of: base64 -w0 file").
+			Validate(func(s string) error {
+				if _, err := decodePaste(s); err != nil {
+					return errors.New("this is not base64")
+				}
+				return nil
+			}),
+	))
+}
+
+// updateAttachments creates download links, deletes attachments and takes pasted files
+func (m Model) updateAttachments(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.Attachments.Paste != nil {
+		return m.updatePaste(msg)
+	}
+	if key, ok := msg.(tea.KeyMsg); ok && m.Attachments.List.FilterState() != list.Filtering {
+		selected, isAttachment := m.Attachments.List.SelectedItem().(attachmentItem)
+		switch key.String() {
+		case "esc":
+			m.CurrentView = 3
+			return m, nil
+		case "enter":
+			if !isAttachment {
+				return m, nil
+			}
+			token, expiresAt, err := db.CreateAttachmentLink(selected.ID, m.User.user_id, attachmentLinkLifetime)
+			if err != nil {
+				fmt.Println("Error creating attachment link:", err)
+				m.Attachments.Status = "Could not create a download link, please try again"
+				return m, nil
+			}
+			m.Attachments.Link = web.AttachmentURL(token)
+			m.Attachments.LinkName = selected.Name
+			m.Attachments.ExpiresAt = expiresAt
+			m.Attachments.Status = ""
+			return m, nil
+		case "d":
+			if !isAttachment {
+				return m, nil
+			}
+			err := db.DeleteAttachment(selected.ID, m.User.user_id)
+			if err == db.ErrForbidden {
+				m.Attachments.Status = "Only editors of the note and the uploader can delete " + selected.Name
+				return m, nil
+			}
+			if err != nil {
+				fmt.Println("Error deleting attachment:", err)
+				m.Attachments.Status = "Could not delete " + selected.Name + ", please try again"
+				return m, nil
+			}
+			purgeBlobs()
+			if m.Attachments.LinkName == selected.Name {
+				m.Attachments.Link = ""
+			}
+			m.Attachments.Status = "Deleted " + selected.Name + ", links to it in the note no longer work"
+			return m.loadAttachments(), nil
+		case "p":
+			if m.Attachments.Note.Role < models.RoleEditor {
+				return m, nil
+			}
+			if m.Attachments.Note.Private {
+				m.Attachments.Status = "Private notes cannot have attachments"
+				return m, nil
+			}
+			m.Attachments.Paste = newPasteForm()
+			return m, m.Attachments.Paste.Init()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Attachments.List, cmd = m.Attachments.List.Update(msg)
+	return m, cmd
+}
+
+// updatePaste runs the paste form, then stores the decoded file
+func (m Model) updatePaste(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" {
+		m.Attachments.Paste = nil
+		return m, nil
+	}
+
+	f, cmd := m.Attachments.Paste.Update(msg)
+	m.Attachments.Paste = f.(*huh.Form)
+	if m.Attachments.Paste.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	name := m.Attachments.Paste.GetString("name")
+	data, _ := decodePaste(m.Attachments.Paste.GetString("data"))
+	m.Attachments.Paste = nil
+	a, err := storeAttachment(m.User.user_id, m.Attachments.Note.ID, name, int64(len(data)), bytes.NewReader(data))
+	switch {
+	case err == db.ErrPrivateNote:
+		m.Attachments.Status = "Private notes cannot have attachments"
+	case err == db.ErrQuotaExceeded:
+		m.Attachments.Status = "That does not fit in what is left of your " + formatSize(db.AttachmentQuota()) + " of attachments"
+	case err != nil:
+		fmt.Println("Error storing attachment:", err)
+		m.Attachments.Status = "Could not attach " + name + ", please try again"
+	default:
+		m.Attachments.Status = "Attached, link to it from the note with " + attachmentRef(a)
+	}
+	return m.loadAttachments(), nil
+}
+
+// Renders the attachments list with the download link and how to upload
+func (m AttachmentsViewModel) View() string {
+	faint := lipgloss.NewStyle().Faint(true)
+
+	if m.Paste != nil {
+		return lipgloss.NewStyle().Width(80).Render(lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9")).Render("Attach a file to "+m.Note.Title()),
+			"",
+			m.Paste.View(),
+			faint.Render("esc: cancel"),
+		))
+	}
+
+	lines := []string{m.List.View()}
+	if m.Link != "" {
+		lines = append(lines,
+			"Download "+m.LinkName+" from:",
+			lipgloss.NewStyle().Underline(true).Render(m.Link),
+			faint.Render("the link works until "+m.ExpiresAt.Format("15:04")),
+		)
+	}
+	lines = append(lines,
+		m.Status,
+		faint.Render(fmt.Sprintf("You use %s of %s", formatSize(m.Used), formatSize(db.AttachmentQuota()))),
+	)
+	help := "enter: download link • d: delete • esc: back"
+	if m.Note.Private {
+		lines = append(lines, faint.Render("Attachments are stored unencrypted, so private notes cannot have any"))
+	} else if m.Note.Role >= models.RoleEditor {
+		help = "enter: download link • d: delete • p: paste base64 • esc: back"
+		lines = append(lines,
+			faint.Render(fmt.Sprintf("Upload from your shell: scp -O -P 23236 <file> %s:%d", sshHost(), m.Note.ID)),
+			faint.Render(fmt.Sprintf("or: ssh %s attach --name <name> %d < <file>", sshAddress(), m.Note.ID)),
+		)
+	}
+	lines = append(lines, faint.Render(fmt.Sprintf("Download from your shell: scp -O -P 23236 %s:%d/<name> .", sshHost(), m.Note.ID)))
+	if m.Images == graphics.Off {
+		lines = append(lines, faint.Render("Images linked on a line of their own show in the viewer once turned on with: ssh -o SetEnv=NOTES_IMAGES=blocks ..."))
+	} else {
+		lines = append(lines, faint.Render("Images linked on a line of their own show in the viewer as "+m.Images.String()+", pick kitty, sixel, blocks or off with: ssh -o SetEnv=NOTES_IMAGES=..."))
+	}
+	lines = append(lines, faint.Render(help))
+	return lipgloss.NewStyle().Width(80).Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
@@ -0,0 +1,184 @@
+package middlewares
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/models"
+)
+
+// Define the board model struct: the pages of a database in one list per option of a select property
+type BoardViewModel struct {
+	Property models.Property // the select property the pages are grouped by
+	Columns  []list.Model    // one per option, the first holding pages without a value
+	Focus    int
+}
+
+// cardItem makes a page of a database show up as a card on the board
+type cardItem struct {
+	models.Row
+	details string
+}
+
+func (i cardItem) FilterValue() string { return i.Note.Title() }
+func (i cardItem) Title() string       { return i.Note.Title() }
+func (i cardItem) Description() string { return i.details }
+
+// groupingProperty picks the property the board groups by: the select column under
+// the cursor, or else the first select column of the database
+func (m DatabaseViewModel) groupingProperty() (models.Property, bool) {
+	if m.Column > 0 && m.Collection.Properties[m.Column-1].Type == models.PropertySelect {
+		return m.Collection.Properties[m.Column-1], true
+	}
+	for _, p := range m.Collection.Properties {
+		if p.Type == models.PropertySelect {
+			return p, true
+		}
+	}
+	return models.Property{}, false
+}
+
+// openBoard switches the open database to the board layout
+func (m Model) openBoard() Model {
+	p, ok := m.Database.groupingProperty()
+	if !ok {
+		m.Database.Status = "Add a select property to group the pages by first"
+		return m
+	}
+	m.Database.Board = BoardViewModel{Property: p}
+	m.Database.Mode = databaseBoard
+	return m.fillBoard()
+}
+
+// fillBoard sorts the visible pages into the columns of the board, keeping the selection
+func (m Model) fillBoard() Model {
+	p := m.Database.Board.Property
+	options := append([]string{""}, p.Options...)
+	width := max((m.Dimensions.TotalWidth-10)/len(options)-2, 20)
+	height := max(m.Dimensions.TotalHeight-12, 10)
+
+	columns := make([][]list.Item, len(options))
+	for _, row := range m.Database.visibleRows() {
+		index := 0
+		for i, option := range options {
+			if row.Values[p.ID] == option {
+				index = i
+			}
+		}
+		columns[index] = append(columns[index], cardItem{row, m.Database.cardDetails(row)})
+	}
+
+	previous := m.Database.Board.Columns
+	m.Database.Board.Columns = make([]list.Model, len(options))
+	for i, option := range options {
+		l := list.New(columns[i], list.NewDefaultDelegate(), width, height)
+		l.Title = option
+		if option == "" {
+			l.Title = "No " + p.Name
+		}
+		l.SetShowHelp(false)
+		l.SetShowStatusBar(false)
+		l.SetFilteringEnabled(false)
+		if i < len(previous) {
+			l.Select(min(previous[i].Index(), max(len(columns[i])-1, 0)))
+		}
+		m.Database.Board.Columns[i] = l
+	}
+	m.Database.Board.Focus = min(m.Database.Board.Focus, len(options)-1)
+	return m
+}
+
+// cardDetails lists the values of the other properties on a card
+func (m DatabaseViewModel) cardDetails(row models.Row) string {
+	var details []string
+	for _, p := range m.Collection.Properties {
+		if p.ID == m.Board.Property.ID || row.Values[p.ID] == "" {
+			continue
+		}
+		details = append(details, p.Display(row.Values[p.ID]))
+	}
+	return strings.Join(details, " · ")
+}
+
+// updateBoard moves between columns and moves cards from one column to the next
+func (m Model) updateBoard(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	board := &m.Database.Board
+	m.Database.Status = ""
+
+	switch key.String() {
+	case "esc", "b":
+		m.Database.Mode = databaseTable
+		return m, nil
+	case "left", "h":
+		board.Focus = max(board.Focus-1, 0)
+		return m, nil
+	case "right", "l":
+		board.Focus = min(board.Focus+1, len(board.Columns)-1)
+		return m, nil
+	case "<", "H":
+		return m.moveCard(board.Focus - 1), nil
+	case ">", "L":
+		return m.moveCard(board.Focus + 1), nil
+	case "o", "enter":
+		if card, ok := board.Columns[board.Focus].SelectedItem().(cardItem); ok {
+			m = m.openViewer(card.Note)
+			m.ViewerBack = databaseView
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	board.Columns[board.Focus], cmd = board.Columns[board.Focus].Update(key)
+	return m, cmd
+}
+
+// moveCard sets the selected card's value to the option of another column and follows it there
+func (m Model) moveCard(to int) Model {
+	board := m.Database.Board
+	if to < 0 || to >= len(board.Columns) {
+		return m
+	}
+	card, ok := board.Columns[board.Focus].SelectedItem().(cardItem)
+	if !ok {
+		return m
+	}
+	if card.Note.Role < models.RoleEditor {
+		m.Database.Status = "You cannot edit this page"
+		return m
+	}
+
+	value := ""
+	if to > 0 {
+		value = board.Property.Options[to-1]
+	}
+	m = m.setCell(card.Row, &board.Property, value)
+	if m.Database.Status != "" {
+		return m
+	}
+
+	m.Database.Board.Focus = to
+	m = m.fillBoard()
+	target := &m.Database.Board.Columns[to]
+	for index, item := range target.Items() {
+		if item.(cardItem).Note.ID == card.Note.ID {
+			target.Select(index)
+		}
+	}
+	return m
+}
+
+// Renders the columns side by side, the focused one outlined
+func (m BoardViewModel) View() string {
+	var columns []string
+	for index, column := range m.Columns {
+		border := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("#444444"))
+		if index == m.Focus {
+			border = border.BorderForeground(lipgloss.Color("#7571F9"))
+		}
+		columns = append(columns, border.Render(column.View()))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, columns...)
+}
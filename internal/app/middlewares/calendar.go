@@ -0,0 +1,285 @@
+package middlewares
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/gitstore"
+	"notion_ssh_app/internal/app/models"
+)
+
+// The date fields the calendar cycles through
+var calendarFields = []db.DateField{db.DateDue, db.DateCreated, db.DateUpdated}
+
+// Define the calendar model struct: a month or week grid of days with the selected day's notes beside it
+type CalendarViewModel struct {
+	Field     db.DateField
+	Week      bool      // a week instead of a month
+	Day       time.Time // selected day, at midnight
+	From, To  time.Time // days the entries were loaded for
+	Entries   map[string][]models.ListItemViewModel
+	List      list.Model // notes of the selected day
+	ListFocus bool
+	Status    string
+}
+
+// dayKey identifies a day in Entries
+func dayKey(t time.Time) string {
+	return t.Format(models.DateLayout)
+}
+
+// startOfDay is midnight of t's day in loc
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// startOfWeek is the Monday of the week day falls in
+func startOfWeek(day time.Time) time.Time {
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// span is the first day shown and the day after the last one
+func (m CalendarViewModel) span() (time.Time, time.Time) {
+	if m.Week {
+		from := startOfWeek(m.Day)
+		return from, from.AddDate(0, 0, 7)
+	}
+	from := startOfWeek(time.Date(m.Day.Year(), m.Day.Month(), 1, 0, 0, 0, 0, m.Day.Location()))
+	return from, from.AddDate(0, 0, 42)
+}
+
+// openCalendar shows the current month placed by due date
+func (m Model) openCalendar() (tea.Model, tea.Cmd) {
+	l := list.New(nil, list.NewDefaultDelegate(), 32, max(m.Dimensions.TotalHeight-12, 10))
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+	m.Calendar = CalendarViewModel{Field: db.DateDue, Day: startOfDay(time.Now(), m.location()), List: l}
+	m.CurrentView = calendarView
+	return m.loadCalendar(), nil
+}
+
+// loadCalendar fetches the notes of the days shown
+func (m Model) loadCalendar() Model {
+	from, to := m.Calendar.span()
+	entries, err := db.FetchCalendar(m.User.user_id, m.Workspace.ID, m.Calendar.Field, from, to, m.Calendar.Day.Location())
+	if err != nil {
+		fmt.Println("Error fetching calendar:", err)
+		m.Calendar.Status = "Could not load the calendar"
+	}
+	m.Calendar.From, m.Calendar.To = from, to
+	m.Calendar.Entries = map[string][]models.ListItemViewModel{}
+	for _, e := range entries {
+		m.Calendar.Entries[dayKey(e.Date)] = append(m.Calendar.Entries[dayKey(e.Date)], e.Item)
+	}
+	return m.selectDay(m.Calendar.Day)
+}
+
+// selectDay moves the selection, loading more days when it leaves the ones shown
+func (m Model) selectDay(day time.Time) Model {
+	m.Calendar.Day = day
+	if from, to := m.Calendar.span(); !from.Equal(m.Calendar.From) || !to.Equal(m.Calendar.To) {
+		return m.loadCalendar()
+	}
+	var items []list.Item
+	for _, item := range m.Calendar.Entries[dayKey(day)] {
+		items = append(items, item)
+	}
+	m.Calendar.List.SetItems(items)
+	m.Calendar.List.Title = day.Format("Mon 2 Jan")
+	m.Calendar.List.Select(0)
+	return m
+}
+
+// updateCalendar moves through the days, or through the selected day's notes
+func (m Model) updateCalendar(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, isKey := msg.(tea.KeyMsg)
+	if !isKey {
+		return m, nil
+	}
+
+	if m.Calendar.ListFocus {
+		switch key.String() {
+		case "esc", "tab":
+			m.Calendar.ListFocus = false
+			return m, nil
+		case "enter":
+			if item, ok := m.Calendar.List.SelectedItem().(models.ListItemViewModel); ok {
+				m = m.openViewer(item)
+				m.ViewerBack = calendarView
+			}
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.Calendar.List, cmd = m.Calendar.List.Update(msg)
+		return m, cmd
+	}
+
+	day := m.Calendar.Day
+	switch key.String() {
+	case "esc":
+		m.CurrentView = 1
+		return m, nil
+	case "left", "h":
+		return m.selectDay(day.AddDate(0, 0, -1)), nil
+	case "right", "l":
+		return m.selectDay(day.AddDate(0, 0, 1)), nil
+	case "up", "k":
+		return m.selectDay(day.AddDate(0, 0, -7)), nil
+	case "down", "j":
+		return m.selectDay(day.AddDate(0, 0, 7)), nil
+	case "[":
+		if m.Calendar.Week {
+			return m.selectDay(day.AddDate(0, 0, -7)), nil
+		}
+		return m.selectDay(day.AddDate(0, -1, 0)), nil
+	case "]":
+		if m.Calendar.Week {
+			return m.selectDay(day.AddDate(0, 0, 7)), nil
+		}
+		return m.selectDay(day.AddDate(0, 1, 0)), nil
+	case "t":
+		return m.selectDay(startOfDay(time.Now(), day.Location())), nil
+	case "v":
+		m.Calendar.Week = !m.Calendar.Week
+		return m.loadCalendar(), nil
+	case "f":
+		for index, field := range calendarFields {
+			if field == m.Calendar.Field {
+				m.Calendar.Field = calendarFields[(index+1)%len(calendarFields)]
+				break
+			}
+		}
+		return m.loadCalendar(), nil
+	case "tab", "enter":
+		if len(m.Calendar.List.Items()) > 0 {
+			m.Calendar.ListFocus = true
+		}
+	}
+	return m, nil
+}
+
+// Renders the grid of days next to the notes of the selected day
+func (m CalendarViewModel) View(width, height int) string {
+	accent := lipgloss.Color("#7571F9")
+	faint := lipgloss.NewStyle().Faint(true)
+
+	cellWidth := min(max((width-50)/7, 8), 18)
+	cellHeight := 4
+	if m.Week {
+		cellHeight = max(height-14, 6)
+	}
+	today := dayKey(time.Now().In(m.Day.Location()))
+
+	var weeks []string
+	header := make([]string, 7)
+	for i := range header {
+		header[i] = lipgloss.NewStyle().Width(cellWidth + 2).Align(lipgloss.Center).Bold(true).Render(m.From.AddDate(0, 0, i).Format("Mon"))
+	}
+	weeks = append(weeks, lipgloss.JoinHorizontal(lipgloss.Top, header...))
+
+	for week := m.From; week.Before(m.To); week = week.AddDate(0, 0, 7) {
+		cells := make([]string, 7)
+		for i := range cells {
+			day := week.AddDate(0, 0, i)
+			cells[i] = m.cell(day, cellWidth, cellHeight, dayKey(day) == today, accent)
+		}
+		weeks = append(weeks, lipgloss.JoinHorizontal(lipgloss.Top, cells...))
+	}
+
+	title := m.Day.Format("January 2006")
+	if m.Week {
+		title = "Week of " + startOfWeek(m.Day).Format("2 January 2006")
+	}
+	title = lipgloss.NewStyle().Bold(true).Foreground(accent).Render(title) + faint.Render("  by "+string(m.Field)+" date")
+
+	side := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("#444444")).Padding(0, 1)
+	if m.ListFocus {
+		side = side.BorderForeground(accent)
+	}
+	body := lipgloss.JoinHorizontal(lipgloss.Top, lipgloss.JoinVertical(lipgloss.Left, weeks...), side.Render(m.List.View()))
+
+	help := "arrows: day • [ ]: previous/next • t: today • v: month/week • f: date field • tab: notes of the day • esc: back"
+	if m.ListFocus {
+		help = "enter: open note • tab: back to the days"
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, title, body, m.Status, faint.Render(help))
+}
+
+// cell renders one day with as many note titles as fit
+func (m CalendarViewModel) cell(day time.Time, width, height int, today bool, accent lipgloss.Color) string {
+	style := lipgloss.NewStyle().Width(width).Height(height).Border(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("#444444"))
+	if dayKey(day) == dayKey(m.Day) {
+		style = style.BorderForeground(accent)
+	}
+
+	number := fmt.Sprint(day.Day())
+	switch {
+	case today:
+		number = lipgloss.NewStyle().Bold(true).Foreground(accent).Render(number + " today")
+	case !m.Week && day.Month() != m.Day.Month():
+		number = lipgloss.NewStyle().Faint(true).Render(number)
+	}
+
+	lines := []string{number}
+	notes := m.Entries[dayKey(day)]
+	shown := notes
+	if len(notes) > height-1 {
+		shown = notes[:height-2]
+	}
+	for _, note := range shown {
+		lines = append(lines, truncate(note.Title(), width))
+	}
+	if len(shown) < len(notes) {
+		lines = append(lines, lipgloss.NewStyle().Faint(true).Render(fmt.Sprintf("+%d more", len(notes)-len(shown))))
+	}
+	return style.Render(strings.Join(lines, "\n"))
+}
+
+// openDueForm asks for the due date of the note in the viewer
+func (m Model) openDueForm() (tea.Model, tea.Cmd) {
+	due := ""
+	if !m.ListItemView.Due.IsZero() {
+		due = m.ListItemView.Due.Format(models.DateLayout)
+	}
+	m.Due = huh.NewForm(huh.NewGroup(
+		huh.NewInput().Title("Due date, YYYY-MM-DD (empty to clear)").Key("due").Value(&due).Validate(func(s string) error {
+			if _, err := time.Parse(models.DateLayout, strings.TrimSpace(s)); strings.TrimSpace(s) != "" && err != nil {
+				return fmt.Errorf("use a date like 2024-07-31")
+			}
+			return nil
+		}),
+	))
+	return m, m.Due.Init()
+}
+
+// updateDueForm runs the due date form and stores the date once submitted
+func (m Model) updateDueForm(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" {
+		m.Due = nil
+		return m, nil
+	}
+	f, cmd := m.Due.Update(msg)
+	m.Due = f.(*huh.Form)
+	if m.Due.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	due, _ := time.Parse(models.DateLayout, strings.TrimSpace(m.Due.GetString("due")))
+	m.Due = nil
+	if err := db.SetDueDate(m.ListItemView.ID, m.User.user_id, due); err != nil {
+		fmt.Println("Error setting due date:", err)
+		return m, nil
+	}
+	m.ListItemView.Due = due
+	m.replaceItem(m.ListItemView)
+	gitstore.NoteSaved(m.ListItemView.ID, m.User.user_id, "Set the due date of "+m.ListItemView.Subject())
+	return m, nil
+}
@@ -0,0 +1,243 @@
+package middlewares
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"notion_ssh_app/internal/app/collab"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/styles"
+)
+
+// Define the collaboration state of the editor
+type CollabViewModel struct {
+	NoteID  int // shared note open in the editor, 0 when not collaborating
+	Rev     int
+	Text    string
+	Cursors []collab.Cursor
+}
+
+// openEditor shows the editor with the given text and its rendered preview.
+// Existing notes other than private ones are edited together with every other session that
+// has them open.
+func (m Model) openEditor(text string) Model {
+	m.TextareaView.ShowTextArea = true
+	m.TextareaView.Status = ""
+	if m.Editing != nil && m.Peer != nil && m.Collab.NoteID != m.Editing.ID {
+		m = m.leaveCollab()
+		// The hub would hold private notes unsealed
+		if !m.Editing.Private {
+			shared, rev := collab.Join(m.Peer, *m.Editing, text)
+			m.Collab = CollabViewModel{NoteID: m.Editing.ID, Rev: rev, Text: shared}
+			text = shared
+		}
+	}
+	m.TextareaView.Textarea.SetValue(text)
+	m = m.syncCollab()
+	m.CurrentView = 2
+	return m
+}
+
+// leaveCollab stops sharing the editor with other sessions
+func (m Model) leaveCollab() Model {
+	if m.Collab.NoteID != 0 {
+		collab.Leave(m.Peer, m.Collab.NoteID)
+		m.Collab = CollabViewModel{}
+	}
+	return m
+}
+
+// syncCollab pushes local edits and cursor moves to the hub and re-renders the preview
+func (m Model) syncCollab() Model {
+	if m.Collab.NoteID != 0 {
+		value := m.TextareaView.Textarea.Value()
+		offset := cursorOffset(m.TextareaView.Textarea)
+		if op, changed := collab.Diff(m.Collab.Text, value); changed {
+			text, rev, cursor := collab.Edit(m.Peer, m.Collab.NoteID, m.Collab.Rev, op, offset)
+			m.Collab.Text, m.Collab.Rev = text, rev
+			if text != value {
+				setTextareaValue(&m.TextareaView.Textarea, text, cursor)
+			}
+		} else {
+			collab.MoveCursor(m.Peer, m.Collab.NoteID, offset)
+		}
+	}
+	out, _ := glamour.Render(m.TextareaView.Textarea.Value(), "dark")
+	m.ViewportView.setContent(out)
+	return m
+}
+
+// applyCollabUpdate takes in an edit or cursor move made by another session
+func (m Model) applyCollabUpdate(msg collab.UpdateMsg) Model {
+	if msg.NoteID != m.Collab.NoteID {
+		return m
+	}
+	m.Collab.Cursors = msg.Cursors
+	if msg.Rev <= m.Collab.Rev {
+		return m
+	}
+	cursor := cursorOffset(m.TextareaView.Textarea)
+	for _, c := range msg.Cursors {
+		if c.PeerID == m.Peer.ID {
+			cursor = c.Offset
+		}
+	}
+	m.Collab.Text, m.Collab.Rev = msg.Text, msg.Rev
+	setTextareaValue(&m.TextareaView.Textarea, msg.Text, cursor)
+	out, _ := glamour.Render(msg.Text, "dark")
+	m.ViewportView.setContent(out)
+	return m
+}
+
+// applyCollabSaved keeps the version the next save is checked against in step with other sessions
+func (m Model) applyCollabSaved(msg collab.SavedMsg) Model {
+	if m.Editing == nil || m.Editing.ID != msg.NoteID {
+		return m
+	}
+	m.Editing.Version = msg.Version
+	item := models.ParseEditorText(m.Collab.Text)
+	item.ID, item.Version = msg.NoteID, msg.Version
+	item.Role, item.Owner = m.Editing.Role, m.Editing.Owner
+	m.replaceItem(item)
+	return m
+}
+
+// Renders who else is editing the note and where their cursors are, drawn in the textarea in the same colours
+func (m CollabViewModel) View(self *collab.Peer) string {
+	var others []string
+	for _, c := range m.Cursors {
+		if self != nil && c.PeerID == self.ID {
+			continue
+		}
+		line, col := lineCol(m.Text, c.Offset)
+		others = append(others, lipgloss.NewStyle().Foreground(c.Color).Render(fmt.Sprintf("▍%s ln %d, col %d", c.Name, line+1, col+1)))
+	}
+	if len(others) == 0 {
+		return ""
+	}
+	return lipgloss.NewStyle().MarginTop(1).Render("also editing: " + strings.Join(others, "  "))
+}
+
+// editorView renders the textarea with the cursors of the other sessions editing the note drawn in it
+func (m Model) editorView() string {
+	if m.Collab.NoteID == 0 || m.TextareaView.Textarea.Value() != m.Collab.Text {
+		return m.TextareaView.View()
+	}
+	lines := strings.Split(m.TextareaView.Textarea.View(), "\n")
+	text := []rune(m.Collab.Text)
+	for _, c := range m.Collab.Cursors {
+		if m.Peer != nil && c.PeerID == m.Peer.ID {
+			continue
+		}
+		row, col, ok := cursorCell(m.TextareaView.Textarea, m.Collab.Text, c.Offset)
+		if !ok || row >= len(lines) {
+			continue
+		}
+		char := " "
+		if c.Offset < len(text) && text[c.Offset] != '\n' {
+			char = string(text[c.Offset])
+		}
+		cell := lipgloss.NewStyle().Foreground(c.Color).Reverse(true).Render(char)
+		lines[row] = ansi.Truncate(lines[row], col, "") + cell + skipCells(lines[row], col+ansi.StringWidth(char))
+	}
+	return styles.TextareaStyle.Render(strings.Join(lines, "\n"))
+}
+
+// cursorMarker is the colour of the cursor in a copy of the textarea, told apart from anything the textarea draws
+var cursorMarker = lipgloss.NewStyle().Foreground(lipgloss.Color("#010203"))
+
+// cursorCell finds where a rune offset into the text shows in the textarea's view. The textarea
+// keeps its scrolling to itself, so a copy of it with its cursor moved there is drawn and the
+// line holding the cursor looked for.
+func cursorCell(t textarea.Model, text string, offset int) (int, int, bool) {
+	marker := cursorMarker.Inline(true).Reverse(true).Render("x")
+	marker = marker[:strings.Index(marker, "x")]
+	if marker == "" {
+		return 0, 0, false
+	}
+	row, col := lineCol(text, offset)
+	for t.Line() > row {
+		t.CursorUp()
+	}
+	for t.Line() < row {
+		t.CursorDown()
+	}
+	t.SetCursor(col)
+	t.Cursor.Style = cursorMarker
+	t.Cursor.Blink = false
+	for i, line := range strings.Split(t.View(), "\n") {
+		if strings.Contains(line, marker) {
+			return i, ansi.StringWidth(t.Prompt) + t.LineInfo().CharOffset, true
+		}
+	}
+	return 0, 0, false
+}
+
+// skipCells drops the first n cells of a styled line, keeping its escape sequences
+func skipCells(line string, n int) string {
+	var out strings.Builder
+	width := 0
+	for i := 0; i < len(line); {
+		if line[i] == '\x1b' && i+1 < len(line) && line[i+1] == '[' {
+			j := i + 2
+			for j < len(line) && (line[j] < 0x40 || line[j] > 0x7e) {
+				j++
+			}
+			j = min(j+1, len(line))
+			out.WriteString(line[i:j])
+			i = j
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if width >= n {
+			out.WriteString(line[i : i+size])
+		}
+		width += ansi.StringWidth(string(r))
+		i += size
+	}
+	return out.String()
+}
+
+// cursorOffset returns the textarea cursor as a rune offset into its value
+func cursorOffset(t textarea.Model) int {
+	lines := strings.Split(t.Value(), "\n")
+	offset := 0
+	for _, line := range lines[:min(t.Line(), len(lines))] {
+		offset += len([]rune(line)) + 1
+	}
+	li := t.LineInfo()
+	return offset + li.StartColumn + li.ColumnOffset
+}
+
+// setTextareaValue replaces the textarea content and puts the cursor at the given rune offset
+func setTextareaValue(t *textarea.Model, text string, offset int) {
+	t.SetValue(text)
+	row, col := lineCol(text, offset)
+	for t.Line() > row {
+		t.CursorUp()
+	}
+	t.SetCursor(col)
+}
+
+// lineCol converts a rune offset into a line and column
+func lineCol(text string, offset int) (int, int) {
+	line, col := 0, 0
+	for i, r := range []rune(text) {
+		if i == offset {
+			break
+		}
+		if r == '\n' {
+			line++
+			col = 0
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
@@ -0,0 +1,453 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/export"
+	"notion_ssh_app/internal/app/gitstore"
+	"notion_ssh_app/internal/app/importer"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/render"
+)
+
+// verifiedKeyExtension holds the fingerprint of the SSH key a connection signed in with
+const verifiedKeyExtension = "notion-ssh-verified-key"
+
+// Authentication lets any client in, accounts are checked by the login form, while keeping
+// track of the SSH key a client signed in with. Clients also get asked about keys they only
+// offer, so a key counts only when the permissions of the connection, which come from the
+// method that succeeded, carry its fingerprint. Clients without keys get in interactively.
+func Authentication() ssh.Option {
+	return func(s *ssh.Server) error {
+		s.ServerConfigCallback = func(ssh.Context) *gossh.ServerConfig {
+			return &gossh.ServerConfig{
+				PublicKeyCallback: func(_ gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+					return &gossh.Permissions{Extensions: map[string]string{verifiedKeyExtension: gossh.FingerprintSHA256(key)}}, nil
+				},
+			}
+		}
+		return wish.WithKeyboardInteractiveAuth(func(ssh.Context, gossh.KeyboardInteractiveChallenge) bool { return true })(s)
+	}
+}
+
+// keyFingerprint identifies the SSH key a session signed in with the way ssh-keygen -l prints
+// it, empty for sessions that got in another way
+func keyFingerprint(s ssh.Session) string {
+	conn, ok := s.Context().Value(ssh.ContextKeyConn).(*gossh.ServerConn)
+	if !ok || conn.Permissions == nil {
+		return ""
+	}
+	return conn.Permissions.Extensions[verifiedKeyExtension]
+}
+
+// sessionUser returns the account the session's SSH key was linked to from the TUI
+func sessionUser(s ssh.Session) (int, error) {
+	fingerprint := keyFingerprint(s)
+	if fingerprint == "" {
+		return 0, db.ErrUnknownKey
+	}
+	userID, _, err := db.UserByKey(fingerprint)
+	return userID, err
+}
+
+// CommandMiddleware runs commands given to ssh, like `ssh host export > notes.zip`, and hands
+// every other session on to the next middleware. It must come after the TUI middleware in
+// wish.WithMiddleware so that it runs first.
+func CommandMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			command := s.Command()
+			if len(command) == 0 {
+				next(s)
+				return
+			}
+			switch command[0] {
+			case "export":
+				runExport(s)
+			case "import":
+				runImport(s, command[1:])
+			case "html":
+				runHTML(s, command[1:])
+			case "backup":
+				runBackup(s, command[1:])
+			case "restore":
+				runRestore(s, command[1:])
+			case "attach":
+				runAttach(s, command[1:])
+			case "git-upload-pack":
+				runUploadPack(s, command[1:])
+			case "git-receive-pack":
+				wish.Fatalln(s, "your notes repository is read-only, edit your notes in the app")
+			default:
+				next(s)
+			}
+		}
+	}
+}
+
+// identify returns the session's user, telling them how to link their key when it is unknown
+func identify(s ssh.Session) (int, bool) {
+	userID, err := sessionUser(s)
+	if err == db.ErrUnknownKey {
+		wish.Fatalln(s, "log in to the app with this SSH key and link it from the export dialog (ctrl+x), then run the command again")
+		return 0, false
+	}
+	if err != nil {
+		fmt.Println("Error identifying ssh key:", err)
+		wish.Fatalln(s, "could not look up your account, please try again")
+		return 0, false
+	}
+	return userID, true
+}
+
+// findWorkspace returns the ID of the user's workspace of that name, 0 for an empty name
+func findWorkspace(s ssh.Session, userID int, name string) (int, bool) {
+	if name == "" {
+		return 0, true
+	}
+	workspaces, err := db.FetchWorkspaces(userID)
+	if err != nil {
+		fmt.Println("Error fetching workspaces:", err)
+		wish.Fatalln(s, "could not look up your workspaces, please try again")
+		return 0, false
+	}
+	for _, w := range workspaces {
+		if strings.EqualFold(w.Name, name) {
+			return w.ID, true
+		}
+	}
+	wish.Fatalln(s, "you are not a member of a workspace named "+name)
+	return 0, false
+}
+
+// runExport streams the zip of the user's notes to the session's stdout
+func runExport(s ssh.Session) {
+	if _, _, pty := s.Pty(); pty {
+		wish.Fatalln(s, "export writes a zip archive, run it without -t: ssh ... export > "+export.Filename)
+		return
+	}
+	userID, ok := identify(s)
+	if !ok {
+		return
+	}
+	if err := export.Zip(s, userID); err != nil {
+		fmt.Println("Error exporting notes:", err)
+		wish.Fatalln(s, "the export failed, please try again")
+		return
+	}
+	s.Exit(0)
+}
+
+// runImport reads an archive of notes from stdin, like `ssh host import --dry-run < vault.zip`,
+// and prints what it creates, or would create with --dry-run
+func runImport(s ssh.Session, args []string) {
+	var formats []string
+	for _, f := range importer.Formats {
+		formats = append(formats, string(f))
+	}
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(s.Stderr())
+	dryRun := flags.Bool("dry-run", false, "only show what would be imported")
+	from := flags.String("from", "", "tool the archive comes from: "+strings.Join(formats, ", ")+" (guessed when empty)")
+	workspaceName := flags.String("workspace", "", "workspace to import into instead of your personal notes")
+	if err := flags.Parse(args); err != nil {
+		s.Exit(2)
+		return
+	}
+
+	userID, ok := identify(s)
+	if !ok {
+		return
+	}
+	workspaceID, ok := findWorkspace(s, userID, *workspaceName)
+	if !ok {
+		return
+	}
+
+	files, err := importer.ReadArchive(s)
+	if err != nil {
+		wish.Fatalln(s, "could not read the archive: "+err.Error())
+		return
+	}
+	format := importer.Detect(files)
+	if *from != "" {
+		format = importer.Format(*from)
+	}
+	switch format {
+	case importer.FormatNotion, importer.FormatObsidian, importer.FormatMarkdown:
+	default:
+		wish.Fatalln(s, "unknown format "+*from+", use one of "+strings.Join(formats, ", "))
+		return
+	}
+	plan := importer.Build(files, format)
+	if len(plan.Notes) == 0 && len(plan.Collections) == 0 {
+		wish.Fatalln(s, "found no notes in the archive")
+		return
+	}
+
+	if *dryRun {
+		wish.Printf(s, "Dry run of a %s import, nothing was saved:\n%sRun again without --dry-run to import.\n", format, plan.Summary())
+		s.Exit(0)
+		return
+	}
+	if err := db.ImportNotes(userID, workspaceID, plan.Notes, plan.Collections); err != nil {
+		fmt.Println("Error importing notes:", err)
+		if err == db.ErrForbidden {
+			wish.Fatalln(s, "guests cannot add notes to "+*workspaceName)
+			return
+		}
+		wish.Fatalln(s, "the import failed and nothing was saved, please try again")
+		return
+	}
+	gitstore.Changed(userID, userID, "Import from "+string(format))
+	wish.Printf(s, "Imported from %s:\n%s", format, plan.Summary())
+	s.Exit(0)
+}
+
+// maxBackupSize bounds the backups restore reads from stdin
+const maxBackupSize = 256 << 20
+
+// runBackup writes a JSON backup of the personal notes, or of a workspace the user manages,
+// like `ssh host backup --workspace Team > team.json`
+func runBackup(s ssh.Session, args []string) {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	flags.SetOutput(s.Stderr())
+	workspaceName := flags.String("workspace", "", "workspace to back up instead of your personal notes, which you must manage")
+	if err := flags.Parse(args); err != nil {
+		s.Exit(2)
+		return
+	}
+	if _, _, pty := s.Pty(); pty {
+		wish.Fatalln(s, "backup writes JSON for restore, run it without -t: ssh ... backup > backup.json")
+		return
+	}
+	userID, ok := identify(s)
+	if !ok {
+		return
+	}
+	workspaceID, ok := findWorkspace(s, userID, *workspaceName)
+	if !ok {
+		return
+	}
+
+	b, err := db.ReadBackup(userID, workspaceID)
+	if err == db.ErrForbidden {
+		wish.Fatalln(s, "only owners and admins can back up "+*workspaceName)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error reading backup:", err)
+		wish.Fatalln(s, "the backup failed, please try again")
+		return
+	}
+	encoder := json.NewEncoder(s)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(b); err != nil {
+		fmt.Println("Error writing backup:", err)
+		s.Exit(1)
+		return
+	}
+	s.Exit(0)
+}
+
+// runRestore reads a JSON backup from stdin and recreates it with new IDs, a workspace backup
+// as a new workspace, like `ssh host restore --dry-run < team.json`
+func runRestore(s ssh.Session, args []string) {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.SetOutput(s.Stderr())
+	dryRun := flags.Bool("dry-run", false, "check the backup and show what would be restored")
+	name := flags.String("name", "", "name of the restored workspace, the backed up name when empty")
+	if err := flags.Parse(args); err != nil {
+		s.Exit(2)
+		return
+	}
+	userID, ok := identify(s)
+	if !ok {
+		return
+	}
+
+	var b models.Backup
+	if err := json.NewDecoder(io.LimitReader(s, maxBackupSize)).Decode(&b); err != nil {
+		wish.Fatalln(s, "could not read the backup: "+err.Error())
+		return
+	}
+	if err := b.Verify(); err != nil {
+		wish.Fatalln(s, "the backup cannot be restored: "+err.Error())
+		return
+	}
+	report, err := db.RestoreBackup(userID, b, strings.TrimSpace(*name), *dryRun)
+	if err != nil {
+		fmt.Println("Error restoring backup:", err)
+		wish.Fatalln(s, "the restore failed and nothing was saved, please try again")
+		return
+	}
+
+	if !*dryRun {
+		gitstore.Changed(userID, userID, "Restore a backup")
+	}
+
+	into := "your personal notes"
+	if report.Workspace != "" {
+		into = "the new workspace " + report.Workspace
+	}
+	if *dryRun {
+		wish.Printf(s, "Dry run, nothing was saved. Restoring into %s would create:\n", into)
+	} else {
+		wish.Printf(s, "Restored into %s:\n", into)
+	}
+	wish.Printf(s, "%d notes, %d databases, %d comments, %d templates\n", report.Notes, report.Collections, report.Comments, report.Templates)
+	if report.Undated > 0 {
+		wish.Printf(s, "%d daily notes became regular notes, their day already has one\n", report.Undated)
+	}
+	if len(report.Others) > 0 {
+		wish.Printf(s, "Not given access: %s\nTheir notes and comments are yours, share notes or invite them to the workspace again\n", strings.Join(report.Others, ", "))
+	}
+	s.Exit(0)
+}
+
+// runHTML writes a note as a standalone HTML page, like `ssh host html --print "Weekly sync" > sync.html`
+func runHTML(s ssh.Session, args []string) {
+	flags := flag.NewFlagSet("html", flag.ContinueOnError)
+	flags.SetOutput(s.Stderr())
+	printLayout := flags.Bool("print", false, "lay the page out for printing or saving as PDF")
+	if err := flags.Parse(args); err != nil {
+		s.Exit(2)
+		return
+	}
+	if flags.NArg() == 0 {
+		wish.Fatalln(s, "usage: html [--print] <note title or id>")
+		return
+	}
+	userID, ok := identify(s)
+	if !ok {
+		return
+	}
+
+	item, err := db.FindItem(strings.Join(flags.Args(), " "), userID)
+	if err == db.ErrForbidden {
+		wish.Fatalln(s, "no note you can read is called "+strings.Join(flags.Args(), " "))
+		return
+	}
+	if err != nil {
+		fmt.Println("Error fetching note:", err)
+		wish.Fatalln(s, "could not load the note, please try again")
+		return
+	}
+	if item.Locked() {
+		wish.Fatalln(s, "the note is private, read it in the app with your passphrase")
+		return
+	}
+	page := render.Page{Title: item.ItemTitle, Description: item.Desc, Content: item.Content, Print: *printLayout}
+	if err := render.Write(s, page); err != nil {
+		fmt.Println("Error rendering note:", err)
+		wish.Fatalln(s, "could not render the note")
+		return
+	}
+	s.Exit(0)
+}
+
+// runAttach reads a file from stdin and attaches it to a note, like
+// `ssh host attach --name photo.png "Weekly sync" < photo.png`
+func runAttach(s ssh.Session, args []string) {
+	flags := flag.NewFlagSet("attach", flag.ContinueOnError)
+	flags.SetOutput(s.Stderr())
+	name := flags.String("name", "", "file name of the attachment")
+	if err := flags.Parse(args); err != nil {
+		s.Exit(2)
+		return
+	}
+	if flags.NArg() == 0 || attachmentName(*name) == "" {
+		wish.Fatalln(s, "usage: attach --name <file name> <note title or id> < file")
+		return
+	}
+	if _, _, pty := s.Pty(); pty {
+		wish.Fatalln(s, "attach reads the file from stdin, run it without -t: ssh ... attach --name "+*name+" <note> < "+*name)
+		return
+	}
+	userID, ok := identify(s)
+	if !ok {
+		return
+	}
+
+	item, err := db.FindItem(strings.Join(flags.Args(), " "), userID)
+	if err == db.ErrForbidden {
+		wish.Fatalln(s, "no note you can read is called "+strings.Join(flags.Args(), " "))
+		return
+	}
+	if err != nil {
+		fmt.Println("Error fetching note:", err)
+		wish.Fatalln(s, "could not load the note, please try again")
+		return
+	}
+	a, err := storeAttachment(userID, item.ID, *name, -1, s)
+	switch {
+	case err == db.ErrForbidden:
+		wish.Fatalln(s, "only editors of "+item.Title()+" can attach files to it")
+		return
+	case err == db.ErrPrivateNote:
+		wish.Fatalln(s, "private notes cannot have attachments, they are stored unencrypted")
+		return
+	case err == db.ErrQuotaExceeded:
+		wish.Fatalln(s, "that does not fit in what is left of your "+formatSize(db.AttachmentQuota())+" of attachments")
+		return
+	case err != nil:
+		fmt.Println("Error storing attachment:", err)
+		wish.Fatalln(s, "the upload failed, please try again")
+		return
+	}
+	wish.Printf(s, "Attached %s (%s) to %s, link to it from the note with %s\n", a.Name, formatSize(a.Size), item.Title(), attachmentRef(a))
+	s.Exit(0)
+}
+
+// runUploadPack serves `git clone ssh://host:23236/notes.git`, the repository of the user's
+// own notes, brought up to date first
+func runUploadPack(s ssh.Session, args []string) {
+	if !gitstore.Enabled() {
+		wish.Fatalln(s, "git storage is not enabled on this server")
+		return
+	}
+	if len(args) != 1 || strings.TrimSuffix(strings.TrimLeft(args[0], "/~"), ".git")+".git" != gitstore.RepoName {
+		wish.Fatalln(s, "the only repository is "+gitstore.RepoName)
+		return
+	}
+	userID, ok := identify(s)
+	if !ok {
+		return
+	}
+	if err := gitstore.Sync(userID, userID, "Sync notes"); err != nil {
+		fmt.Println("Error committing notes to git:", err)
+		wish.Fatalln(s, "could not prepare your repository, please try again")
+		return
+	}
+
+	cmd := exec.CommandContext(s.Context(), "git-upload-pack", gitstore.RepoPath(userID))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = s, s, s.Stderr()
+	cmd.Env = os.Environ()
+	for _, env := range s.Environ() {
+		// Clients ask for protocol v2 this way
+		if strings.HasPrefix(env, "GIT_PROTOCOL=") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			s.Exit(exit.ExitCode())
+			return
+		}
+		fmt.Println("Error running git-upload-pack:", err)
+		s.Exit(1)
+		return
+	}
+	s.Exit(0)
+}
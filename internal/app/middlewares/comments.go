@@ -0,0 +1,228 @@
+package middlewares
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/notify"
+)
+
+// Define the comments pane model struct, shown next to the viewer
+type CommentsViewModel struct {
+	Comments     []db.Comment
+	Selected     int // index into the visible threads
+	ShowResolved bool
+	Form         *huh.Form // new comment or reply being written, nil otherwise
+	ReplyTo      int       // thread the form replies to, 0 for a new thread
+	Status       string
+}
+
+// threads groups the visible comments by thread, first comment first
+func (m CommentsViewModel) threads() [][]db.Comment {
+	var threads [][]db.Comment
+	for _, c := range m.Comments {
+		if c.ParentID == 0 {
+			if c.Resolved && !m.ShowResolved {
+				continue
+			}
+			threads = append(threads, []db.Comment{c})
+			continue
+		}
+		if len(threads) > 0 && threads[len(threads)-1][0].ID == c.ParentID {
+			threads[len(threads)-1] = append(threads[len(threads)-1], c)
+		}
+	}
+	return threads
+}
+
+// loadComments fetches the comments of the note in the viewer
+func (m Model) loadComments() Model {
+	comments, err := db.FetchComments(m.ListItemView.ID, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching comments:", err)
+	}
+	m.Comments = CommentsViewModel{Comments: comments, ShowResolved: m.Comments.ShowResolved}
+	return m
+}
+
+// updateComments handles the comment keys of the viewer, reporting whether the key was one of them
+func (m Model) updateComments(msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	threads := m.Comments.threads()
+	canComment := m.ListItemView.Role >= models.RoleCommenter
+
+	switch msg.String() {
+	case "]":
+		m.Comments.Selected = min(m.Comments.Selected+1, max(len(threads)-1, 0))
+	case "[":
+		m.Comments.Selected = max(m.Comments.Selected-1, 0)
+	case "a":
+		m.Comments.ShowResolved = !m.Comments.ShowResolved
+		m.Comments.Selected = 0
+	case "c":
+		if !canComment {
+			return m, nil, true
+		}
+		m.Comments.ReplyTo = 0
+		m.Comments.Form = huh.NewForm(huh.NewGroup(
+			huh.NewInput().Title("Lines (e.g. 3 or 3-7)").Key("lines").Validate(validateLines),
+			huh.NewText().Title("Comment, @name to mention").Key("body"),
+		))
+		return m, m.Comments.Form.Init(), true
+	case "r":
+		if !canComment || len(threads) == 0 {
+			return m, nil, true
+		}
+		m.Comments.ReplyTo = threads[m.Comments.Selected][0].ID
+		m.Comments.Form = huh.NewForm(huh.NewGroup(
+			huh.NewText().Title("Reply, @name to mention").Key("body"),
+		))
+		return m, m.Comments.Form.Init(), true
+	case "x":
+		if !canComment || len(threads) == 0 {
+			return m, nil, true
+		}
+		root := threads[m.Comments.Selected][0]
+		if err := db.SetCommentResolved(m.ListItemView.ID, root.ID, m.User.user_id, !root.Resolved); err != nil {
+			fmt.Println("Error resolving comment:", err)
+			return m, nil, true
+		}
+		m = m.loadComments()
+		m.Comments.Selected = min(m.Comments.Selected, max(len(m.Comments.threads())-1, 0))
+	default:
+		return m, nil, false
+	}
+	return m, nil, true
+}
+
+// updateCommentForm runs the comment form and posts the comment once submitted
+func (m Model) updateCommentForm(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" {
+		m.Comments.Form = nil
+		return m, nil
+	}
+
+	f, cmd := m.Comments.Form.Update(msg)
+	m.Comments.Form = f.(*huh.Form)
+	if m.Comments.Form.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	c := db.Comment{ParentID: m.Comments.ReplyTo, Body: strings.TrimSpace(m.Comments.Form.GetString("body"))}
+	if c.ParentID == 0 {
+		c.LineStart, c.LineEnd, _ = parseLines(m.Comments.Form.GetString("lines"))
+	}
+	m.Comments.Form = nil
+	if c.Body == "" {
+		return m, nil
+	}
+	c, err := db.AddComment(m.ListItemView.ID, m.User.user_id, c)
+	if err != nil {
+		fmt.Println("Error adding comment:", err)
+		m.Comments.Status = "Could not post the comment, please try again"
+		return m, nil
+	}
+	notify.CommentPosted(m.ListItemView.ID, m.ListItemView.Subject(), m.User.user_id, m.User.email, c)
+	return m.loadComments(), nil
+}
+
+// parseLines reads "3" or "3-7" into a 1-based inclusive line range
+func parseLines(s string) (int, int, error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	start, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil || start < 1 {
+		return 0, 0, fmt.Errorf("enter a line number or a range like 3-7")
+	}
+	end := start
+	if isRange {
+		end, err = strconv.Atoi(strings.TrimSpace(to))
+		if err != nil || end < start {
+			return 0, 0, fmt.Errorf("enter a line number or a range like 3-7")
+		}
+	}
+	return start, end, nil
+}
+
+func validateLines(s string) error {
+	_, _, err := parseLines(s)
+	return err
+}
+
+// Renders the threads, the selected one highlighted, with the lines they are about
+func (m CommentsViewModel) View(content string, height int) string {
+	accent := lipgloss.Color("#7571F9")
+	faint := lipgloss.NewStyle().Faint(true)
+	pane := lipgloss.NewStyle().Width(44).Padding(0, 1)
+
+	if m.Form != nil {
+		return pane.Render(m.Form.View() + "\n" + faint.Render("esc: cancel"))
+	}
+
+	lines := strings.Split(content, "\n")
+	var blocks []string
+	for index, thread := range m.threads() {
+		root := thread[0]
+		anchor := fmt.Sprintf("L%d", root.LineStart)
+		if root.LineEnd != root.LineStart {
+			anchor += fmt.Sprintf("-%d", root.LineEnd)
+		}
+		if root.Resolved {
+			anchor += " · resolved"
+		}
+		block := []string{lipgloss.NewStyle().Bold(true).Foreground(accent).Render(anchor)}
+		if root.LineStart <= len(lines) {
+			block = append(block, faint.Render("> "+truncate(lines[root.LineStart-1], 38)))
+		}
+		for i, c := range thread {
+			prefix := ""
+			if i > 0 {
+				prefix = "↳ "
+			}
+			block = append(block, prefix+lipgloss.NewStyle().Bold(true).Render(c.Author)+" "+faint.Render(ago(c.CreatedAt)), prefix+c.Body)
+		}
+
+		style := lipgloss.NewStyle().Width(40).Border(lipgloss.HiddenBorder(), false, false, false, true)
+		if index == m.Selected {
+			style = style.Border(lipgloss.ThickBorder(), false, false, false, true).BorderForeground(accent)
+		}
+		blocks = append(blocks, style.Render(strings.Join(block, "\n")))
+	}
+
+	if len(blocks) == 0 {
+		blocks = append(blocks, faint.Render("No comments yet."))
+	}
+	help := faint.Render("c: comment • r: reply • x: resolve • [/]: select • a: show resolved")
+	body := strings.Join(blocks, "\n\n")
+	return pane.Render(lipgloss.JoinVertical(lipgloss.Left, lipgloss.NewStyle().MaxHeight(max(height-3, 3)).Render(body), m.Status, help))
+}
+
+// truncate shortens s to n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// ago describes how long ago t was, roughly
+func ago(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return t.Format("Jan 2")
+	}
+}
@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/merge"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/styles"
+)
+
+// Define the conflict view model struct, shown when a save was rejected as stale
+type ConflictViewModel struct {
+	Base   models.ListItemViewModel // the note as it was when the editor was opened
+	Mine   models.ListItemViewModel // the rejected edit
+	Theirs models.ListItemViewModel // what is stored in the database now
+}
+
+// Renders both versions of the note side by side along with the available choices
+func (m ConflictViewModel) View() string {
+	pane := lipgloss.NewStyle().
+		Width(50).
+		Height(16).
+		MaxHeight(18).
+		Padding(0, 1).
+		Border(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("#7571F9"))
+
+	header := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9"))
+
+	mine := pane.Render(header.Render("mine") + "\n\n" + models.EditorText(m.Mine))
+	theirs := pane.Render(header.Render(fmt.Sprintf("theirs (version %d)", m.Theirs.Version)) + "\n\n" + models.EditorText(m.Theirs))
+
+	return lipgloss.JoinVertical(lipgloss.Center,
+		styles.Logostyle,
+		"This note was saved by another session while you were editing it.",
+		lipgloss.JoinHorizontal(lipgloss.Top, mine, theirs),
+		"m: keep mine • t: keep theirs • g: merge in the editor • esc: back to the editor",
+	)
+}
+
+// updateConflict resolves a rejected save according to the key pressed
+func (m Model) updateConflict(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "m":
+		// Overwrite their save, the conflict view comes back if it moved again meanwhile
+		base := m.Conflict.Theirs
+		m.Editing = &base
+		return m.saveEditedItem(m.Conflict.Mine)
+
+	case "t":
+		// Drop the edit and show the stored version
+		m = m.leaveCollab()
+		m.replaceItem(m.Conflict.Theirs)
+		m.Editing = nil
+		m.TextareaView.ShowTextArea = false
+		m.CurrentView = 1
+		return m, nil
+
+	case "g":
+		// Merge both edits against the common base and let the user review the result
+		merged, conflicted := mergeItems(m.Conflict.Base, m.Conflict.Mine, m.Conflict.Theirs)
+		base := m.Conflict.Theirs
+		m.Editing = &base
+		m = m.openEditor(merged)
+		if conflicted {
+			m.TextareaView.Status = "Merged with conflicts, resolve the <<<<<<< markers before saving"
+		}
+		return m, nil
+
+	case "esc":
+		// Keep editing, the next save will conflict again
+		return m.openEditor(models.EditorText(m.Conflict.Mine)), nil
+	}
+	return m, nil
+}
+
+// mergeItems runs a three-way merge over the editor layout of the notes
+func mergeItems(base, mine, theirs models.ListItemViewModel) (string, bool) {
+	return merge.ThreeWay(models.EditorText(base), models.EditorText(mine), models.EditorText(theirs))
+}
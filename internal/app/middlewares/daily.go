@@ -0,0 +1,137 @@
+package middlewares
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/ssh"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/gitstore"
+	"notion_ssh_app/internal/app/models"
+)
+
+// journalTemplate prefills daily notes of users without a note titled db.DailyTemplateTitle
+const journalTemplate = `## Plan
+
+- [ ]
+
+## Log
+
+## Notes
+`
+
+// Define the journal model struct, listing every daily note of the user
+type JournalViewModel struct {
+	List list.Model
+}
+
+// sessionLocation is the time zone the client sent in TZ (ssh -o SendEnv=TZ), the server's otherwise
+func sessionLocation(s ssh.Session) *time.Location {
+	for _, env := range s.Environ() {
+		if name, ok := strings.CutPrefix(env, "TZ="); ok {
+			if loc, err := time.LoadLocation(name); err == nil {
+				return loc
+			}
+		}
+	}
+	return time.Local
+}
+
+// location is the user's time zone, in which days start and end
+func (m Model) location() *time.Location {
+	if m.Location == nil {
+		return time.Local
+	}
+	return m.Location
+}
+
+// openDailyNote shows the user's note for day in the viewer, creating it from their template
+func (m Model) openDailyNote(day time.Time) Model {
+	template, err := db.DailyTemplate(m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching daily template:", err)
+	}
+	if template == "" {
+		template = journalTemplate
+	}
+	item, created, err := db.DailyNote(m.User.user_id, day, template)
+	if err != nil {
+		fmt.Println("Error opening daily note:", err)
+		return m
+	}
+	if created {
+		gitstore.NoteSaved(item.ID, m.User.user_id, "Add "+item.ItemTitle)
+	}
+	return m.openViewer(item)
+}
+
+// stepDailyNote moves from the daily note in the viewer to the previous or next one
+func (m Model) stepDailyNote(next bool) Model {
+	item, ok, err := db.AdjacentDailyNote(m.User.user_id, m.ListItemView.Daily, next)
+	if err != nil {
+		fmt.Println("Error fetching daily note:", err)
+		return m
+	}
+	if !ok {
+		return m
+	}
+	back := m.ViewerBack
+	m = m.openViewer(item)
+	m.ViewerBack = back
+	return m
+}
+
+// openJournal lists the user's daily notes, newest first
+func (m Model) openJournal() (tea.Model, tea.Cmd) {
+	items, err := db.FetchDailyNotes(m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching daily notes:", err)
+		return m, nil
+	}
+	var listItems []list.Item
+	for _, item := range items {
+		listItems = append(listItems, item)
+	}
+
+	l := list.New(listItems, list.NewDefaultDelegate(), 50, max(m.Dimensions.TotalHeight-10, 10))
+	l.Title = "journal -> "
+	m.Journal = JournalViewModel{List: l}
+	m.CurrentView = journalView
+	return m, nil
+}
+
+// updateJournal opens the chosen daily note, or today's
+func (m Model) updateJournal(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && m.Journal.List.FilterState() != list.Filtering {
+		switch key.String() {
+		case "esc":
+			m.CurrentView = 1
+			return m, nil
+		case "t":
+			m = m.openDailyNote(time.Now().In(m.location()))
+			m.ViewerBack = journalView
+			return m, nil
+		case "enter":
+			if item, ok := m.Journal.List.SelectedItem().(models.ListItemViewModel); ok {
+				m = m.openViewer(item)
+				m.ViewerBack = journalView
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Journal.List, cmd = m.Journal.List.Update(msg)
+	return m, cmd
+}
+
+// Renders the journal list
+func (m JournalViewModel) View() string {
+	help := lipgloss.NewStyle().Faint(true).Render("enter: open • t: today • esc: back")
+	return lipgloss.JoinVertical(lipgloss.Left, m.List.View(), help)
+}
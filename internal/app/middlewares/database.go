@@ -0,0 +1,607 @@
+package middlewares
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/gitstore"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/styles"
+)
+
+// What the databases view is showing
+const (
+	databasePicking = iota
+	databaseCreating
+	databaseTable
+	databaseEditingCell
+	databaseAddingRow
+	databaseAddingProperty
+	databaseFiltering
+	databaseBoard
+)
+
+// Define the databases model struct: a picker, then the table or board of the chosen database
+type DatabaseViewModel struct {
+	List       list.Model
+	Form       *huh.Form
+	Mode       int
+	Collection models.Collection
+	Rows       []models.Row
+	Row        int // cursor into the visible rows
+	Column     int // cursor into the columns, 0 being the page title
+	SortColumn int // column the rows are sorted by counted from 1, the page title being 1, 0 for none
+	SortDesc   bool
+	Filter     *models.Filter
+	Board      BoardViewModel
+	Status     string
+}
+
+// collectionItem makes a database selectable in the picker
+type collectionItem struct {
+	models.Collection
+}
+
+func (i collectionItem) FilterValue() string { return i.Name }
+func (i collectionItem) Title() string       { return i.Name }
+func (i collectionItem) Description() string { return "you are " + i.Role.String() }
+
+// openDatabases shows the databases of the current workspace
+func (m Model) openDatabases() (tea.Model, tea.Cmd) {
+	collections, err := db.FetchCollections(m.User.user_id, m.Workspace.ID)
+	if err != nil {
+		fmt.Println("Error fetching databases:", err)
+		return m, nil
+	}
+	var items []list.Item
+	for _, c := range collections {
+		items = append(items, collectionItem{c})
+	}
+
+	l := list.New(items, list.NewDefaultDelegate(), 50, 16)
+	l.Title = "databases -> "
+	l.SetFilteringEnabled(false)
+	m.Database = DatabaseViewModel{List: l}
+	m.CurrentView = databaseView
+	return m, nil
+}
+
+// openCollection loads a database and its pages into the table
+func (m Model) openCollection(id int) Model {
+	c, err := db.FetchCollection(id, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching database:", err)
+		m.Database.Status = "Could not open the database"
+		return m
+	}
+	rows, err := db.CollectionRows(id, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching database rows:", err)
+		m.Database.Status = "Could not open the database"
+		return m
+	}
+	m.Database.Collection = c
+	m.Database.Rows = rows
+	m.Database.Row = min(m.Database.Row, max(len(m.Database.visibleRows())-1, 0))
+	m.Database.Column = min(m.Database.Column, len(c.Properties))
+
+	// Coming back from a page keeps the board open, with the property as it is stored now
+	if m.Database.Mode == databaseBoard {
+		for _, p := range c.Properties {
+			if p.ID == m.Database.Board.Property.ID {
+				m.Database.Board.Property = p
+				return m.fillBoard()
+			}
+		}
+	}
+	m.Database.Mode = databaseTable
+	return m
+}
+
+// visibleRows applies the filter and sort to the rows, without touching Rows
+func (m DatabaseViewModel) visibleRows() []models.Row {
+	var rows []models.Row
+	for _, row := range m.Rows {
+		if m.Filter == nil || m.Collection.Match(*m.Filter, row) {
+			rows = append(rows, row)
+		}
+	}
+	if m.SortColumn != 0 {
+		m.Collection.SortRows(rows, collectionColumn(m.SortColumn-1), m.SortDesc)
+	}
+	return rows
+}
+
+// collectionColumn turns a table column, the page title being column 0, into the column
+// numbering of models.Collection, where the title is models.TitleColumn
+func collectionColumn(column int) int {
+	if column == 0 {
+		return models.TitleColumn
+	}
+	return column - 1
+}
+
+// selected returns the row and property under the cursor; the property is nil on the title column
+func (m DatabaseViewModel) selected() (models.Row, *models.Property, bool) {
+	rows := m.visibleRows()
+	if m.Row >= len(rows) {
+		return models.Row{}, nil, false
+	}
+	if m.Column == 0 {
+		return rows[m.Row], nil, true
+	}
+	return rows[m.Row], &m.Collection.Properties[m.Column-1], true
+}
+
+// updateDatabases handles the picker, the table and the forms shown over it
+func (m Model) updateDatabases(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, isKey := msg.(tea.KeyMsg)
+
+	switch m.Database.Mode {
+	case databasePicking:
+		if isKey {
+			switch key.String() {
+			case "esc":
+				m.CurrentView = 1
+				return m, nil
+			case "enter":
+				if selected, ok := m.Database.List.SelectedItem().(collectionItem); ok {
+					m.Database.Row, m.Database.Column, m.Database.SortColumn, m.Database.Filter = 0, 0, 0, nil
+					return m.openCollection(selected.ID), nil
+				}
+				return m, nil
+			case "n":
+				m.Database.Mode = databaseCreating
+				m.Database.Form = huh.NewForm(huh.NewGroup(huh.NewInput().Title("Database name").Key("name")))
+				return m, m.Database.Form.Init()
+			}
+		}
+		var cmd tea.Cmd
+		m.Database.List, cmd = m.Database.List.Update(msg)
+		return m, cmd
+
+	case databaseTable:
+		if isKey {
+			return m.updateTable(key)
+		}
+		return m, nil
+
+	case databaseBoard:
+		if isKey {
+			return m.updateBoard(key)
+		}
+		return m, nil
+	}
+
+	// Every other mode is a form
+	if isKey && key.String() == "esc" {
+		if m.Database.Mode == databaseCreating {
+			m.Database.Mode = databasePicking
+		} else {
+			m.Database.Mode = databaseTable
+		}
+		return m, nil
+	}
+	f, cmd := m.Database.Form.Update(msg)
+	m.Database.Form = f.(*huh.Form)
+	if m.Database.Form.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	switch m.Database.Mode {
+	case databaseCreating:
+		return m.createCollection()
+	case databaseEditingCell:
+		return m.saveCell(), nil
+	case databaseAddingRow:
+		return m.addRow(), nil
+	case databaseAddingProperty:
+		return m.addProperty(), nil
+	default:
+		return m.applyFilter(), nil
+	}
+}
+
+// updateTable moves the cursor and starts the table's forms
+func (m Model) updateTable(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	rows := m.Database.visibleRows()
+	canEdit := m.Database.Collection.Role >= models.RoleEditor
+	m.Database.Status = ""
+
+	switch key.String() {
+	case "esc":
+		return m.openDatabases()
+	case "up", "k":
+		m.Database.Row = max(m.Database.Row-1, 0)
+	case "down", "j":
+		m.Database.Row = min(m.Database.Row+1, max(len(rows)-1, 0))
+	case "left", "h":
+		m.Database.Column = max(m.Database.Column-1, 0)
+	case "right", "l":
+		m.Database.Column = min(m.Database.Column+1, len(m.Database.Collection.Properties))
+
+	case "s":
+		// Cycle the sort of the current column: ascending, descending, unsorted
+		switch {
+		case m.Database.SortColumn != m.Database.Column+1:
+			m.Database.SortColumn, m.Database.SortDesc = m.Database.Column+1, false
+		case !m.Database.SortDesc:
+			m.Database.SortDesc = true
+		default:
+			m.Database.SortColumn = 0
+		}
+
+	case "b":
+		return m.openBoard(), nil
+
+	case "/":
+		m.Database.Mode = databaseFiltering
+		m.Database.Form = huh.NewForm(huh.NewGroup(
+			huh.NewInput().Title("Filter, e.g. Status = Done, Estimate >= 3, title ~ draft (empty to clear)").Key("filter"),
+		))
+		return m, m.Database.Form.Init()
+
+	case "o":
+		if row, _, ok := m.Database.selected(); ok {
+			m = m.openViewer(row.Note)
+			m.ViewerBack = databaseView
+		}
+
+	case "n":
+		if !canEdit {
+			m.Database.Status = "Only editors can add pages"
+			return m, nil
+		}
+		m.Database.Mode = databaseAddingRow
+		m.Database.Form = huh.NewForm(huh.NewGroup(huh.NewInput().Title("Page title").Key("title")))
+		return m, m.Database.Form.Init()
+
+	case "p":
+		if !canEdit {
+			m.Database.Status = "Only editors can add properties"
+			return m, nil
+		}
+		m.Database.Mode = databaseAddingProperty
+		m.Database.Form = m.newPropertyForm()
+		return m, m.Database.Form.Init()
+
+	case "enter", " ":
+		row, p, ok := m.Database.selected()
+		if !ok || row.Note.Role < models.RoleEditor {
+			return m, nil
+		}
+		if p == nil && row.Note.Private {
+			// The title is sealed with its author's passphrase
+			m.Database.Status = "Rename private pages from the viewer"
+			return m, nil
+		}
+		if p != nil && p.Type == models.PropertyCheckbox {
+			// Checkboxes toggle in place
+			value := "true"
+			if row.Values[p.ID] == "true" {
+				value = "false"
+			}
+			return m.setCell(row, p, value), nil
+		}
+		m.Database.Mode = databaseEditingCell
+		m.Database.Form = newCellForm(row, p)
+		return m, m.Database.Form.Init()
+	}
+	return m, nil
+}
+
+// newCellForm edits one cell with the field matching the property type
+func newCellForm(row models.Row, p *models.Property) *huh.Form {
+	if p == nil {
+		return huh.NewForm(huh.NewGroup(huh.NewInput().Title("Title").Key("value").Value(&row.Note.ItemTitle)))
+	}
+
+	value := row.Values[p.ID]
+	title := p.Name + " (" + string(p.Type) + ")"
+	switch p.Type {
+	case models.PropertySelect:
+		options := []huh.Option[string]{huh.NewOption("(empty)", "")}
+		options = append(options, huh.NewOptions(p.Options...)...)
+		return huh.NewForm(huh.NewGroup(huh.NewSelect[string]().Title(title).Key("value").Options(options...).Value(&value)))
+
+	case models.PropertyMultiSelect:
+		values := models.SplitList(value)
+		return huh.NewForm(huh.NewGroup(huh.NewMultiSelect[string]().Title(title).Key("values").Options(huh.NewOptions(p.Options...)...).Value(&values)))
+
+	case models.PropertyDate:
+		title += ", YYYY-MM-DD"
+	case models.PropertyPerson:
+		title += ", email"
+	case models.PropertyRelation:
+		title += ", comma separated page titles"
+		value = p.Display(value)
+	}
+	return huh.NewForm(huh.NewGroup(huh.NewInput().Title(title).Key("value").Value(&value)))
+}
+
+// saveCell stores what the cell form was submitted with
+func (m Model) saveCell() Model {
+	m.Database.Mode = databaseTable
+	row, p, ok := m.Database.selected()
+	if !ok {
+		return m
+	}
+
+	if p == nil {
+		title := strings.TrimSpace(m.Database.Form.GetString("value"))
+		if title == "" {
+			return m
+		}
+		item := row.Note
+		item.ItemTitle = title
+		version, err := db.UpdateItemInDB(item, m.User.user_id)
+		if err == db.ErrVersionConflict {
+			m.Database.Status = "The page was changed by someone else, reloaded"
+			return m.openCollection(m.Database.Collection.ID)
+		}
+		if err != nil {
+			fmt.Println("Error renaming page:", err)
+			m.Database.Status = "Could not rename the page, please try again"
+			return m
+		}
+		item.Version = version
+		m.Database.replaceRow(models.Row{Note: item, Values: row.Values})
+		gitstore.NoteSaved(item.ID, m.User.user_id, "Rename "+row.Note.ItemTitle+" to "+title)
+		return m
+	}
+
+	value := m.Database.Form.GetString("value")
+	if p.Type == models.PropertyMultiSelect {
+		values, _ := m.Database.Form.Get("values").([]string)
+		value = strings.Join(values, ", ")
+	}
+	return m.setCell(row, p, value)
+}
+
+// setCell validates and stores a property value of a row
+func (m Model) setCell(row models.Row, p *models.Property, value string) Model {
+	stored, err := db.SetPropertyValue(row.Note.ID, p.ID, m.User.user_id, value)
+	switch {
+	case err == db.ErrUnknownUser:
+		m.Database.Status = value + " has no account"
+		return m
+	case err == db.ErrForbidden:
+		m.Database.Status = "You cannot edit this page"
+		return m
+	case err != nil:
+		// Validation errors are written for the user
+		m.Database.Status = err.Error()
+		return m
+	}
+
+	gitstore.NoteSaved(row.Note.ID, m.User.user_id, "Set "+p.Name+" of "+row.Note.Subject())
+	values := map[int]string{}
+	for id, v := range row.Values {
+		values[id] = v
+	}
+	values[p.ID] = stored
+	m.Database.replaceRow(models.Row{Note: row.Note, Values: values})
+	return m
+}
+
+// replaceRow swaps the row holding the same page for row
+func (m *DatabaseViewModel) replaceRow(row models.Row) {
+	for index, r := range m.Rows {
+		if r.Note.ID == row.Note.ID {
+			m.Rows[index] = row
+		}
+	}
+}
+
+// createCollection creates the database named in the form and opens it
+func (m Model) createCollection() (tea.Model, tea.Cmd) {
+	name := strings.TrimSpace(m.Database.Form.GetString("name"))
+	m.Database.Mode = databasePicking
+	if name == "" {
+		return m, nil
+	}
+	c, err := db.CreateCollection(name, m.User.user_id, m.Workspace.ID)
+	if err != nil {
+		fmt.Println("Error creating database:", err)
+		m.Database.Status = "Could not create the database, please try again"
+		return m, nil
+	}
+	m.Database.Row, m.Database.Column, m.Database.SortColumn, m.Database.Filter = 0, 0, 0, nil
+	return m.openCollection(c.ID), nil
+}
+
+// addRow creates a page with the title from the form
+func (m Model) addRow() Model {
+	m.Database.Mode = databaseTable
+	title := strings.TrimSpace(m.Database.Form.GetString("title"))
+	if title == "" {
+		return m
+	}
+	row, err := db.AddRow(m.Database.Collection.ID, m.User.user_id, title)
+	if err != nil {
+		fmt.Println("Error adding page:", err)
+		m.Database.Status = "Could not add the page, please try again"
+		return m
+	}
+	m.Database.Rows = append(m.Database.Rows, row)
+	gitstore.NoteSaved(row.Note.ID, m.User.user_id, "Add "+title)
+	return m
+}
+
+// newPropertyForm asks for the name and type of a new column, with options for selects
+// and the target database for relations
+func (m Model) newPropertyForm() *huh.Form {
+	var types []huh.Option[string]
+	for _, t := range models.PropertyTypes {
+		types = append(types, huh.NewOption(string(t), string(t)))
+	}
+	relations := []huh.Option[int]{}
+	if collections, err := db.FetchCollections(m.User.user_id, m.Workspace.ID); err == nil {
+		for _, c := range collections {
+			relations = append(relations, huh.NewOption(c.Name, c.ID))
+		}
+	}
+
+	propertyType := new(string)
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().Title("Property name").Key("name"),
+			huh.NewSelect[string]().Title("Type").Key("type").Options(types...).Value(propertyType),
+		),
+		huh.NewGroup(
+			huh.NewInput().Title("Options, comma separated").Key("options"),
+		).WithHideFunc(func() bool {
+			return *propertyType != string(models.PropertySelect) && *propertyType != string(models.PropertyMultiSelect)
+		}),
+		huh.NewGroup(
+			huh.NewSelect[int]().Title("Related database").Key("relation").Options(relations...),
+		).WithHideFunc(func() bool { return *propertyType != string(models.PropertyRelation) }),
+	)
+}
+
+// addProperty adds the column described by the property form
+func (m Model) addProperty() Model {
+	m.Database.Mode = databaseTable
+	p := models.Property{
+		Name: strings.TrimSpace(m.Database.Form.GetString("name")),
+		Type: models.PropertyType(m.Database.Form.GetString("type")),
+	}
+	if p.Name == "" {
+		return m
+	}
+	if _, taken := m.Database.Collection.Column(p.Name); taken {
+		m.Database.Status = "There already is a column named " + p.Name
+		return m
+	}
+	switch p.Type {
+	case models.PropertySelect, models.PropertyMultiSelect:
+		p.Options = models.SplitList(m.Database.Form.GetString("options"))
+	case models.PropertyRelation:
+		p.RelationID = m.Database.Form.GetInt("relation")
+	}
+
+	if _, err := db.AddProperty(m.Database.Collection.ID, m.User.user_id, p); err != nil {
+		fmt.Println("Error adding property:", err)
+		m.Database.Status = "Could not add the property, please try again"
+		return m
+	}
+	return m.openCollection(m.Database.Collection.ID)
+}
+
+// applyFilter parses the filter form, an empty filter shows every row again
+func (m Model) applyFilter() Model {
+	m.Database.Mode = databaseTable
+	m.Database.Row = 0
+	expr := strings.TrimSpace(m.Database.Form.GetString("filter"))
+	if expr == "" {
+		m.Database.Filter = nil
+		return m
+	}
+	f, err := m.Database.Collection.ParseFilter(expr)
+	if err != nil {
+		m.Database.Status = err.Error()
+		return m
+	}
+	m.Database.Filter = &f
+	return m
+}
+
+// Renders the picker, or the table of the open database with the form shown over it
+func (m DatabaseViewModel) View() string {
+	faint := lipgloss.NewStyle().Faint(true)
+	switch m.Mode {
+	case databasePicking:
+		return lipgloss.JoinVertical(lipgloss.Left, m.List.View(), m.Status, faint.Render("enter: open • n: new database • esc: back"))
+	case databaseCreating:
+		return lipgloss.JoinVertical(lipgloss.Left,
+			styles.FormStyle.Width(50).Height(5).Align(lipgloss.Left).Render(m.Form.View()),
+			faint.Render("esc: back to databases"),
+		)
+	}
+
+	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9")).Render("▦ " + m.Collection.Name)
+	var state []string
+	if m.SortColumn != 0 {
+		order := "ascending"
+		if m.SortDesc {
+			order = "descending"
+		}
+		state = append(state, "sorted by "+m.columnName(m.SortColumn-1)+" "+order)
+	}
+	if m.Filter != nil {
+		state = append(state, "filtered on "+m.columnName(m.Filter.Column+1))
+	}
+
+	var body, help string
+	switch m.Mode {
+	case databaseTable:
+		body = m.table()
+		help = "arrows: move • enter: edit • o: open page • n: new page • p: new property • s: sort • /: filter • b: board • esc: databases"
+	case databaseBoard:
+		body = m.Board.View()
+		help = "arrows: move • < >: move card • enter: open page • b: table"
+	default:
+		body = styles.FormStyle.Width(60).Align(lipgloss.Left).Render(m.Form.View())
+		help = "esc: back to the table"
+	}
+	return lipgloss.JoinVertical(lipgloss.Left,
+		title+faint.Render("  "+strings.Join(state, ", ")),
+		body,
+		m.Status,
+		faint.Render(help),
+	)
+}
+
+// columnName names a table column, the page title being column 0
+func (m DatabaseViewModel) columnName(column int) string {
+	if column == 0 {
+		return "Title"
+	}
+	return m.Collection.Properties[column-1].Name
+}
+
+// table renders the visible rows with the cell under the cursor highlighted
+func (m DatabaseViewModel) table() string {
+	headers := []string{"Title"}
+	for _, p := range m.Collection.Properties {
+		headers = append(headers, p.Name)
+	}
+
+	var cells [][]string
+	for _, row := range m.visibleRows() {
+		line := []string{truncate(row.Note.Title(), 30)}
+		for _, p := range m.Collection.Properties {
+			line = append(line, truncate(p.Display(row.Values[p.ID]), 24))
+		}
+		cells = append(cells, line)
+	}
+	if len(cells) == 0 {
+		return lipgloss.NewStyle().Faint(true).Padding(1, 2).Render("No pages yet, press n to add one")
+	}
+
+	header := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9")).Padding(0, 1)
+	cell := lipgloss.NewStyle().Padding(0, 1)
+	cursor := cell.Copy().Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#7571F9"))
+	return table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("#444444"))).
+		Headers(headers...).
+		Rows(cells...).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			switch {
+			case row == 0:
+				return header
+			case row-1 == m.Row && col == m.Column:
+				return cursor
+			}
+			return cell
+		}).
+		Render()
+}
@@ -0,0 +1,115 @@
+package middlewares
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/export"
+	"notion_ssh_app/internal/app/gitstore"
+	"notion_ssh_app/internal/app/web"
+)
+
+// exportLinkLifetime is how long a download link of the export works
+const exportLinkLifetime = 15 * time.Minute
+
+// Define the export dialog model struct
+type ExportViewModel struct {
+	Link      string // single-use download link, empty when it could not be created
+	ExpiresAt time.Time
+	HasKey    bool  // whether the session signed in with an SSH key
+	KeyLinked bool  // whether `ssh host export` recognises the SSH key of this session
+	GitError  error // why the user's git repository is behind, nil when it is not
+	Status    string
+}
+
+// openExport creates a download link for the user's notes and explains the ssh command
+func (m Model) openExport() (tea.Model, tea.Cmd) {
+	m.Export = ExportViewModel{GitError: gitstore.LastError(m.User.user_id), HasKey: m.SSHKey != ""}
+	m.CurrentView = exportView
+	if m.SSHKey != "" {
+		linked, err := db.KeyLinked(m.User.user_id, m.SSHKey)
+		if err != nil {
+			fmt.Println("Error checking ssh key:", err)
+		}
+		m.Export.KeyLinked = linked
+	}
+	token, expiresAt, err := db.CreateExportLink(m.User.user_id, exportLinkLifetime)
+	if err != nil {
+		fmt.Println("Error creating export link:", err)
+		m.Export.Status = "Could not create a download link, please try again"
+		return m, nil
+	}
+	m.Export.Link = web.ExportURL(token)
+	m.Export.ExpiresAt = expiresAt
+	return m, nil
+}
+
+// updateExport closes the dialog, or replaces a used link with a new one
+func (m Model) updateExport(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case "esc":
+			m.CurrentView = 1
+			return m, nil
+		case "n":
+			return m.openExport()
+		case "k":
+			// The session signed in with the key and the user with their password
+			if m.SSHKey == "" || m.Export.KeyLinked {
+				return m, nil
+			}
+			if err := db.LinkKey(m.User.user_id, m.SSHKey); err != nil {
+				fmt.Println("Error linking ssh key:", err)
+				m.Export.Status = "Could not link the SSH key, please try again"
+				return m, nil
+			}
+			m.Export.KeyLinked = true
+			m.Export.Status = "This SSH key now identifies you to ssh commands"
+		}
+	}
+	return m, nil
+}
+
+// Renders the export dialog
+func (m ExportViewModel) View() string {
+	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9"))
+	faint := lipgloss.NewStyle().Faint(true)
+
+	lines := []string{title.Render("Export all your notes as markdown"), ""}
+	if m.Link != "" {
+		lines = append(lines,
+			"Download "+export.Filename+" once from:",
+			lipgloss.NewStyle().Underline(true).Render(m.Link),
+			faint.Render("the link works once, until "+m.ExpiresAt.Format("15:04")),
+			"",
+		)
+	}
+	if m.KeyLinked {
+		lines = append(lines, "Or from your shell:", "  ssh "+sshAddress()+" export > "+export.Filename)
+	} else if m.HasKey {
+		lines = append(lines, faint.Render("Press k to link this SSH key, then export with: ssh "+sshAddress()+" export > "+export.Filename))
+	} else {
+		lines = append(lines, faint.Render("Log in with an SSH key to also export with: ssh "+sshAddress()+" export > "+export.Filename))
+	}
+	lines = append(lines, "",
+		faint.Render("Bring notes from Notion, Obsidian or markdown folders with: ssh "+sshAddress()+" import --dry-run < archive.zip"),
+		faint.Render("One note as a web page, --print for paper or PDF: ssh "+sshAddress()+" html --print <title> > note.html"),
+		faint.Render("Lossless backups, with comments and sharing: ssh "+sshAddress()+" backup > backup.json, then ssh "+sshAddress()+" restore < backup.json"),
+	)
+	if gitstore.Enabled() {
+		lines = append(lines, faint.Render("Every save is a commit, get the history with: git clone ssh://"+sshHost()+":23236/"+gitstore.RepoName))
+		if m.GitError != nil {
+			lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#FFB454")).Render("The last commit failed, cloning catches up: "+m.GitError.Error()))
+		}
+	}
+	help := "n: new link • esc: back"
+	if m.HasKey && !m.KeyLinked {
+		help = "k: link SSH key • " + help
+	}
+	lines = append(lines, "", m.Status, faint.Render(help))
+	return lipgloss.NewStyle().Width(80).Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
@@ -0,0 +1,204 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/x/ansi"
+
+	"notion_ssh_app/internal/app/blobs"
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/graphics"
+)
+
+// Bounds on the images of a note drawn in the viewer, the ones past maxImages stay text
+const (
+	maxImages    = 8
+	maxImageRows = 20
+)
+
+// imageTransmitDelay is how long kitty image data rides along with the frames drawn, by when
+// it surely reached the terminal once
+const imageTransmitDelay = time.Second
+
+// errNotImage is returned when drawing attachments that are not images
+var errNotImage = errors.New("the attachment is not an image")
+
+// imageRefRe matches an image on a line of its own that shows an attachment, like ![plan](attachment:12)
+var imageRefRe = regexp.MustCompile(`(?m)^!\[[^\]\n]*\]\(attachment:(\d+)\)[ \t]*$`)
+
+// imageTransmittedMsg ends the transmission of the kitty images of the note numbered by it
+type imageTransmittedMsg int
+
+// terminalGraphics is how the session's terminal draws images, with cells measured from the
+// pty's size in pixels when the client sent it
+func terminalGraphics(s ssh.Session) graphics.Caps {
+	pty, _, _ := s.Pty()
+	caps := graphics.Detect(pty.Term, s.Environ())
+	if pty.Window.Width > 0 && pty.Window.Height > 0 && pty.Window.WidthPixels > 0 && pty.Window.HeightPixels > 0 {
+		caps.CellWidth = pty.Window.WidthPixels / pty.Window.Width
+		caps.CellHeight = pty.Window.HeightPixels / pty.Window.Height
+	}
+	return caps
+}
+
+// imageToken stands for a picture in the markdown given to glamour, to find its line after
+func imageToken(index int) string {
+	return "NOTESIMAGE" + strconv.Itoa(index) + "TOKEN"
+}
+
+// Markers around sixel pictures in the rendered note, zero-width and swapped for the sixel
+// when the viewport is drawn; drawTop starts the picture's lines and drawAt follows them
+func drawTop(index int) string { return "\x1b_notes-image-top;" + strconv.Itoa(index) + "\x1b\\" }
+func drawAt(index int) string  { return "\x1b_notes-image-draw;" + strconv.Itoa(index) + "\x1b\\" }
+
+// setNote shows a note rendered to markdown in the viewport, drawing the images of
+// attachments in it as the terminal can
+func (m Model) setNote(content string) Model {
+	v := &m.ViewportView
+	v.Overlays, v.Transmit = nil, ""
+
+	var pictures []graphics.Picture
+	if m.Graphics.Protocol != graphics.Off {
+		content = imageRefRe.ReplaceAllStringFunc(content, func(ref string) string {
+			if len(pictures) >= maxImages {
+				return ref
+			}
+			id, _ := strconv.Atoi(imageRefRe.FindStringSubmatch(ref)[1])
+			v.imageID = v.imageID%255 + 1
+			picture, err := m.drawAttachment(id, v.imageID)
+			if err != nil {
+				if err != db.ErrNoAttachment && err != errNotImage && err != graphics.ErrTooLarge {
+					fmt.Println("Error drawing attachment:", err)
+				}
+				return ref
+			}
+			pictures = append(pictures, picture)
+			return "\n" + imageToken(len(pictures)-1) + "\n"
+		})
+	}
+
+	out, _ := glamour.Render(content, "dark") // used glamour to render the markdown in prettier way here
+	if len(pictures) == 0 {
+		v.Viewport.SetContent(out)
+		return m
+	}
+
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		plain := ansi.Strip(line)
+		token := strings.TrimSpace(plain)
+		index := -1
+		for i := range pictures {
+			if token == imageToken(i) {
+				index = i
+			}
+		}
+		if index < 0 {
+			lines = append(lines, line)
+			continue
+		}
+
+		indent := strings.Repeat(" ", len(plain)-len(strings.TrimLeft(plain, " ")))
+		picture := pictures[index]
+		for row, pictureLine := range picture.Lines {
+			if picture.Overlay != "" && row == 0 {
+				pictureLine = drawTop(index) + pictureLine
+			}
+			lines = append(lines, indent+pictureLine)
+		}
+		if picture.Overlay != "" {
+			if v.Overlays == nil {
+				v.Overlays = map[int]string{}
+			}
+			v.Overlays[index] = picture.Overlay
+			lines = append(lines, indent+drawAt(index))
+		}
+		v.Transmit += picture.Transmit
+	}
+	if v.Transmit != "" {
+		v.transmitID++
+	}
+	v.Viewport.SetContent(strings.Join(lines, "\n"))
+	return m
+}
+
+// drawAttachment draws an image attachment to fit the viewer
+func (m Model) drawAttachment(id, imageID int) (graphics.Picture, error) {
+	a, err := db.FetchAttachment(id, m.User.user_id)
+	if err != nil {
+		return graphics.Picture{}, err
+	}
+	if !strings.HasPrefix(a.ContentType, "image/") {
+		return graphics.Picture{}, errNotImage
+	}
+	if a.Size > graphics.MaxImageBytes {
+		return graphics.Picture{}, graphics.ErrTooLarge
+	}
+	blob, err := blobs.Default.Open(a.BlobKey)
+	if err != nil {
+		return graphics.Picture{}, err
+	}
+	defer blob.Close()
+	img, err := graphics.Decode(blob)
+	if err != nil {
+		return graphics.Picture{}, err
+	}
+	cols := max(m.ViewportView.Viewport.Width-6, 1)
+	rows := min(maxImageRows, max(m.ViewportView.Viewport.Height/2, 4))
+	return graphics.Draw(img, m.Graphics, imageID, cols, rows)
+}
+
+// transmitImages keeps kitty image data in the frames drawn for imageTransmitDelay
+func (m Model) transmitImages() (Model, tea.Cmd) {
+	v := &m.ViewportView
+	if v.Transmit == "" || v.transmitting == v.transmitID {
+		return m, nil
+	}
+	v.transmitting = v.transmitID
+	id := v.transmitID
+	return m, tea.Tick(imageTransmitDelay, func(time.Time) tea.Msg { return imageTransmittedMsg(id) })
+}
+
+// setContent shows text without images in the viewport
+func (v *ViewportViewModel) setContent(content string) {
+	v.Viewport.SetContent(content)
+	v.Overlays = nil
+}
+
+// drawOverlays swaps the markers of sixel pictures for the sixel, drawn from the line after
+// the picture up over its lines. Pictures not wholly in view are left out, they would draw
+// over whatever is above the viewport.
+func (v ViewportViewModel) drawOverlays(view string) string {
+	lines := strings.Split(view, "\n")
+	tops := map[int]int{}
+	for i, line := range lines {
+		for index := range v.Overlays {
+			if marker := drawTop(index); strings.Contains(line, marker) {
+				tops[index] = i
+				lines[i] = strings.Replace(line, marker, "", 1)
+			}
+		}
+	}
+	for i, line := range lines {
+		for index, sixel := range v.Overlays {
+			marker := drawAt(index)
+			if !strings.Contains(line, marker) {
+				continue
+			}
+			draw := ""
+			if top, ok := tops[index]; ok && top < i {
+				draw = ansi.SaveCursor + ansi.CursorUp(i-top) + sixel + ansi.RestoreCursor
+			}
+			lines[i] = strings.Replace(line, marker, draw, 1)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,136 @@
+package middlewares
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/notify"
+)
+
+// Define the inbox model struct
+type InboxViewModel struct {
+	List   list.Model
+	Status string
+}
+
+// notificationItem makes a notification selectable in the inbox list
+type notificationItem struct {
+	db.Notification
+}
+
+func (i notificationItem) FilterValue() string { return i.Body }
+func (i notificationItem) Title() string {
+	if i.Read {
+		return i.Body
+	}
+	return "● " + i.Body
+}
+func (i notificationItem) Description() string { return i.Kind + " · " + ago(i.CreatedAt) }
+
+// openInbox shows the user's latest notifications
+func (m Model) openInbox() (tea.Model, tea.Cmd) {
+	notifications, err := db.FetchNotifications(m.User.user_id, 100)
+	if err != nil {
+		fmt.Println("Error fetching notifications:", err)
+		return m, nil
+	}
+	var items []list.Item
+	for _, n := range notifications {
+		items = append(items, notificationItem{n})
+	}
+
+	l := list.New(items, list.NewDefaultDelegate(), 80, max(m.Dimensions.TotalHeight-10, 10))
+	l.Title = "inbox -> "
+	l.SetFilteringEnabled(false)
+	m.Inbox = InboxViewModel{List: l}
+	m.CurrentView = inboxView
+	return m, nil
+}
+
+// updateInbox opens the note a notification is about, or marks everything read
+func (m Model) updateInbox(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case "esc":
+			m.CurrentView = 1
+			return m, nil
+
+		case "m":
+			if err := db.MarkNotificationsRead(m.User.user_id); err != nil {
+				fmt.Println("Error marking notifications read:", err)
+				return m, nil
+			}
+			m.Unread = 0
+			for index, item := range m.Inbox.List.Items() {
+				n := item.(notificationItem)
+				n.Read = true
+				m.Inbox.List.SetItem(index, n)
+			}
+			return m, nil
+
+		case "enter":
+			n, ok := m.Inbox.List.SelectedItem().(notificationItem)
+			if !ok || n.NoteID == 0 {
+				return m, nil
+			}
+			if !n.Read {
+				if err := db.MarkNotificationsRead(m.User.user_id, n.ID); err == nil {
+					m.Unread = max(m.Unread-1, 0)
+				}
+			}
+			item, err := db.FetchItem(n.NoteID, m.User.user_id)
+			if err != nil {
+				m.Inbox.Status = "This note is no longer available to you"
+				return m, nil
+			}
+			return m.openViewer(item), nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Inbox.List, cmd = m.Inbox.List.Update(msg)
+	return m, cmd
+}
+
+// receiveNotification counts a notification delivered while the session is open
+func (m Model) receiveNotification(msg notify.Msg) (tea.Model, tea.Cmd) {
+	m.Unread++
+	if m.CurrentView == inboxView {
+		m.Inbox.List.InsertItem(0, notificationItem{msg.Notification})
+	}
+	// Notes shared into the personal space show up in the list right away
+	if msg.Notification.Kind == notify.KindShare && m.Workspace.ID == 0 {
+		userID := m.User.user_id
+		return m, func() tea.Msg { return db.FetchItems(userID, 0) }
+	}
+	return m, nil
+}
+
+// Renders the inbox list
+func (m InboxViewModel) View() string {
+	help := lipgloss.NewStyle().Faint(true).Render("enter: open • m: mark all read • esc: back")
+	return lipgloss.JoinVertical(lipgloss.Left, m.List.View(), m.Status, help)
+}
+
+// unreadBadge shows how many notifications wait in the inbox
+func (m Model) unreadBadge() string {
+	if m.Unread == 0 {
+		return lipgloss.NewStyle().Faint(true).Render("  ctrl+n: inbox")
+	}
+	badge := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#F25D94")).Padding(0, 1)
+	return "  " + badge.Render(fmt.Sprintf("%d unread", m.Unread)) + lipgloss.NewStyle().Faint(true).Render(" ctrl+n: inbox")
+}
+
+// toggleFollow subscribes to or unsubscribes from saves of the note in the viewer
+func (m Model) toggleFollow() (tea.Model, tea.Cmd) {
+	if err := db.FollowNote(m.ListItemView.ID, m.User.user_id, !m.Following); err != nil {
+		fmt.Println("Error following note:", err)
+		return m, nil
+	}
+	m.Following = !m.Following
+	return m, nil
+}
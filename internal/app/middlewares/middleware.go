@@ -9,7 +9,6 @@ import (
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/ssh"
@@ -17,8 +16,12 @@ import (
 	"github.com/charmbracelet/wish/bubbletea"
 	"github.com/muesli/termenv"
 
+	"notion_ssh_app/internal/app/collab"
 	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/gitstore"
+	"notion_ssh_app/internal/app/graphics"
 	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/notify"
 	"notion_ssh_app/internal/styles"
 
 	_ "github.com/lib/pq"
@@ -37,8 +40,56 @@ type Model struct {
 	User         UserDetails
 	Dimensions   models.Dimensions
 	SplashActive bool
+	Editing      *models.ListItemViewModel // note opened in the editor, nil when composing a new one
+	Conflict     ConflictViewModel
+	Peer         *collab.Peer // this session, as seen by other sessions editing the same note
+	Collab       CollabViewModel
+	Share        ShareViewModel
+	Workspace    db.Workspace // workspace the list is scoped to, ID 0 for personal notes
+	Workspaces   WorkspaceViewModel
+	Publish      PublishViewModel
+	ReadOnly     bool // anonymous session showing a single published note
+	Comments     CommentsViewModel
+	Following    bool // whether the user gets notified when the note in the viewer is saved
+	Unread       int
+	Inbox        InboxViewModel
+	Database     DatabaseViewModel
+	Calendar     CalendarViewModel
+	ViewerBack   int       // view ctrl+z returns to from the viewer, 0 for the list
+	Due          *huh.Form // due date of the note in the viewer being set, nil otherwise
+	Journal      JournalViewModel
+	Location     *time.Location // the user's time zone, nil for the server's
+	Templates    TemplatesViewModel
+	TemplateForm *huh.Form // note in the viewer being saved as a template, nil otherwise
+	Tasks        TasksViewModel
+	TaskForm     *huh.Form // tasks of the note in the viewer being checked, nil otherwise
+	ReminderForm *huh.Form // reminder on the note in the viewer being set, nil otherwise
+	Toast        string    // reminder shown over the current view, empty when none
+	toastID      int       // counts toasts so an old one expiring leaves a newer one up
+	SSHKey       string    // fingerprint of the SSH key the session signed in with, linked from the export dialog
+	Export       ExportViewModel
+	Vault        []byte // key of the user's private notes, nil until they enter their passphrase
+	Unlock       UnlockViewModel
+	Attachments  AttachmentsViewModel
+	Graphics     graphics.Caps // how the session's terminal draws images
 }
 
+// Views added on top of the list (1), editor (2) and viewer (3)
+const (
+	conflictView    = 4
+	shareView       = 5
+	workspaceView   = 6
+	publishView     = 7
+	inboxView       = 8
+	databaseView    = 9
+	calendarView    = 10
+	journalView     = 11
+	templateView    = 12
+	tasksView       = 13
+	exportView      = 14
+	attachmentsView = 15
+)
+
 type UserDetails struct {
 	email string
 	Password string
@@ -62,12 +113,18 @@ type ListViewModel struct {
 type TextareaViewModel struct {
 	Textarea     textarea.Model
 	ShowTextArea bool
+	Status       string // shown under the editor, like conflict markers left by a merge
 }
 
 // Define the viewport view model struct
 type ViewportViewModel struct {
-	Viewport viewport.Model
-	Content  string
+	Viewport     viewport.Model
+	Content      string
+	Overlays     map[int]string // sixel pictures of the note, drawn when all their lines are in view
+	Transmit     string         // kitty images of the note, sent along with the frames for a moment
+	transmitID   int            // counts notes with kitty images, so an old transmission ending leaves a newer one be
+	transmitting int            // transmitID the transmission was timed for
+	imageID      int            // kitty image ID handed out last
 }
 
 type SplashFinishedMsg struct{}
@@ -77,6 +134,10 @@ type SplashFinishedMsg struct{}
 func (m Model) Init() tea.Cmd {
 	lipgloss.SetColorProfile(termenv.TrueColor)
 
+	if m.ReadOnly {
+		return nil
+	}
+
 	if m.SplashActive {
 		// If the splash screen is active, return a command to wait for 2 seconds before proceeding
 		return tea.Batch(
@@ -96,7 +157,7 @@ func (m Model) Init() tea.Cmd {
 		email := m.FormModel.Form.GetString("email")
 		// password := m.FormModel.Form.GetString("password")
 		fmt.Println(email)
-		return db.FetchItems(m.User.user_id)
+		return db.FetchItems(m.User.user_id, m.Workspace.ID)
 	}
 
 }
@@ -113,8 +174,11 @@ func (m TextareaViewModel) View() string {
 
 // Renders the viewport view
 func (m ViewportViewModel) View() string {
-
-	return styles.ViewportStyle.Render(m.Viewport.View())
+	view := m.Viewport.View()
+	if len(m.Overlays) > 0 {
+		view = m.drawOverlays(view)
+	}
+	return styles.ViewportStyle.Render(m.Transmit + view)
 }
 
 // // Renders the login form view
@@ -150,10 +214,23 @@ func (m ViewportViewModel) View() string {
 
 // Renders the login form view
 func (m Model) View() string {
+	view := m.view()
+	if m.LoggedIn && m.Toast != "" {
+		return overlayToast(view, m.Toast, m.Dimensions.TotalWidth)
+	}
+	return view
+}
+
+// view renders the current view, without the toast
+func (m Model) view() string {
 	if m.Quitting {
 		return "exiting the ssh session"
 	}
 
+	if m.ReadOnly {
+		return m.readOnlyView()
+	}
+
 	formWidth := 50
 	formHeight := 10
 
@@ -168,14 +245,60 @@ func (m Model) View() string {
 	if m.LoggedIn {
 		switch m.CurrentView {
 		case 1:
-			centeredList := lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.ListView.View())
+			listView := lipgloss.JoinVertical(lipgloss.Left, styles.ListStyle.UnsetMargins().MarginLeft(10).Render(m.workspaceHeader()+m.unreadBadge()), m.ListView.View())
+			centeredList := lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, listView)
 			return centeredList
 		case 2:
-			return lipgloss.JoinHorizontal(lipgloss.Top, m.TextareaView.View(), m.ViewportView.View())
+			editor := lipgloss.JoinHorizontal(lipgloss.Top, m.editorView(), m.ViewportView.View())
+			if m.TextareaView.Status != "" {
+				editor = lipgloss.JoinVertical(lipgloss.Left, editor, lipgloss.NewStyle().Foreground(lipgloss.Color("#FFB454")).Render(m.TextareaView.Status))
+			}
+			return lipgloss.JoinVertical(lipgloss.Left, editor, m.Collab.View(m.Peer))
 		case 3:
 			viewportView := styles.CenteredViewportStyle.Render(m.ViewportView.View())
+			viewportView = lipgloss.JoinHorizontal(lipgloss.Top, viewportView, m.Comments.View(m.ListItemView.Content, m.ViewportView.Viewport.Height))
+			if badges := viewerBadges(m.ListItemView.ID, m.Peer); badges != "" {
+				viewportView = lipgloss.JoinVertical(lipgloss.Left, "also viewing: "+badges, viewportView)
+			}
+			if m.Due != nil {
+				viewportView = lipgloss.JoinVertical(lipgloss.Left, viewportView, styles.FormStyle.Width(50).Align(lipgloss.Left).Render(m.Due.View()))
+			} else if m.TemplateForm != nil {
+				viewportView = lipgloss.JoinVertical(lipgloss.Left, viewportView, styles.FormStyle.Width(70).Align(lipgloss.Left).Render(m.TemplateForm.View()))
+			} else if m.TaskForm != nil {
+				viewportView = lipgloss.JoinVertical(lipgloss.Left, viewportView, styles.FormStyle.Width(70).Align(lipgloss.Left).Render(m.TaskForm.View()))
+			} else if m.ReminderForm != nil {
+				viewportView = lipgloss.JoinVertical(lipgloss.Left, viewportView, styles.FormStyle.Width(70).Align(lipgloss.Left).Render(m.ReminderForm.View()))
+			} else if m.Unlock.Form != nil {
+				viewportView = lipgloss.JoinVertical(lipgloss.Left, viewportView, styles.FormStyle.Width(70).Align(lipgloss.Left).Render(m.Unlock.Form.View()))
+			} else {
+				viewportView = lipgloss.JoinVertical(lipgloss.Left, viewportView, m.viewerHelp())
+			}
 			centeredViewPort := lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, viewportView)
 			return centeredViewPort
+		case conflictView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Conflict.View())
+		case shareView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Share.View())
+		case workspaceView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Workspaces.View())
+		case publishView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Publish.View())
+		case inboxView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Inbox.View())
+		case databaseView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Database.View())
+		case calendarView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Calendar.View(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight))
+		case journalView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Journal.View())
+		case templateView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Templates.View())
+		case tasksView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Tasks.View())
+		case exportView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Export.View())
+		case attachmentsView:
+			return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, m.Attachments.View())
 		default:
 			return m.ListView.View() // Default to list view if logged in
 		}
@@ -232,10 +355,32 @@ func (m Model) View() string {
 }
 
 /* UPDATE METHODS */
-// Update method to handle key presses and window resizing
+// Update method to handle messages, then let other sessions know which note is open
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if id, ok := msg.(imageTransmittedMsg); ok {
+		if int(id) == m.ViewportView.transmitID {
+			m.ViewportView.Transmit = ""
+		}
+		return m, nil
+	}
+	next, cmd := m.update(msg)
+	nm, ok := next.(Model)
+	if !ok {
+		return next, cmd
+	}
+	nm.trackPresence()
+	nm, transmit := nm.transmitImages()
+	return nm, tea.Batch(cmd, transmit)
+}
+
+// update handles key presses and window resizing
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
+	if m.ReadOnly {
+		return m.updateReadOnly(msg)
+	}
+
 	// Update the form if it's not nil
 	if m.FormModel != nil {
 		f, cmd := m.FormModel.Form.Update(msg)
@@ -266,12 +411,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					// Successfully authenticated; store the user ID and redirect to the list view
 					m.User.user_id = *userID
 					m.User.email = email
+					m.Peer.SetIdentity(*userID, email)
 					m.LoggedIn = true
 					m.CurrentView = 1
+					if unread, err := db.UnreadNotifications(*userID); err == nil {
+						m.Unread = unread
+					}
 
 					// Fetch the user's items
 					cmd := func() tea.Msg {
-						return db.FetchItems(m.User.user_id)
+						return db.FetchItems(m.User.user_id, m.Workspace.ID)
 					}
 					cmds = append(cmds, cmd)
 				} else {
@@ -307,64 +456,189 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyMsg:
+		if m.CurrentView == conflictView && msg.String() != "ctrl+c" {
+			return m.updateConflict(msg)
+		}
+		if m.CurrentView == shareView && msg.String() != "ctrl+c" {
+			return m.updateShare(msg)
+		}
+		if m.CurrentView == workspaceView && msg.String() != "ctrl+c" {
+			return m.updateWorkspaces(msg)
+		}
+		if m.CurrentView == publishView && msg.String() != "ctrl+c" {
+			return m.updatePublish(msg)
+		}
+		if m.CurrentView == inboxView && msg.String() != "ctrl+c" {
+			return m.updateInbox(msg)
+		}
+		if m.CurrentView == databaseView && msg.String() != "ctrl+c" {
+			return m.updateDatabases(msg)
+		}
+		if m.CurrentView == calendarView && msg.String() != "ctrl+c" {
+			return m.updateCalendar(msg)
+		}
+		if m.CurrentView == journalView && msg.String() != "ctrl+c" {
+			return m.updateJournal(msg)
+		}
+		if m.CurrentView == templateView && msg.String() != "ctrl+c" {
+			return m.updateTemplates(msg)
+		}
+		if m.CurrentView == 3 && m.TemplateForm != nil && msg.String() != "ctrl+c" {
+			return m.updateSaveTemplate(msg)
+		}
+		if m.CurrentView == 3 && msg.String() == "T" && m.ListItemView.ID != 0 && !m.ListItemView.Private {
+			return m.openSaveTemplate()
+		}
+		if m.CurrentView == tasksView && msg.String() != "ctrl+c" {
+			return m.updateTasks(msg)
+		}
+		if m.CurrentView == exportView && msg.String() != "ctrl+c" {
+			return m.updateExport(msg)
+		}
+		if m.CurrentView == attachmentsView && msg.String() != "ctrl+c" {
+			return m.updateAttachments(msg)
+		}
+		if m.CurrentView == 3 && m.TaskForm != nil && msg.String() != "ctrl+c" {
+			return m.updateTaskForm(msg)
+		}
+		if m.CurrentView == 3 && msg.String() == "t" && m.ListItemView.Role >= models.RoleEditor && !m.ListItemView.Private {
+			return m.openTaskForm()
+		}
+		if m.CurrentView == 3 && m.ReminderForm != nil && msg.String() != "ctrl+c" {
+			return m.updateReminderForm(msg)
+		}
+		if m.CurrentView == 3 && msg.String() == "R" && m.ListItemView.ID != 0 {
+			return m.openReminderForm()
+		}
+		if m.CurrentView == 3 && m.Unlock.Form != nil && msg.String() != "ctrl+c" {
+			return m.updateUnlock(msg)
+		}
+		if m.CurrentView == 3 && msg.String() == "u" && m.ListItemView.Locked() && m.ownsPrivacy() {
+			return m.openUnlock(unlockOpen)
+		}
+		if m.CurrentView == 3 && msg.String() == "P" && m.ownsPrivacy() {
+			return m.togglePrivate()
+		}
+		if m.CurrentView == 3 && m.Due != nil && msg.String() != "ctrl+c" {
+			return m.updateDueForm(msg)
+		}
+		if m.CurrentView == 3 && msg.String() == "D" && m.ListItemView.Role >= models.RoleEditor {
+			return m.openDueForm()
+		}
+		if m.CurrentView == 3 && m.Comments.Form != nil && msg.String() != "ctrl+c" {
+			return m.updateCommentForm(msg)
+		}
+		if m.CurrentView == 3 && msg.String() == "A" && m.ListItemView.ID != 0 {
+			return m.openAttachments()
+		}
+		if m.CurrentView == 3 && msg.String() == "w" {
+			return m.toggleFollow()
+		}
+		if m.CurrentView == 3 && !m.ListItemView.Daily.IsZero() {
+			// Daily notes page through the journal
+			switch msg.String() {
+			case "<":
+				return m.stepDailyNote(false), nil
+			case ">":
+				return m.stepDailyNote(true), nil
+			case "J":
+				return m.openJournal()
+			}
+		}
+		if m.CurrentView == 3 {
+			if next, cmd, handled := m.updateComments(msg); handled {
+				return next, cmd
+			}
+		}
 		switch msg.String() {
 		case "ctrl+c":
 			m.Quitting = true
 			return m, tea.Quit
 
 		case "ctrl+a":
-			m.TextareaView.ShowTextArea = !m.TextareaView.ShowTextArea
-			if m.TextareaView.ShowTextArea {
-				// before opening this view reset the textarea and viewport so user will see fresh empty screens
-				m.TextareaView.Textarea.Reset()
-				m.ViewportView.Viewport.SetContent("")
-				m.CurrentView = 2
-			} else {
-				m.CurrentView = 1
+			if !m.TextareaView.ShowTextArea {
+				// New notes start from a template, or blank
+				return m.openTemplates()
 			}
+			m.TextareaView.ShowTextArea = false
+			m = m.leaveCollab()
+			m.Editing = nil
+			m.CurrentView = 1
 			return m, nil
 
 		case "ctrl+e":
 			if m.TextareaView.ShowTextArea {
-				// Get the full content from the textarea
-				fullText := m.TextareaView.Textarea.Value()
+				// Extract the title, description, and content from the textarea
+				newItem := models.ParseEditorText(m.TextareaView.Textarea.Value())
 
-				// Split the content by lines
-				lines := strings.Split(fullText, "\n")
-
-				// Extract the title, description, and content
-				var title, desc, content string
-				if len(lines) > 0 {
-					title = lines[0]
-				}
-				if len(lines) > 1 {
-					desc = lines[1]
-				}
-				if len(lines) > 2 {
-					content = strings.Join(lines[2:], "\n")
-				}
-
-				// Create a new item with the extracted values
-				newItem := models.ListItemViewModel{
-					ItemTitle: title,
-					Desc:      desc,
-					Content:   content,
+				// Existing notes are only saved if nobody else saved them in the meantime
+				if m.Editing != nil {
+					return m.saveEditedItem(newItem)
 				}
 
-				// Add the new item to the database
-				err := db.AddItemToDB(newItem, m.User.user_id)
+				// Add the new item to the current workspace
+				newItem.WorkspaceID = m.Workspace.ID
+				id, err := db.AddItemToDB(newItem, m.User.user_id)
 				if err != nil {
 					fmt.Println("Error adding item to database:", err)
 				} else {
 					fmt.Println("Item added to the database successfully.")
+					newItem.ID = id
+					newItem.Version = 1
+					newItem.Role = models.RoleOwner
+					gitstore.NoteSaved(id, m.User.user_id, "Add "+newItem.ItemTitle)
 				}
 
 				// Insert the new item into the list and update the view
-				m.ListView.List.InsertItem(len(m.ListView.List.Items()), newItem)
+				m.insertOwnItem(newItem)
 				m.TextareaView.ShowTextArea = false
 				m.CurrentView = 1
 				return m, nil
 			}
+		case "ctrl+r":
+			// Open the note shown in the viewer in the editor
+			if m.CurrentView == 3 && m.ListItemView.ID != 0 && m.ListItemView.Role >= models.RoleEditor && !m.ListItemView.Locked() {
+				item := m.ListItemView
+				m.Editing = &item
+				return m.openEditor(models.EditorText(item)), nil
+			}
+		case "ctrl+n":
+			if m.CurrentView == 1 && m.ListView.List.FilterState() != list.Filtering {
+				return m.openInbox()
+			}
+		case "ctrl+d":
+			if m.CurrentView == 1 && m.ListView.List.FilterState() != list.Filtering {
+				return m.openDatabases()
+			}
+		case "ctrl+t":
+			if m.CurrentView == 1 && m.ListView.List.FilterState() != list.Filtering {
+				return m.openDailyNote(time.Now().In(m.location())), nil
+			}
+		case "ctrl+k":
+			if m.CurrentView == 1 && m.ListView.List.FilterState() != list.Filtering {
+				return m.openTasks()
+			}
+		case "ctrl+l":
+			if m.CurrentView == 1 && m.ListView.List.FilterState() != list.Filtering {
+				return m.openCalendar()
+			}
+		case "ctrl+w":
+			if m.CurrentView == 1 && m.ListView.List.FilterState() != list.Filtering {
+				return m.openWorkspaces()
+			}
+		case "ctrl+x":
+			if m.CurrentView == 1 && m.ListView.List.FilterState() != list.Filtering {
+				return m.openExport()
+			}
+		case "ctrl+o":
+			// Only the owner decides who else gets to see the note
+			if m.CurrentView == 3 && m.ListItemView.ID != 0 && m.ListItemView.Role == models.RoleOwner {
+				return m.openShare()
+			}
+		case "ctrl+p":
+			if m.CurrentView == 3 && m.ListItemView.ID != 0 && m.ListItemView.Role == models.RoleOwner && !m.ListItemView.Private {
+				return m.openPublish()
+			}
 		case "ctrl+z":
 			if m.CurrentView == 1 {
 				if i, ok := m.ListView.List.SelectedItem().(models.ListItemViewModel); ok {
@@ -374,16 +648,28 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					fmt.Println("item number selected is : ", i.Desc)
 					fmt.Println("item number selected is : ", i.Title())
 
-					m.ListItemView = i
-					m.CurrentView = 3
-					out, _ := glamour.Render(m.ListItemView.Content, "dark") // used glamour to render the markdown in prettier way here
-					m.ViewportView.Viewport.SetContent(out)
-					// m.ViewportView.Viewport.Style.MarginLeft(30)
-
+					m = m.openViewer(i)
 				}
 				return m, nil
 			}
+			m = m.leaveCollab()
 			m.CurrentView = 1
+			switch m.ViewerBack {
+			case databaseView:
+				// Pages go back to the table of their database
+				m = m.openCollection(m.Database.Collection.ID)
+				m.CurrentView = databaseView
+			case calendarView:
+				m = m.loadCalendar()
+				m.CurrentView = calendarView
+			case journalView:
+				next, _ := m.openJournal()
+				m = next.(Model)
+			case tasksView:
+				m = m.loadTasks()
+				m.CurrentView = tasksView
+			}
+			m.ViewerBack = 0
 		}
 
 	case tea.MouseMsg:
@@ -393,9 +679,39 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 
+	case collab.UpdateMsg:
+		return m.applyCollabUpdate(msg), nil
+
+	case collab.SavedMsg:
+		return m.applyCollabSaved(msg), nil
+
+	case notify.Msg:
+		return m.receiveNotification(msg)
+
+	case notify.ToastMsg:
+		return m.showToast(msg)
+
+	case toastExpiredMsg:
+		if msg.id == m.toastID {
+			m.Toast = ""
+		}
+		return m, nil
+
+	case collab.PresenceMsg:
+		// Nothing to update, the next render picks up the new badges
+		return m, nil
+
 	case models.ItemsMsg:
+		// Own notes come first, the ones written by others get a section of their own
+		section := "shared with me"
+		if m.Workspace.ID != 0 {
+			section = "by other members"
+		}
 		var items []list.Item
-		for _, i := range msg.Items {
+		for index, i := range msg.Items {
+			if i.Owner != "" && (index == 0 || msg.Items[index-1].Owner == "") {
+				items = append(items, models.SectionHeader{Name: section})
+			}
 			items = append(items, i)
 		}
 		m.ListView.List.SetItems(items)
@@ -414,20 +730,202 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case 2:
 		var cmd tea.Cmd
 		m.TextareaView.Textarea, cmd = m.TextareaView.Textarea.Update(msg)
-		out, _ := glamour.Render(m.TextareaView.Textarea.Value(), "dark")
-		m.ViewportView.Viewport.SetContent(out)
+		m = m.syncCollab()
 		return m, cmd
 
 	case 3:
+		if m.Comments.Form != nil {
+			return m.updateCommentForm(msg)
+		}
+		if m.Due != nil {
+			return m.updateDueForm(msg)
+		}
+		if m.TemplateForm != nil {
+			return m.updateSaveTemplate(msg)
+		}
+		if m.TaskForm != nil {
+			return m.updateTaskForm(msg)
+		}
+		if m.ReminderForm != nil {
+			return m.updateReminderForm(msg)
+		}
+		if m.Unlock.Form != nil {
+			return m.updateUnlock(msg)
+		}
 		var cmd tea.Cmd
 		m.ViewportView.Viewport, cmd = m.ViewportView.Viewport.Update(msg)
 		return m, cmd
 
+	case shareView:
+		return m.updateShare(msg)
+
+	case workspaceView:
+		return m.updateWorkspaces(msg)
+
+	case publishView:
+		return m.updatePublish(msg)
+
+	case inboxView:
+		return m.updateInbox(msg)
+
+	case databaseView:
+		return m.updateDatabases(msg)
+
+	case journalView:
+		return m.updateJournal(msg)
+
+	case templateView:
+		return m.updateTemplates(msg)
+
+	case tasksView:
+		return m.updateTasks(msg)
+
 	default:
 		return m, tea.Batch(cmds...)
 	}
 }
 
+// saveEditedItem writes an edited note back, switching to the conflict view when
+// another session saved it first
+func (m Model) saveEditedItem(item models.ListItemViewModel) (tea.Model, tea.Cmd) {
+	item.ID = m.Editing.ID
+	item.Version = m.Editing.Version
+	item.Role = m.Editing.Role
+	item.Owner = m.Editing.Owner
+	item.AuthorID = m.Editing.AuthorID
+	item.Private, item.Opened = m.Editing.Private, m.Editing.Private
+
+	// Private notes are sealed here, the database only ever sees them sealed
+	stored, err := m.sealPrivate(item)
+	if err != nil {
+		fmt.Println("Error sealing note:", err)
+		return m, nil
+	}
+	version, err := db.UpdateItemInDB(stored, m.User.user_id)
+	if err == db.ErrVersionConflict {
+		theirs, err := db.FetchItem(item.ID, m.User.user_id)
+		if err != nil {
+			fmt.Println("Error fetching the latest version of the note:", err)
+			return m, nil
+		}
+		m.Conflict = ConflictViewModel{Base: *m.Editing, Mine: item, Theirs: m.openPrivate(theirs)}
+		m.CurrentView = conflictView
+		return m, nil
+	}
+	if err == db.ErrHasAttachments {
+		return m.showToast(toast("Private notes cannot have attachments, remove them from the viewer (A) to save"))
+	}
+	if err != nil {
+		fmt.Println("Error updating item in database:", err)
+		return m, nil
+	}
+
+	stored.Version = version
+	m.replaceItem(stored)
+	notify.NoteEdited(item.ID, item.Subject(), m.User.user_id, m.User.email)
+	gitstore.NoteSaved(item.ID, m.User.user_id, "Update "+item.Subject())
+	if m.Collab.NoteID == item.ID {
+		collab.Saved(m.Peer, item.ID, version)
+	}
+	m = m.leaveCollab()
+	m.Editing = nil
+	m.TextareaView.ShowTextArea = false
+	m.CurrentView = 1
+	return m, nil
+}
+
+// openViewer shows a note in the viewer along with its comments
+func (m Model) openViewer(item models.ListItemViewModel) Model {
+	m.ListItemView = m.openPrivate(item)
+	m.CurrentView = 3
+	m.ViewerBack = 0
+	m.Due = nil
+	m.TemplateForm = nil
+	m.TaskForm = nil
+	m.ReminderForm = nil
+	m.Unlock = UnlockViewModel{}
+	m = m.loadComments()
+	following, err := db.IsFollowing(item.ID, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error checking note follow:", err)
+	}
+	m.Following = following
+	content := m.ListItemView.Content
+	if m.ListItemView.Locked() {
+		content = m.lockedText()
+	}
+	return m.setNote(content)
+}
+
+// insertOwnItem adds a note the user just created at the end of their own notes
+func (m *Model) insertOwnItem(item models.ListItemViewModel) {
+	items := m.ListView.List.Items()
+	for index, listItem := range items {
+		if _, ok := listItem.(models.SectionHeader); ok {
+			m.ListView.List.InsertItem(index, item)
+			return
+		}
+	}
+	m.ListView.List.InsertItem(len(items), item)
+}
+
+// viewerHelp lists the keys available in the viewer, along with who shared the note
+func (m Model) viewerHelp() string {
+	keys := []string{"ctrl+z: back", "w: follow", "R: remind me", "A: attachments"}
+	if m.Following {
+		keys[1] = "w: unfollow"
+	}
+	if !m.ListItemView.Private {
+		keys = append(keys, "T: save as template")
+	}
+	if m.ListItemView.Role >= models.RoleEditor {
+		if !m.ListItemView.Locked() {
+			keys = append(keys, "ctrl+r: edit")
+		}
+		keys = append(keys, "D: due date")
+		if len(models.ParseTasks(m.ListItemView.Content)) > 0 && !m.ListItemView.Private {
+			keys = append(keys, "t: tasks")
+		}
+	}
+	if m.ownsPrivacy() {
+		switch {
+		case m.ListItemView.Locked():
+			keys = append(keys, "u: unlock")
+		case m.ListItemView.Private:
+			keys = append(keys, "P: make readable without passphrase")
+		default:
+			keys = append(keys, "P: make private")
+		}
+	}
+	if m.ListItemView.Role == models.RoleOwner {
+		keys = append(keys, "ctrl+o: share")
+		if !m.ListItemView.Private {
+			keys = append(keys, "ctrl+p: publish")
+		}
+	}
+	if !m.ListItemView.Daily.IsZero() {
+		keys = append(keys, "< >: previous/next day", "J: journal")
+	}
+	help := strings.Join(keys, " • ")
+	if !m.ListItemView.Due.IsZero() {
+		help = "due " + m.ListItemView.Due.Format("Mon 2 Jan 2006") + "  " + help
+	}
+	if m.ListItemView.Owner != "" {
+		help = "shared by " + m.ListItemView.Owner + " as " + m.ListItemView.Role.String() + "  " + help
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("#7571F9")).Render(help)
+}
+
+// replaceItem swaps the list entry holding the same note for item
+func (m *Model) replaceItem(item models.ListItemViewModel) {
+	for index, listItem := range m.ListView.List.Items() {
+		if i, ok := listItem.(models.ListItemViewModel); ok && i.ID == item.ID {
+			m.ListView.List.SetItem(index, item)
+			return
+		}
+	}
+}
+
 /* ----------------------------------------------------------------------------------------------------------------------- */
 
 // ListMiddleware returns a Wish middleware that sets up the Bubble Tea program
@@ -439,6 +937,16 @@ func ListMiddleware() wish.Middleware {
 			return nil
 		}
 
+		// Published notes open straight in a read-only viewer, no login needed
+		if slug, ok := publishedSlug(s); ok {
+			m, err := newReadOnlyModel(slug)
+			if err != nil {
+				wish.Fatalln(s, "this note is not published or its link has expired")
+				return nil
+			}
+			return tea.NewProgram(m, tea.WithInput(s), tea.WithOutput(s), tea.WithAltScreen(), tea.WithMouseCellMotion())
+		}
+
 		form := huh.NewForm(
 			huh.NewGroup(
 
@@ -447,7 +955,14 @@ func ListMiddleware() wish.Middleware {
 			),
 		)
 
-		l := list.New([]list.Item{}, list.NewDefaultDelegate(), 6, 24)
+		// Register the session so edits from other sessions can be delivered to it
+		peer := collab.NewPeer()
+		go func() {
+			<-s.Context().Done()
+			peer.Close()
+		}()
+
+		l := list.New([]list.Item{}, presenceDelegate{DefaultDelegate: list.NewDefaultDelegate(), self: peer}, 6, 24)
 		l.Title = "your notes -> "
 
 		t := textarea.New()
@@ -459,6 +974,7 @@ func ListMiddleware() wish.Middleware {
 
 		v := viewport.New(100, 40)
 		v.SetContent("Viewport content goes here…")
+
 		m := Model{
 			FormModel: &FormModel{
 				Form: form,
@@ -467,9 +983,16 @@ func ListMiddleware() wish.Middleware {
 			ListView:     ListViewModel{List: l},
 			TextareaView: TextareaViewModel{Textarea: t},
 			ViewportView: ViewportViewModel{Viewport: v},
+			Peer:         peer,
+			Workspace:    personalWorkspace,
+			Location:     sessionLocation(s),
+			SSHKey:       keyFingerprint(s),
+			Graphics:     terminalGraphics(s),
 		}
 
-		return tea.NewProgram(m, tea.WithInput(s), tea.WithOutput(s), tea.WithAltScreen(), tea.WithMouseCellMotion())
+		p := tea.NewProgram(m, tea.WithInput(s), tea.WithOutput(s), tea.WithAltScreen(), tea.WithMouseCellMotion())
+		peer.SetProgram(p)
+		return p
 	}
 	return bubbletea.MiddlewareWithProgramHandler(teaHandler, termenv.ANSI256)
 }
@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/collab"
+	"notion_ssh_app/internal/app/models"
+)
+
+// presenceDelegate renders list items like the default delegate, followed by
+// the initials of the other sessions that have the note open
+type presenceDelegate struct {
+	list.DefaultDelegate
+	self *collab.Peer
+}
+
+func (d presenceDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	var b strings.Builder
+	d.DefaultDelegate.Render(&b, m, index, item)
+
+	i, ok := item.(models.ListItemViewModel)
+	badges := ""
+	if ok {
+		badges = viewerBadges(i.ID, d.self)
+	}
+	if badges == "" {
+		io.WriteString(w, b.String())
+		return
+	}
+	title, rest, _ := strings.Cut(b.String(), "\n")
+	io.WriteString(w, title+"  "+badges+"\n"+rest)
+}
+
+// viewerBadges renders the initials of everyone but self looking at the note
+func viewerBadges(noteID int, self *collab.Peer) string {
+	var badges []string
+	for _, v := range collab.Viewers(noteID) {
+		if self != nil && v.PeerID == self.ID {
+			continue
+		}
+		badges = append(badges, lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(v.Color).Padding(0, 1).Render(v.Initials))
+	}
+	return strings.Join(badges, " ")
+}
+
+// openNoteID is the note this session is looking at, 0 for none
+func (m Model) openNoteID() int {
+	if !m.LoggedIn {
+		return 0
+	}
+	switch m.CurrentView {
+	case 2, conflictView:
+		if m.Editing != nil {
+			return m.Editing.ID
+		}
+	case 3:
+		return m.ListItemView.ID
+	}
+	return 0
+}
+
+// trackPresence publishes the open note to the other sessions
+func (m Model) trackPresence() {
+	if m.Peer != nil {
+		collab.SetViewing(m.Peer, m.openNoteID())
+	}
+}
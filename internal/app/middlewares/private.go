@@ -0,0 +1,237 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/gitstore"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/vault"
+)
+
+// What happens once the passphrase is entered
+const (
+	unlockOpen    = "open"    // show the private note in the viewer
+	unlockProtect = "protect" // make the note in the viewer private
+)
+
+// errVaultLocked is returned when a private note is saved before the passphrase was entered
+var errVaultLocked = errors.New("enter your passphrase to save private notes")
+
+// Define the passphrase prompt model struct
+type UnlockViewModel struct {
+	Form    *huh.Form
+	Action  string
+	Stored  *db.Vault // nil when the user is choosing their passphrase
+	Confirm *string   // the passphrase typed first, when choosing it
+}
+
+// openUnlock asks for the passphrase of the user's private notes, or to choose one on first use
+func (m Model) openUnlock(action string) (tea.Model, tea.Cmd) {
+	stored, ok, err := db.FetchVault(m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching vault:", err)
+		return m, nil
+	}
+
+	m.Unlock = UnlockViewModel{Action: action}
+	if ok {
+		m.Unlock.Stored = &stored
+		m.Unlock.Form = huh.NewForm(huh.NewGroup(
+			huh.NewInput().Title("Passphrase of your private notes").Key("passphrase").EchoMode(huh.EchoModePassword),
+		))
+		return m, m.Unlock.Form.Init()
+	}
+
+	first := new(string)
+	m.Unlock.Confirm = first
+	m.Unlock.Form = huh.NewForm(huh.NewGroup(
+		huh.NewInput().Title("Choose a passphrase for private notes").
+			Description("It never leaves this session and cannot be recovered, forgetting it loses the notes").
+			EchoMode(huh.EchoModePassword).Value(first).
+			Validate(func(s string) error {
+				if len(s) < vault.MinPassphrase {
+					return fmt.Errorf("use at least %d characters", vault.MinPassphrase)
+				}
+				return nil
+			}),
+		huh.NewInput().Title("Type it again").Key("passphrase").EchoMode(huh.EchoModePassword).
+			Validate(func(s string) error {
+				if s != *first {
+					return errors.New("the passphrases differ")
+				}
+				return nil
+			}),
+	))
+	return m, m.Unlock.Form.Init()
+}
+
+// updateUnlock runs the passphrase prompt, then carries on with what it was opened for
+func (m Model) updateUnlock(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" {
+		m.Unlock = UnlockViewModel{}
+		return m, nil
+	}
+
+	f, cmd := m.Unlock.Form.Update(msg)
+	m.Unlock.Form = f.(*huh.Form)
+	if m.Unlock.Form.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	passphrase := m.Unlock.Form.GetString("passphrase")
+	action, stored := m.Unlock.Action, m.Unlock.Stored
+	m.Unlock = UnlockViewModel{}
+	if stored == nil {
+		created, err := createVault(m.User.user_id, passphrase)
+		if err != nil {
+			fmt.Println("Error creating vault:", err)
+			return m.showToast(toast("Could not save the passphrase, please try again"))
+		}
+		stored = &created
+	}
+	key, err := vault.DeriveKey(passphrase, stored.Salt)
+	if err != nil || !vault.Verify(key, stored.Check) {
+		return m.showToast(toast("Wrong passphrase"))
+	}
+	m.Vault = key
+
+	if action == unlockProtect {
+		return m.setPrivate(true)
+	}
+	return m.openViewer(m.ListItemView), nil
+}
+
+// createVault stores the salt and check value of a new passphrase, returning the vault another
+// session may have created first
+func createVault(userID int, passphrase string) (db.Vault, error) {
+	salt, err := vault.NewSalt()
+	if err != nil {
+		return db.Vault{}, err
+	}
+	key, err := vault.DeriveKey(passphrase, salt)
+	if err != nil {
+		return db.Vault{}, err
+	}
+	check, err := vault.Check(key)
+	if err != nil {
+		return db.Vault{}, err
+	}
+	return db.CreateVault(userID, db.Vault{Salt: salt, Check: check})
+}
+
+// togglePrivate makes the note in the viewer private, or readable without the passphrase again
+func (m Model) togglePrivate() (tea.Model, tea.Cmd) {
+	switch {
+	case m.ListItemView.Locked():
+		return m.openUnlock(unlockOpen)
+	case m.ListItemView.Private:
+		return m.setPrivate(false)
+	case m.Vault == nil:
+		return m.openUnlock(unlockProtect)
+	}
+	return m.setPrivate(true)
+}
+
+// setPrivate saves the note in the viewer sealed, or in the clear. Public links to a note
+// made private stop working, since they could only ever show ciphertext.
+func (m Model) setPrivate(private bool) (tea.Model, tea.Cmd) {
+	item := m.ListItemView
+	item.Private, item.Opened = private, private
+	stored, err := m.sealPrivate(item)
+	if err != nil {
+		fmt.Println("Error sealing note:", err)
+		return m, nil
+	}
+	version, err := db.UpdateItemInDB(stored, m.User.user_id)
+	if err == db.ErrVersionConflict {
+		return m.showToast(toast(item.ItemTitle + " changed meanwhile, reopen it and try again"))
+	}
+	if err == db.ErrHasAttachments {
+		return m.showToast(toast("Attachments are stored unencrypted, remove them from the viewer (A) before making " + item.ItemTitle + " private"))
+	}
+	if err != nil {
+		fmt.Println("Error updating item in database:", err)
+		return m, nil
+	}
+
+	if private {
+		if err := db.RevokePublication(item.ID, m.User.user_id); err != nil {
+			fmt.Println("Error revoking publication:", err)
+		}
+		gitstore.NoteSaved(item.ID, m.User.user_id, "Make a note private")
+	} else {
+		gitstore.NoteSaved(item.ID, m.User.user_id, "Make "+item.ItemTitle+" readable without a passphrase")
+	}
+	stored.Version = version
+	m.replaceItem(stored)
+	item.Version = version
+	m.ListItemView = item
+	return m, nil
+}
+
+// sealPrivate seals the title, description and content of a private note with the session's key
+func (m Model) sealPrivate(item models.ListItemViewModel) (models.ListItemViewModel, error) {
+	if !item.Private {
+		return item, nil
+	}
+	if m.Vault == nil {
+		return item, errVaultLocked
+	}
+	title, err := vault.Seal(m.Vault, item.ItemTitle)
+	if err != nil {
+		return item, err
+	}
+	desc, err := vault.Seal(m.Vault, item.Desc)
+	if err != nil {
+		return item, err
+	}
+	content, err := vault.Seal(m.Vault, item.Content)
+	if err != nil {
+		return item, err
+	}
+	item.ItemTitle, item.Desc, item.Content = title, desc, content
+	item.Opened = false
+	return item, nil
+}
+
+// openPrivate unseals a private note with the session's key, leaving it sealed while the
+// passphrase was not entered or the note is someone else's
+func (m Model) openPrivate(item models.ListItemViewModel) models.ListItemViewModel {
+	if !item.Locked() || m.Vault == nil || item.AuthorID != m.User.user_id {
+		return item
+	}
+	title, err := vault.Open(m.Vault, item.ItemTitle)
+	if err != nil {
+		return item
+	}
+	desc, err := vault.Open(m.Vault, item.Desc)
+	if err != nil {
+		return item
+	}
+	content, err := vault.Open(m.Vault, item.Content)
+	if err != nil {
+		return item
+	}
+	item.ItemTitle, item.Desc, item.Content = title, desc, content
+	item.Opened = true
+	return item
+}
+
+// ownsPrivacy reports whether the user wrote the note in the viewer, and so alone may make
+// it private or unlock it, whatever their role in its workspace
+func (m Model) ownsPrivacy() bool {
+	return m.ListItemView.ID != 0 && m.ListItemView.AuthorID == m.User.user_id
+}
+
+// lockedText stands in for the content of a sealed note in the viewer
+func (m Model) lockedText() string {
+	if m.ownsPrivacy() {
+		return "# 🔒 Private note\n\nPress **u** and enter your passphrase to read it."
+	}
+	return "# 🔒 Private note\n\nOnly its owner can read it."
+}
@@ -0,0 +1,140 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/web"
+	"notion_ssh_app/internal/styles"
+)
+
+// Define the publish dialog model struct
+type PublishViewModel struct {
+	Form        *huh.Form
+	Note        models.ListItemViewModel
+	Publication *db.Publication // the working public link, nil when unpublished
+	Status      string
+}
+
+// newPublishForm offers the link lifetimes, and revocation once the note is published
+func newPublishForm(published bool) *huh.Form {
+	options := []huh.Option[string]{
+		huh.NewOption("publish, link never expires", "0"),
+		huh.NewOption("publish, link expires in a day", "24h"),
+		huh.NewOption("publish, link expires in a week", "168h"),
+		huh.NewOption("publish, link expires in 30 days", "720h"),
+	}
+	if published {
+		options = append([]huh.Option[string]{huh.NewOption("revoke the public link", "revoke")}, options...)
+	}
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().Title("Anyone with the link can read this note").Key("action").Options(options...),
+		),
+	)
+}
+
+// openPublish shows the publish dialog for the note in the viewer
+func (m Model) openPublish() (tea.Model, tea.Cmd) {
+	publication, err := db.NotePublication(m.ListItemView.ID, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching note publication:", err)
+		return m, nil
+	}
+	m.Publish = PublishViewModel{Form: newPublishForm(publication != nil), Note: m.ListItemView, Publication: publication}
+	m.CurrentView = publishView
+	return m, m.Publish.Form.Init()
+}
+
+// updatePublish runs the publish form and applies the chosen action
+func (m Model) updatePublish(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" {
+		m.CurrentView = 3
+		return m, nil
+	}
+
+	f, cmd := m.Publish.Form.Update(msg)
+	m.Publish.Form = f.(*huh.Form)
+	if m.Publish.Form.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	action := m.Publish.Form.GetString("action")
+	if action == "revoke" {
+		if err := db.RevokePublication(m.Publish.Note.ID, m.User.user_id); err != nil {
+			fmt.Println("Error revoking publication:", err)
+			m.Publish.Status = "Could not revoke the link, please try again"
+		} else {
+			m.Publish.Publication = nil
+			m.Publish.Status = "The public link no longer works"
+		}
+	} else {
+		var expiresAt *time.Time
+		if lifetime, _ := time.ParseDuration(action); lifetime > 0 {
+			t := time.Now().Add(lifetime)
+			expiresAt = &t
+		}
+		publication, err := db.PublishNote(m.Publish.Note.ID, m.User.user_id, expiresAt)
+		if err != nil {
+			fmt.Println("Error publishing note:", err)
+			m.Publish.Status = "Could not publish the note, please try again"
+		} else {
+			m.Publish.Publication = &publication
+			m.Publish.Status = "Published, any previous link no longer works"
+		}
+	}
+
+	m.Publish.Form = newPublishForm(m.Publish.Publication != nil)
+	return m, m.Publish.Form.Init()
+}
+
+// sshHost is where ssh reaches the server, assuming the SSH server runs on the same host
+// as the HTTP listener
+func sshHost() string {
+	if u, err := url.Parse(web.BaseURL()); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+// sshAddress is sshHost as arguments to ssh
+func sshAddress() string {
+	return "-p 23236 " + sshHost()
+}
+
+// sshViewCommand is how a published note is opened in a terminal
+func sshViewCommand(slug string) string {
+	return "ssh -t " + sshAddress() + " view/" + slug
+}
+
+// Renders the current link above the form
+func (m PublishViewModel) View() string {
+	header := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9"))
+	link := "Not published."
+	if m.Publication != nil {
+		link = lipgloss.NewStyle().Underline(true).Render(web.PublicationURL(m.Publication.Slug)) +
+			"\nor in a terminal: " + sshViewCommand(m.Publication.Slug) +
+			"\nready to print: " + web.PublicationURL(m.Publication.Slug) + "/print"
+		if m.Publication.ExpiresAt != nil {
+			link += "\nexpires " + m.Publication.ExpiresAt.Local().Format("Jan 2, 2006 15:04 MST")
+		}
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		styles.Logostyle,
+		header.Render("Publish \""+m.Note.ItemTitle+"\""),
+		"",
+		link,
+		"",
+		styles.FormStyle.Width(60).Height(8).Align(lipgloss.Left).Render(m.Form.View()),
+		m.Status,
+		"esc: back to the note",
+	)
+}
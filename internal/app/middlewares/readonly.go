@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/ssh"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/styles"
+)
+
+// publishedSlug returns the slug of `ssh -t host view/<slug>` sessions
+func publishedSlug(s ssh.Session) (string, bool) {
+	command := s.Command()
+	if len(command) != 1 || !strings.HasPrefix(command[0], "view/") {
+		return "", false
+	}
+	slug := strings.TrimPrefix(command[0], "view/")
+	return slug, slug != ""
+}
+
+// newReadOnlyModel opens a published note without logging in. The model only
+// ever holds this one note and never talks to the database again.
+func newReadOnlyModel(slug string) (Model, error) {
+	item, err := db.PublishedNote(slug)
+	if err != nil {
+		return Model{}, err
+	}
+
+	v := viewport.New(100, 40)
+	out, _ := glamour.Render(item.Content, "dark")
+	v.SetContent(out)
+
+	return Model{
+		ReadOnly:     true,
+		CurrentView:  3,
+		ListItemView: item,
+		ViewportView: ViewportViewModel{Viewport: v},
+	}, nil
+}
+
+// updateReadOnly only lets the viewer scroll and quit
+func (m Model) updateReadOnly(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.ViewportView.Viewport.Width = min(msg.Width-4, 100)
+		m.ViewportView.Viewport.Height = msg.Height - 8
+		m.Dimensions.TotalHeight = msg.Height
+		m.Dimensions.TotalWidth = msg.Width
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.Quitting = true
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.ViewportView.Viewport, cmd = m.ViewportView.Viewport.Update(msg)
+	return m, cmd
+}
+
+// Renders the published note with its title, read-only
+func (m Model) readOnlyView() string {
+	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9")).Render(m.ListItemView.ItemTitle)
+	help := lipgloss.NewStyle().Faint(true).Render("read-only • ↑/↓: scroll • q: quit")
+	note := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		m.ListItemView.Desc,
+		styles.CenteredViewportStyle.Render(m.ViewportView.View()),
+		help,
+	)
+	return lipgloss.Place(m.Dimensions.TotalWidth, m.Dimensions.TotalHeight, lipgloss.Center, lipgloss.Center, note)
+}
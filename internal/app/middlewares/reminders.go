@@ -0,0 +1,172 @@
+package middlewares
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/notify"
+)
+
+// Choices of the reminder form besides the tasks of the note, which use their index
+const (
+	remindNote      = -1
+	cancelReminders = -2
+)
+
+// toastDuration is how long a reminder stays on screen
+const toastDuration = 10 * time.Second
+
+// toastExpiredMsg hides the toast it was scheduled for, unless another one replaced it
+type toastExpiredMsg struct {
+	id int
+}
+
+// parseReminderTime reads when to remind, relative to now and in its time zone: "in 2h30m",
+// "45m", "17:30" (today, or tomorrow once past), "tomorrow", "tomorrow 8:15" or "2024-07-31 09:00"
+func parseReminderTime(s string, now time.Time) (time.Time, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	if d, err := time.ParseDuration(strings.TrimPrefix(s, "in ")); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("the reminder must be in the future")
+		}
+		return now.Add(d), nil
+	}
+
+	if at, err := time.ParseInLocation("2006-01-02 15:04", s, now.Location()); err == nil {
+		if !at.After(now) {
+			return time.Time{}, fmt.Errorf("the reminder must be in the future")
+		}
+		return at, nil
+	}
+
+	day, clock := now, s
+	if rest, ok := strings.CutPrefix(s, "tomorrow"); ok {
+		day, clock = now.AddDate(0, 0, 1), strings.TrimSpace(rest)
+		if clock == "" {
+			clock = "9:00"
+		}
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("use a time like 17:30, tomorrow 9:00, in 2h or 2024-07-31 09:00")
+	}
+	at := time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, nil
+}
+
+// openReminderForm asks what to be reminded of in the note in the viewer, and when
+func (m Model) openReminderForm() (tea.Model, tea.Cmd) {
+	pending, err := db.PendingReminders(m.ListItemView.ID, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching reminders:", err)
+	}
+
+	options := []huh.Option[int]{huh.NewOption("this note", remindNote)}
+	for index, t := range models.ParseTasks(m.ListItemView.Content) {
+		if !t.Done {
+			options = append(options, huh.NewOption("task: "+t.Text, index))
+		}
+	}
+	title := "Remind me about"
+	if len(pending) > 0 {
+		options = append(options, huh.NewOption(fmt.Sprintf("cancel my %d pending reminders", len(pending)), cancelReminders))
+		title = "Remind me about, next reminder " + pending[0].RemindAt.In(m.location()).Format("Mon 2 Jan 15:04")
+	}
+
+	about := remindNote
+	location := m.location()
+	m.ReminderForm = huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int]().Title(title).Key("about").Options(options...).Value(&about),
+		),
+		huh.NewGroup(
+			huh.NewInput().Title("When, e.g. 17:30, tomorrow 9:00, in 2h").Key("when").Validate(func(s string) error {
+				_, err := parseReminderTime(s, time.Now().In(location))
+				return err
+			}),
+		).WithHideFunc(func() bool { return about == cancelReminders }),
+	)
+	return m, m.ReminderForm.Init()
+}
+
+// updateReminderForm runs the reminder form and schedules the reminder once submitted
+func (m Model) updateReminderForm(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" {
+		m.ReminderForm = nil
+		return m, nil
+	}
+	f, cmd := m.ReminderForm.Update(msg)
+	m.ReminderForm = f.(*huh.Form)
+	if m.ReminderForm.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	about := m.ReminderForm.GetInt("about")
+	when := m.ReminderForm.GetString("when")
+	m.ReminderForm = nil
+	if about == cancelReminders {
+		if err := db.CancelReminders(m.ListItemView.ID, m.User.user_id); err != nil {
+			fmt.Println("Error cancelling reminders:", err)
+		}
+		return m, nil
+	}
+
+	at, err := parseReminderTime(when, time.Now().In(m.location()))
+	if err != nil {
+		return m, nil
+	}
+	task := ""
+	if tasks := models.ParseTasks(m.ListItemView.Content); about >= 0 && about < len(tasks) {
+		task = tasks[about].Text
+	}
+	if _, err := db.AddReminder(m.User.user_id, m.ListItemView.ID, task, at); err != nil {
+		fmt.Println("Error adding reminder:", err)
+	}
+	return m, nil
+}
+
+// showToast pops a reminder up over whatever view is open
+func (m Model) showToast(msg notify.ToastMsg) (tea.Model, tea.Cmd) {
+	m.toastID++
+	m.Toast = msg.Notification.Body
+	id := m.toastID
+	return m, tea.Tick(toastDuration, func(time.Time) tea.Msg { return toastExpiredMsg{id} })
+}
+
+// toast shows a message of the app itself in a toast
+func toast(text string) notify.ToastMsg {
+	return notify.ToastMsg{Notification: db.Notification{Body: text}}
+}
+
+// overlayToast draws the toast over the top right corner of the rendered view
+func overlayToast(view, toast string, width int) string {
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("#F25D94")).
+		Padding(0, 1).
+		Width(min(40, max(width-4, 10))).
+		Render("⏰ " + toast)
+
+	lines := strings.Split(view, "\n")
+	x := max(width-lipgloss.Width(box)-1, 0)
+	for index, line := range strings.Split(box, "\n") {
+		row := index + 1
+		for row >= len(lines) {
+			lines = append(lines, "")
+		}
+		left := ansi.Truncate(lines[row], x, "")
+		lines[row] = left + strings.Repeat(" ", max(x-ansi.StringWidth(left), 0)) + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,171 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/scp"
+
+	"notion_ssh_app/internal/app/blobs"
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+)
+
+// Errors scp shows the user, the session ends with them
+var (
+	errScpKey      = errors.New("log in to the app with this SSH key and link it from the export dialog (ctrl+x), then copy again")
+	errScpNote     = errors.New("no note you can read by that title or id, copy to host:<note id> or host:\"<note title>\"")
+	errScpEditor   = errors.New("only editors of the note can attach files to it")
+	errScpPrivate  = errors.New("private notes cannot have attachments, they are stored unencrypted")
+	errScpQuota    = errors.New("that does not fit in what is left of your attachment quota")
+	errScpFolder   = errors.New("attach files one by one, folders cannot be attached")
+	errScpNotFound = errors.New("the note has no attachment by that name")
+	errScpFailed   = errors.New("something went wrong, please try again")
+)
+
+// AttachmentsMiddleware lets scp upload attachments to a note, like
+// `scp -O -P 23236 photo.png host:12`, and download them, like `scp -O -P 23236 host:12/photo.png .`
+// or `host:12/*` for all of them. Notes are named by ID or title.
+func AttachmentsMiddleware() wish.Middleware {
+	return scp.Middleware(scpHandler{}, scpHandler{})
+}
+
+// scpHandler maps scp paths to notes and their attachments
+type scpHandler struct{}
+
+// scpUser returns the user the session's SSH key is linked to
+func scpUser(s ssh.Session) (int, error) {
+	userID, err := sessionUser(s)
+	if err == db.ErrUnknownKey {
+		return 0, errScpKey
+	}
+	if err != nil {
+		fmt.Println("Error identifying ssh key:", err)
+		return 0, errScpFailed
+	}
+	return userID, nil
+}
+
+// scpNote finds the note a path names, by ID or title
+func scpNote(userID int, ref string) (models.ListItemViewModel, error) {
+	ref = strings.Trim(ref, "/~ ")
+	if ref == "" || ref == "." {
+		return models.ListItemViewModel{}, errScpNote
+	}
+	item, err := db.FindItem(ref, userID)
+	if err == db.ErrForbidden {
+		return item, errScpNote
+	}
+	if err != nil {
+		fmt.Println("Error fetching note:", err)
+		return item, errScpFailed
+	}
+	return item, nil
+}
+
+// Mkdir refuses recursive uploads
+func (scpHandler) Mkdir(ssh.Session, *scp.DirEntry) error {
+	return errScpFolder
+}
+
+// Write attaches an uploaded file to the note named by the target path
+func (scpHandler) Write(s ssh.Session, entry *scp.FileEntry) (int64, error) {
+	userID, err := scpUser(s)
+	if err != nil {
+		return 0, err
+	}
+	item, err := scpNote(userID, path.Dir(entry.Filepath))
+	if err != nil {
+		return 0, err
+	}
+	a, err := storeAttachment(userID, item.ID, entry.Name, entry.Size, entry.Reader)
+	switch {
+	case err == db.ErrForbidden:
+		return 0, errScpEditor
+	case err == db.ErrPrivateNote:
+		return 0, errScpPrivate
+	case err == db.ErrQuotaExceeded:
+		return 0, errScpQuota
+	case err != nil:
+		fmt.Println("Error storing attachment:", err)
+		return 0, errScpFailed
+	}
+	return a.Size, nil
+}
+
+// Glob expands <note>/* to every attachment of the note
+func (scpHandler) Glob(s ssh.Session, pattern string) ([]string, error) {
+	dir, name := path.Split(strings.TrimLeft(pattern, "/~"))
+	if name != "*" {
+		return []string{pattern}, nil
+	}
+	userID, err := scpUser(s)
+	if err != nil {
+		return nil, err
+	}
+	item, err := scpNote(userID, dir)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := db.NoteAttachments(item.ID, userID)
+	if err != nil {
+		fmt.Println("Error fetching attachments:", err)
+		return nil, errScpFailed
+	}
+	var matches []string
+	for _, a := range attachments {
+		matches = append(matches, dir+a.Name)
+	}
+	return matches, nil
+}
+
+// WalkDir refuses recursive downloads
+func (scpHandler) WalkDir(ssh.Session, string, fs.WalkDirFunc) error {
+	return errScpFolder
+}
+
+// NewDirEntry refuses recursive downloads
+func (scpHandler) NewDirEntry(ssh.Session, string) (*scp.DirEntry, error) {
+	return nil, errScpFolder
+}
+
+// NewFileEntry opens the attachment a path names as <note>/<name>
+func (scpHandler) NewFileEntry(s ssh.Session, name string) (*scp.FileEntry, func() error, error) {
+	userID, err := scpUser(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	dir, file := path.Split(strings.TrimLeft(name, "/~"))
+	item, err := scpNote(userID, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := db.FindAttachment(item.ID, userID, file)
+	if err == db.ErrNoAttachment {
+		return nil, nil, errScpNotFound
+	}
+	if err != nil {
+		fmt.Println("Error fetching attachment:", err)
+		return nil, nil, errScpFailed
+	}
+	blob, err := blobs.Default.Open(a.BlobKey)
+	if err != nil {
+		fmt.Println("Error opening attachment:", err)
+		return nil, nil, errScpFailed
+	}
+	entry := &scp.FileEntry{
+		Name:     a.Name,
+		Filepath: name,
+		Mode:     0o644,
+		Size:     a.Size,
+		Mtime:    a.CreatedAt.Unix(),
+		Atime:    a.CreatedAt.Unix(),
+		Reader:   blob,
+	}
+	return entry, blob.Close, nil
+}
@@ -0,0 +1,112 @@
+package middlewares
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/notify"
+	"notion_ssh_app/internal/styles"
+)
+
+// Define the share dialog model struct
+type ShareViewModel struct {
+	Form   *huh.Form
+	Note   models.ListItemViewModel
+	Shares []db.Share
+	Status string
+}
+
+// newShareForm builds the invite form of the share dialog
+func newShareForm() *huh.Form {
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().Title("Invite by email").Key("email"),
+			huh.NewSelect[string]().Title("Role").Key("role").Options(
+				huh.NewOption("viewer", models.RoleViewer.String()),
+				huh.NewOption("commenter", models.RoleCommenter.String()),
+				huh.NewOption("editor", models.RoleEditor.String()),
+				huh.NewOption("remove access", models.RoleNone.String()),
+			),
+		),
+	)
+}
+
+// openShare shows the share dialog for the note in the viewer
+func (m Model) openShare() (tea.Model, tea.Cmd) {
+	shares, err := db.NoteShares(m.ListItemView.ID, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching note shares:", err)
+		return m, nil
+	}
+	m.Share = ShareViewModel{Form: newShareForm(), Note: m.ListItemView, Shares: shares}
+	m.CurrentView = shareView
+	return m, m.Share.Form.Init()
+}
+
+// updateShare runs the invite form and applies it once submitted
+func (m Model) updateShare(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" {
+		m.CurrentView = 3
+		return m, nil
+	}
+
+	f, cmd := m.Share.Form.Update(msg)
+	m.Share.Form = f.(*huh.Form)
+	if m.Share.Form.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	email := strings.TrimSpace(m.Share.Form.GetString("email"))
+	role := models.ParseRole(m.Share.Form.GetString("role"))
+	userID, err := db.ShareNote(m.Share.Note.ID, m.User.user_id, email, role)
+	switch {
+	case err == db.ErrUnknownUser:
+		m.Share.Status = email + " has no account yet"
+	case err != nil:
+		fmt.Println("Error sharing note:", err)
+		m.Share.Status = "Could not share the note, please try again"
+	case role == models.RoleNone:
+		m.Share.Status = email + " no longer has access"
+	default:
+		m.Share.Status = email + " is now a " + role.String()
+		notify.ShareGranted(m.Share.Note.ID, m.Share.Note.Subject(), m.User.user_id, m.User.email, userID, role)
+	}
+
+	// Start over with a fresh form so several people can be invited in a row
+	if shares, err := db.NoteShares(m.Share.Note.ID, m.User.user_id); err == nil {
+		m.Share.Shares = shares
+	}
+	m.Share.Form = newShareForm()
+	return m, m.Share.Form.Init()
+}
+
+// Renders the current grants above the invite form
+func (m ShareViewModel) View() string {
+	header := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9"))
+
+	members := "Only you can see this note."
+	if len(m.Shares) > 0 {
+		var lines []string
+		for _, share := range m.Shares {
+			lines = append(lines, fmt.Sprintf("%-36s %s", share.Email, share.Role))
+		}
+		members = strings.Join(lines, "\n")
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		styles.Logostyle,
+		header.Render("Share \""+m.Note.Title()+"\""),
+		"",
+		members,
+		"",
+		styles.FormStyle.Width(50).Height(8).Align(lipgloss.Left).Render(m.Form.View()),
+		m.Status,
+		"esc: back to the note",
+	)
+}
@@ -0,0 +1,211 @@
+package middlewares
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/gitstore"
+	"notion_ssh_app/internal/app/models"
+)
+
+// Define the tasks model struct, listing the checklist items of every note
+type TasksViewModel struct {
+	List     list.Model
+	ShowDone bool
+	Status   string
+}
+
+// taskItem makes a task selectable in the tasks list
+type taskItem struct {
+	models.Task
+	today time.Time
+}
+
+func (i taskItem) FilterValue() string { return i.Text }
+func (i taskItem) Title() string {
+	if i.Done {
+		return "[x] " + i.Text
+	}
+	return "[ ] " + i.Text
+}
+func (i taskItem) Description() string {
+	switch {
+	case i.Due.IsZero():
+		return i.NoteTitle
+	case !i.Done && i.Due.Before(i.today):
+		return i.NoteTitle + " · overdue since " + i.Due.Format("Mon 2 Jan")
+	}
+	return i.NoteTitle + " · due " + i.Due.Format("Mon 2 Jan")
+}
+
+// openTasks shows the open tasks of every note the user has access to
+func (m Model) openTasks() (tea.Model, tea.Cmd) {
+	l := list.New(nil, list.NewDefaultDelegate(), 70, max(m.Dimensions.TotalHeight-10, 10))
+	l.Title = "my tasks -> "
+	m.Tasks = TasksViewModel{List: l, ShowDone: m.Tasks.ShowDone}
+	m.CurrentView = tasksView
+	return m.loadTasks(), nil
+}
+
+// loadTasks fetches the tasks again, keeping the selection where it was
+func (m Model) loadTasks() Model {
+	tasks, err := db.FetchTasks(m.User.user_id, m.Tasks.ShowDone)
+	if err != nil {
+		fmt.Println("Error fetching tasks:", err)
+		m.Tasks.Status = "Could not load the tasks"
+		return m
+	}
+	now := time.Now().In(m.location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var items []list.Item
+	for _, t := range tasks {
+		items = append(items, taskItem{t, today})
+	}
+	index := m.Tasks.List.Index()
+	m.Tasks.List.SetItems(items)
+	m.Tasks.List.Select(min(index, max(len(items)-1, 0)))
+	return m
+}
+
+// updateTasks toggles tasks and opens the notes they belong to
+func (m Model) updateTasks(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && m.Tasks.List.FilterState() != list.Filtering {
+		selected, isTask := m.Tasks.List.SelectedItem().(taskItem)
+		switch key.String() {
+		case "esc":
+			m.CurrentView = 1
+			return m, nil
+		case "a":
+			m.Tasks.ShowDone = !m.Tasks.ShowDone
+			return m.loadTasks(), nil
+		case " ", "x":
+			if !isTask {
+				return m, nil
+			}
+			m.Tasks.Status = m.setTaskDone(selected.Task, !selected.Done)
+			return m.loadTasks(), nil
+		case "enter":
+			if !isTask {
+				return m, nil
+			}
+			item, err := db.FetchItem(selected.NoteID, m.User.user_id)
+			if err != nil {
+				fmt.Println("Error fetching note:", err)
+				return m, nil
+			}
+			m = m.openViewer(item)
+			m.ViewerBack = tasksView
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Tasks.List, cmd = m.Tasks.List.Update(msg)
+	return m, cmd
+}
+
+// setTaskDone checks or unchecks a task in its note, returning what went wrong for the user
+func (m Model) setTaskDone(task models.Task, done bool) string {
+	if task.Role < models.RoleEditor {
+		return "Only editors of " + task.NoteTitle + " can check its tasks"
+	}
+	_, err := db.SetTaskDone(m.User.user_id, task, done)
+	switch {
+	case err == db.ErrVersionConflict:
+		return task.NoteTitle + " changed meanwhile, please try again"
+	case err != nil:
+		fmt.Println("Error updating task:", err)
+		return "Could not update the task, please try again"
+	}
+	gitstore.NoteSaved(task.NoteID, m.User.user_id, "Update a task in "+task.NoteTitle)
+	return ""
+}
+
+// openTaskForm lists the tasks of the note in the viewer to check and uncheck them.
+// Private notes are stored sealed, so their tasks are only checked in the editor.
+func (m Model) openTaskForm() (tea.Model, tea.Cmd) {
+	tasks := models.ParseTasks(m.ListItemView.Content)
+	if len(tasks) == 0 || m.ListItemView.Private {
+		return m, nil
+	}
+	var options []huh.Option[int]
+	var done []int
+	for index, t := range tasks {
+		options = append(options, huh.NewOption(t.Text, index))
+		if t.Done {
+			done = append(done, index)
+		}
+	}
+	m.TaskForm = huh.NewForm(huh.NewGroup(
+		huh.NewMultiSelect[int]().Title("Done").Key("done").Options(options...).Value(&done),
+	))
+	return m, m.TaskForm.Init()
+}
+
+// updateTaskForm runs the task form and saves the tasks whose state changed
+func (m Model) updateTaskForm(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" {
+		m.TaskForm = nil
+		return m, nil
+	}
+	f, cmd := m.TaskForm.Update(msg)
+	m.TaskForm = f.(*huh.Form)
+	if m.TaskForm.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	done := map[int]bool{}
+	selected, _ := m.TaskForm.Get("done").([]int)
+	for _, index := range selected {
+		done[index] = true
+	}
+	m.TaskForm = nil
+	if m.ListItemView.Private {
+		return m, nil
+	}
+	failed := ""
+	for index, t := range models.ParseTasks(m.ListItemView.Content) {
+		if t.Done == done[index] {
+			continue
+		}
+		t.NoteID, t.NoteTitle, t.Role = m.ListItemView.ID, m.ListItemView.ItemTitle, m.ListItemView.Role
+		if status := m.setTaskDone(t, done[index]); status != "" && failed == "" {
+			failed = status
+		}
+	}
+	m = m.reloadViewer()
+	if failed != "" {
+		return m.showToast(toast(failed))
+	}
+	return m, nil
+}
+
+// reloadViewer fetches the note in the viewer again and renders it
+func (m Model) reloadViewer() Model {
+	item, err := db.FetchItem(m.ListItemView.ID, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching note:", err)
+		return m
+	}
+	m.replaceItem(item)
+	back := m.ViewerBack
+	m = m.openViewer(item)
+	m.ViewerBack = back
+	return m
+}
+
+// Renders the tasks list
+func (m TasksViewModel) View() string {
+	help := "space: check/uncheck • enter: open note • a: show done • esc: back"
+	if m.ShowDone {
+		help = "space: check/uncheck • enter: open note • a: hide done • esc: back"
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, m.List.View(), m.Status, lipgloss.NewStyle().Faint(true).Render(help))
+}
@@ -0,0 +1,208 @@
+package middlewares
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/styles"
+)
+
+// Define the template picker model struct, shown before the editor when composing a note
+type TemplatesViewModel struct {
+	List   list.Model
+	Form   *huh.Form       // fields of the chosen template being filled in, nil otherwise
+	Chosen models.Template // template the form fills in
+	Status string
+}
+
+// templateItem makes a template selectable in the picker; the zero template is a blank note
+type templateItem struct {
+	models.Template
+}
+
+func (i templateItem) FilterValue() string { return i.Name }
+func (i templateItem) Title() string {
+	if i.Name == "" {
+		return "Blank note"
+	}
+	return i.Name
+}
+func (i templateItem) Description() string {
+	switch {
+	case i.Name == "":
+		return "start from scratch"
+	case i.ID == 0:
+		return "built in"
+	case i.WorkspaceID != 0:
+		return "workspace template"
+	}
+	return "personal template"
+}
+
+// openTemplates shows the template picker
+func (m Model) openTemplates() (tea.Model, tea.Cmd) {
+	templates, err := db.FetchTemplates(m.User.user_id, m.Workspace.ID)
+	if err != nil {
+		fmt.Println("Error fetching templates:", err)
+	}
+	items := []list.Item{templateItem{}}
+	for _, t := range append(templates, models.BuiltinTemplates...) {
+		items = append(items, templateItem{t})
+	}
+
+	l := list.New(items, list.NewDefaultDelegate(), 50, max(m.Dimensions.TotalHeight-10, 10))
+	l.Title = "new note from -> "
+	m.Templates = TemplatesViewModel{List: l}
+	m.CurrentView = templateView
+	return m, nil
+}
+
+// updateTemplates handles the picker and the form asking for the template's fields
+func (m Model) updateTemplates(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, isKey := msg.(tea.KeyMsg)
+
+	if m.Templates.Form != nil {
+		if isKey && key.String() == "esc" {
+			m.Templates.Form = nil
+			return m, nil
+		}
+		f, cmd := m.Templates.Form.Update(msg)
+		m.Templates.Form = f.(*huh.Form)
+		if m.Templates.Form.State != huh.StateCompleted {
+			return m, cmd
+		}
+		values := map[string]string{}
+		for _, field := range m.Templates.Chosen.Fields() {
+			values[field] = strings.TrimSpace(m.Templates.Form.GetString(field))
+		}
+		m.Templates.Form = nil
+		return m.composeFromTemplate(m.Templates.Chosen, values), nil
+	}
+
+	if isKey && m.Templates.List.FilterState() != list.Filtering {
+		selected, _ := m.Templates.List.SelectedItem().(templateItem)
+		switch key.String() {
+		case "esc":
+			m.CurrentView = 1
+			return m, nil
+
+		case "enter":
+			fields := selected.Fields()
+			if len(fields) == 0 {
+				return m.composeFromTemplate(selected.Template, nil), nil
+			}
+			var inputs []huh.Field
+			for _, field := range fields {
+				inputs = append(inputs, huh.NewInput().Title(field).Key(field))
+			}
+			m.Templates.Chosen = selected.Template
+			m.Templates.Form = huh.NewForm(huh.NewGroup(inputs...))
+			return m, m.Templates.Form.Init()
+
+		case "x":
+			if selected.ID == 0 || !selected.CanDelete {
+				m.Templates.Status = "Only the author or a workspace admin can delete this template"
+				return m, nil
+			}
+			if err := db.DeleteTemplate(selected.ID, m.User.user_id); err != nil {
+				fmt.Println("Error deleting template:", err)
+				m.Templates.Status = "Could not delete the template, please try again"
+				return m, nil
+			}
+			m.Templates.List.RemoveItem(m.Templates.List.Index())
+			m.Templates.Status = selected.Name + " was deleted"
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Templates.List, cmd = m.Templates.List.Update(msg)
+	return m, cmd
+}
+
+// composeFromTemplate opens the editor on a new note filled in from the template
+func (m Model) composeFromTemplate(t models.Template, values map[string]string) Model {
+	if values == nil {
+		values = map[string]string{}
+	}
+	now := time.Now().In(m.location())
+	values["date"] = now.Format(models.DateLayout)
+	values["time"] = now.Format("15:04")
+	values["user"] = m.User.email
+	values["workspace"] = m.Workspace.Name
+
+	m = m.leaveCollab()
+	m.Editing = nil
+	m.TextareaView.Textarea.Reset()
+	m.ViewportView.setContent("")
+	text := ""
+	if t.Name != "" {
+		text = models.EditorText(t.Expand(values))
+	}
+	return m.openEditor(text)
+}
+
+// openSaveTemplate asks how to add the note in the viewer to the template library
+func (m Model) openSaveTemplate() (tea.Model, tea.Cmd) {
+	scopes := []huh.Option[int]{huh.NewOption("just for me", 0)}
+	if m.Workspace.ID != 0 && m.Workspace.Role != models.WorkspaceGuest {
+		scopes = append(scopes, huh.NewOption("everyone in "+m.Workspace.Name, m.Workspace.ID))
+	}
+	name := m.ListItemView.ItemTitle
+	m.TemplateForm = huh.NewForm(huh.NewGroup(
+		huh.NewInput().Title("Template name, use {{name}} in the note for fields to fill in").Key("name").Value(&name),
+		huh.NewSelect[int]().Title("Available to").Key("workspace").Options(scopes...),
+	))
+	return m, m.TemplateForm.Init()
+}
+
+// updateSaveTemplate runs the save-as-template form and stores the template once submitted
+func (m Model) updateSaveTemplate(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" {
+		m.TemplateForm = nil
+		return m, nil
+	}
+	f, cmd := m.TemplateForm.Update(msg)
+	m.TemplateForm = f.(*huh.Form)
+	if m.TemplateForm.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	t := models.Template{
+		Name:        strings.TrimSpace(m.TemplateForm.GetString("name")),
+		WorkspaceID: m.TemplateForm.GetInt("workspace"),
+		Title:       m.ListItemView.ItemTitle,
+		Desc:        m.ListItemView.Desc,
+		Content:     m.ListItemView.Content,
+	}
+	m.TemplateForm = nil
+	if t.Name == "" {
+		return m, nil
+	}
+	if _, err := db.SaveTemplate(m.User.user_id, t); err != nil {
+		fmt.Println("Error saving template:", err)
+	}
+	return m, nil
+}
+
+// Renders the picker, or the form asking for the template's fields
+func (m TemplatesViewModel) View() string {
+	faint := lipgloss.NewStyle().Faint(true)
+	if m.Form != nil {
+		return lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9")).Render(m.Chosen.Name),
+			styles.FormStyle.Width(60).Align(lipgloss.Left).Render(m.Form.View()),
+			faint.Render("esc: back to the templates"),
+		)
+	}
+	help := "enter: use • x: delete template • esc: back • save a note as template with T in the viewer"
+	return lipgloss.JoinVertical(lipgloss.Left, m.List.View(), m.Status, faint.Render(help))
+}
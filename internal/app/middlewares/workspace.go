@@ -0,0 +1,231 @@
+package middlewares
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/styles"
+)
+
+// The personal space holds the notes that belong to no workspace
+var personalWorkspace = db.Workspace{Name: "Personal", Role: models.WorkspaceOwner}
+
+// Forms the workspace switcher can show instead of its list
+const (
+	workspacePicking = iota
+	workspaceCreating
+	workspaceInviting
+)
+
+// Define the workspace switcher model struct
+type WorkspaceViewModel struct {
+	List    list.Model
+	Form    *huh.Form
+	Mode    int
+	Members []db.Member
+	Status  string
+}
+
+// workspaceItem makes a workspace selectable in the switcher list
+type workspaceItem struct {
+	db.Workspace
+}
+
+func (i workspaceItem) FilterValue() string { return i.Name }
+func (i workspaceItem) Title() string       { return i.Name }
+func (i workspaceItem) Description() string {
+	if i.ID == 0 {
+		return "your own notes"
+	}
+	return "you are " + string(i.Role)
+}
+
+// openWorkspaces shows the switcher with every workspace the user belongs to
+func (m Model) openWorkspaces() (tea.Model, tea.Cmd) {
+	workspaces, err := db.FetchWorkspaces(m.User.user_id)
+	if err != nil {
+		fmt.Println("Error fetching workspaces:", err)
+		return m, nil
+	}
+	items := []list.Item{workspaceItem{personalWorkspace}}
+	for _, w := range workspaces {
+		items = append(items, workspaceItem{w})
+	}
+
+	l := list.New(items, list.NewDefaultDelegate(), 50, 16)
+	l.Title = "workspaces -> "
+	l.SetFilteringEnabled(false)
+	for index, item := range items {
+		if item.(workspaceItem).ID == m.Workspace.ID {
+			l.Select(index)
+		}
+	}
+	m.Workspaces = WorkspaceViewModel{List: l}
+	m.CurrentView = workspaceView
+	return m, nil
+}
+
+// updateWorkspaces handles the switcher list and its create and invite forms
+func (m Model) updateWorkspaces(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, isKey := msg.(tea.KeyMsg)
+
+	if m.Workspaces.Mode != workspacePicking {
+		if isKey && key.String() == "esc" {
+			m.Workspaces.Mode = workspacePicking
+			return m, nil
+		}
+		f, cmd := m.Workspaces.Form.Update(msg)
+		m.Workspaces.Form = f.(*huh.Form)
+		if m.Workspaces.Form.State != huh.StateCompleted {
+			return m, cmd
+		}
+		if m.Workspaces.Mode == workspaceCreating {
+			return m.createWorkspace()
+		}
+		return m.inviteMember()
+	}
+
+	if isKey {
+		selected, _ := m.Workspaces.List.SelectedItem().(workspaceItem)
+		switch key.String() {
+		case "esc":
+			m.CurrentView = 1
+			return m, nil
+
+		case "enter":
+			// Switch and load the notes of the chosen workspace
+			m.Workspace = selected.Workspace
+			m.CurrentView = 1
+			userID, workspaceID := m.User.user_id, m.Workspace.ID
+			return m, func() tea.Msg { return db.FetchItems(userID, workspaceID) }
+
+		case "n":
+			m.Workspaces.Mode = workspaceCreating
+			m.Workspaces.Form = huh.NewForm(huh.NewGroup(huh.NewInput().Title("Workspace name").Key("name")))
+			return m, m.Workspaces.Form.Init()
+
+		case "i":
+			if selected.ID == 0 || !selected.Role.CanManage() {
+				m.Workspaces.Status = "Only owners and admins can manage members"
+				return m, nil
+			}
+			members, err := db.WorkspaceMembers(selected.ID, m.User.user_id)
+			if err != nil {
+				fmt.Println("Error fetching workspace members:", err)
+				return m, nil
+			}
+			m.Workspaces.Members = members
+			m.Workspaces.Mode = workspaceInviting
+			m.Workspaces.Form = newMemberForm(selected.Role)
+			return m, m.Workspaces.Form.Init()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.Workspaces.List, cmd = m.Workspaces.List.Update(msg)
+	return m, cmd
+}
+
+// newMemberForm builds the invite form; admin rights can only be handed out by owners
+func newMemberForm(role models.WorkspaceRole) *huh.Form {
+	options := []huh.Option[string]{
+		huh.NewOption("member", string(models.WorkspaceMember)),
+		huh.NewOption("guest", string(models.WorkspaceGuest)),
+		huh.NewOption("remove from workspace", ""),
+	}
+	if role == models.WorkspaceOwner {
+		options = append([]huh.Option[string]{huh.NewOption("admin", string(models.WorkspaceAdmin))}, options...)
+	}
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().Title("Invite by email").Key("email"),
+			huh.NewSelect[string]().Title("Role").Key("role").Options(options...),
+		),
+	)
+}
+
+// createWorkspace creates the workspace named in the form and switches to it
+func (m Model) createWorkspace() (tea.Model, tea.Cmd) {
+	name := strings.TrimSpace(m.Workspaces.Form.GetString("name"))
+	m.Workspaces.Mode = workspacePicking
+	if name == "" {
+		return m, nil
+	}
+	w, err := db.CreateWorkspace(name, m.User.user_id)
+	if err != nil {
+		fmt.Println("Error creating workspace:", err)
+		m.Workspaces.Status = "Could not create the workspace, please try again"
+		return m, nil
+	}
+	m.Workspace = w
+	m.CurrentView = 1
+	userID := m.User.user_id
+	return m, func() tea.Msg { return db.FetchItems(userID, w.ID) }
+}
+
+// inviteMember applies the invite form to the selected workspace
+func (m Model) inviteMember() (tea.Model, tea.Cmd) {
+	selected, _ := m.Workspaces.List.SelectedItem().(workspaceItem)
+	email := strings.TrimSpace(m.Workspaces.Form.GetString("email"))
+	role := models.WorkspaceRole(m.Workspaces.Form.GetString("role"))
+
+	switch err := db.SetWorkspaceMember(selected.ID, m.User.user_id, email, role); {
+	case err == db.ErrUnknownUser:
+		m.Workspaces.Status = email + " has no account yet"
+	case err == db.ErrForbidden:
+		m.Workspaces.Status = "Only owners can change admins"
+	case err != nil:
+		fmt.Println("Error updating workspace member:", err)
+		m.Workspaces.Status = "Could not update the member, please try again"
+	case role == "":
+		m.Workspaces.Status = email + " was removed from " + selected.Name
+	default:
+		m.Workspaces.Status = email + " is now a " + string(role) + " of " + selected.Name
+	}
+
+	if members, err := db.WorkspaceMembers(selected.ID, m.User.user_id); err == nil {
+		m.Workspaces.Members = members
+	}
+	m.Workspaces.Form = newMemberForm(selected.Role)
+	return m, m.Workspaces.Form.Init()
+}
+
+// Renders the switcher, or the form it is showing
+func (m WorkspaceViewModel) View() string {
+	var body string
+	switch m.Mode {
+	case workspaceCreating:
+		body = styles.FormStyle.Width(50).Height(5).Align(lipgloss.Left).Render(m.Form.View())
+	case workspaceInviting:
+		var lines []string
+		for _, member := range m.Members {
+			lines = append(lines, fmt.Sprintf("%-36s %s", member.Email, member.Role))
+		}
+		body = lipgloss.JoinVertical(lipgloss.Left,
+			strings.Join(lines, "\n"),
+			"",
+			styles.FormStyle.Width(50).Height(8).Align(lipgloss.Left).Render(m.Form.View()),
+		)
+	default:
+		body = m.List.View()
+	}
+
+	help := "enter: switch • n: new workspace • i: manage members • esc: back"
+	if m.Mode != workspacePicking {
+		help = "esc: back to workspaces"
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, body, m.Status, help)
+}
+
+// workspaceHeader shows which workspace the list belongs to
+func (m Model) workspaceHeader() string {
+	name := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7571F9")).Render("▣ " + m.Workspace.Name)
+	return name + lipgloss.NewStyle().Faint(true).Render("  ctrl+w: switch workspace • ctrl+d: databases • ctrl+l: calendar • ctrl+t: today • ctrl+k: tasks • ctrl+x: export")
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// BackupFormat names the JSON backup format, BackupVersion its schema. Restoring accepts every
+// version up to BackupVersion; bump it when a field changes meaning or becomes required.
+const (
+	BackupFormat  = "notion_ssh_app/backup"
+	BackupVersion = 1
+)
+
+// ErrBackupChecksum is returned when a backup was damaged or truncated after it was written. Anyone
+// can compute the checksum, so it tells nothing about who wrote the backup.
+var ErrBackupChecksum = errors.New("backup checksum does not match its content")
+
+// Backup is a lossless copy of a workspace, or of a user's personal space when Workspace is
+// nil. IDs are the ones of the instance it was taken from and only link records of the backup
+// to each other; users are referred to by email since IDs differ between instances.
+type Backup struct {
+	Format      string             `json:"format"`
+	Version     int                `json:"version"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	Workspace   *BackupWorkspace   `json:"workspace"`
+	Collections []BackupCollection `json:"collections"`
+	Notes       []BackupNote       `json:"notes"`
+	Templates   []BackupTemplate   `json:"templates"`
+	Checksum    string             `json:"checksum"` // sha256 of the backup written with an empty checksum, catches damage but not edits
+}
+
+type BackupWorkspace struct {
+	Name    string         `json:"name"`
+	Members []BackupMember `json:"members"`
+}
+
+type BackupMember struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type BackupCollection struct {
+	ID         int              `json:"id"`
+	Name       string           `json:"name"`
+	Owner      string           `json:"owner"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	Properties []BackupProperty `json:"properties"`
+}
+
+type BackupProperty struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	Type       PropertyType `json:"type"`
+	Options    []string     `json:"options"`
+	RelationID int          `json:"relationId,omitempty"` // collection of the backup, 0 for none
+	Position   int          `json:"position"`
+}
+
+type BackupNote struct {
+	ID           int               `json:"id"`
+	Title        string            `json:"title"`
+	Description  string            `json:"description"`
+	Content      string            `json:"content"`
+	Private      bool              `json:"private,omitempty"` // title, description and content are sealed with the owner's passphrase
+	Version      int               `json:"version"`           // number of saves, the only revision history kept
+	Owner        string            `json:"owner"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+	Due          string            `json:"due,omitempty"`   // DateLayout
+	Daily        string            `json:"daily,omitempty"` // DateLayout
+	CollectionID int               `json:"collectionId,omitempty"`
+	Values       map[string]string `json:"values,omitempty"` // by property ID; relations hold note IDs of the backup
+	Shares       []BackupMember    `json:"shares,omitempty"`
+	Followers    []string          `json:"followers,omitempty"`
+	Comments     []BackupComment   `json:"comments,omitempty"`
+}
+
+type BackupComment struct {
+	ID        int       `json:"id"`
+	ParentID  int       `json:"parentId,omitempty"`
+	Author    string    `json:"author"`
+	LineStart int       `json:"lineStart"`
+	LineEnd   int       `json:"lineEnd"`
+	Body      string    `json:"body"`
+	Resolved  bool      `json:"resolved"`
+	Mentions  []string  `json:"mentions,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type BackupTemplate struct {
+	Name        string    `json:"name"`
+	Author      string    `json:"author"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Content     string    `json:"content"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// sum hashes the backup as written with an empty checksum
+func (b Backup) sum() (string, error) {
+	b.Checksum = ""
+	data, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Seal stamps the backup with its format, version and checksum
+func (b *Backup) Seal() error {
+	b.Format, b.Version = BackupFormat, BackupVersion
+	sum, err := b.sum()
+	b.Checksum = sum
+	return err
+}
+
+// Verify checks the backup can be restored: its format and version, its checksum and that every
+// ID it refers to belongs to a record of the backup
+func (b Backup) Verify() error {
+	if b.Format != BackupFormat {
+		return fmt.Errorf("not a backup of this app")
+	}
+	if b.Version < 1 || b.Version > BackupVersion {
+		return fmt.Errorf("backup version %d is not supported, this server reads up to version %d", b.Version, BackupVersion)
+	}
+	if sum, err := b.sum(); err != nil || sum != b.Checksum {
+		return ErrBackupChecksum
+	}
+
+	if b.Workspace != nil {
+		for _, m := range b.Workspace.Members {
+			switch WorkspaceRole(m.Role) {
+			case WorkspaceOwner, WorkspaceAdmin, WorkspaceMember, WorkspaceGuest:
+			default:
+				return fmt.Errorf("member %s has an unknown role %q", m.Email, m.Role)
+			}
+		}
+	}
+
+	collections := map[int]bool{}
+	properties := map[int]BackupProperty{}
+	for _, c := range b.Collections {
+		if collections[c.ID] {
+			return fmt.Errorf("collection %d appears twice", c.ID)
+		}
+		collections[c.ID] = true
+		for _, p := range c.Properties {
+			if _, ok := properties[p.ID]; ok {
+				return fmt.Errorf("property %d appears twice", p.ID)
+			}
+			properties[p.ID] = p
+		}
+	}
+	notes := map[int]bool{}
+	for _, n := range b.Notes {
+		if notes[n.ID] {
+			return fmt.Errorf("note %d appears twice", n.ID)
+		}
+		notes[n.ID] = true
+	}
+
+	for _, p := range properties {
+		if p.RelationID != 0 && !collections[p.RelationID] {
+			return fmt.Errorf("property %q relates to collection %d, which is not in the backup", p.Name, p.RelationID)
+		}
+	}
+	for _, n := range b.Notes {
+		if n.CollectionID != 0 && !collections[n.CollectionID] {
+			return fmt.Errorf("note %d belongs to collection %d, which is not in the backup", n.ID, n.CollectionID)
+		}
+		for _, date := range []string{n.Due, n.Daily} {
+			if _, err := time.Parse(DateLayout, date); date != "" && err != nil {
+				return fmt.Errorf("note %d has an invalid date %q", n.ID, date)
+			}
+		}
+		for id, value := range n.Values {
+			propertyID, err := strconv.Atoi(id)
+			p, ok := properties[propertyID]
+			if err != nil || !ok {
+				return fmt.Errorf("note %d has a value for property %s, which is not in the backup", n.ID, id)
+			}
+			if p.Type != PropertyRelation {
+				continue
+			}
+			for _, related := range SplitList(value) {
+				if noteID, err := strconv.Atoi(related); err != nil || !notes[noteID] {
+					return fmt.Errorf("note %d relates to note %s, which is not in the backup", n.ID, related)
+				}
+			}
+		}
+		for _, share := range n.Shares {
+			if role := ParseRole(share.Role); role == RoleNone || role == RoleOwner {
+				return fmt.Errorf("note %d is shared with %s as %q, which is not a role notes are shared with", n.ID, share.Email, share.Role)
+			}
+		}
+		comments := map[int]bool{}
+		for _, c := range n.Comments {
+			if c.ParentID != 0 && !comments[c.ParentID] {
+				return fmt.Errorf("comment %d replies to comment %d, which does not come before it on note %d", c.ID, c.ParentID, n.ID)
+			}
+			comments[c.ID] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testBackup is a valid backup with a relation between two pages and a comment thread
+func testBackup() Backup {
+	return Backup{
+		CreatedAt: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		Workspace: &BackupWorkspace{Name: "Team", Members: []BackupMember{{Email: "ada@example.com", Role: "owner"}}},
+		Collections: []BackupCollection{{ID: 1, Name: "Tasks", Properties: []BackupProperty{
+			{ID: 10, Name: "Status", Type: PropertyText},
+			{ID: 11, Name: "Blocks", Type: PropertyRelation, RelationID: 1},
+		}}},
+		Notes: []BackupNote{
+			{ID: 100, Title: "First", CollectionID: 1, Values: map[string]string{"10": "open", "11": "101"}, Due: "2026-11-01"},
+			{ID: 101, Title: "Second", CollectionID: 1, Shares: []BackupMember{{Email: "bob@example.com", Role: "editor"}},
+				Comments: []BackupComment{{ID: 1, Body: "why?"}, {ID: 2, ParentID: 1, Body: "because"}}},
+		},
+	}
+}
+
+func TestBackupSealVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Backup) // applied after sealing
+		reseal  bool          // seal again after the change
+		wantErr error         // nil for no error, errAny for any
+	}{
+		{name: "sealed backup verifies"},
+		{name: "edited content", change: func(b *Backup) { b.Notes[0].Content = "changed" }, wantErr: ErrBackupChecksum},
+		{name: "missing checksum", change: func(b *Backup) { b.Checksum = "" }, wantErr: ErrBackupChecksum},
+		{name: "other format", change: func(b *Backup) { b.Format = "something else" }, wantErr: errAny},
+		{name: "newer version", change: func(b *Backup) { b.Version = BackupVersion + 1 }, wantErr: errAny},
+		{name: "unknown member role", change: func(b *Backup) { b.Workspace.Members[0].Role = "root" }, reseal: true, wantErr: errAny},
+		{name: "duplicate note", change: func(b *Backup) { b.Notes[1].ID = 100 }, reseal: true, wantErr: errAny},
+		{name: "relation outside the backup", change: func(b *Backup) { b.Notes[0].Values["11"] = "999" }, reseal: true, wantErr: errAny},
+		{name: "value of an unknown property", change: func(b *Backup) { b.Notes[0].Values["12"] = "x" }, reseal: true, wantErr: errAny},
+		{name: "invalid date", change: func(b *Backup) { b.Notes[0].Due = "tomorrow" }, reseal: true, wantErr: errAny},
+		{name: "shared as owner", change: func(b *Backup) { b.Notes[1].Shares[0].Role = "owner" }, reseal: true, wantErr: errAny},
+		{name: "reply before its thread", change: func(b *Backup) {
+			c := b.Notes[1].Comments
+			c[0], c[1] = c[1], c[0]
+		}, reseal: true, wantErr: errAny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBackup()
+			if err := b.Seal(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != nil {
+				tt.change(&b)
+			}
+			if tt.reseal {
+				if err := b.Seal(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := b.Verify()
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("Verify() = %v, want no error", err)
+			case tt.wantErr == errAny && err == nil:
+				t.Error("Verify() = nil, want an error")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Errorf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in test tables
+var errAny = errors.New("any error")
@@ -0,0 +1,334 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PropertyType decides how the values of a database column are entered, stored and compared
+type PropertyType string
+
+const (
+	PropertyText        PropertyType = "text"
+	PropertyNumber      PropertyType = "number"
+	PropertySelect      PropertyType = "select"
+	PropertyMultiSelect PropertyType = "multi-select"
+	PropertyDate        PropertyType = "date"
+	PropertyCheckbox    PropertyType = "checkbox"
+	PropertyPerson      PropertyType = "person"   // email of a registered user
+	PropertyRelation    PropertyType = "relation" // pages of another database
+)
+
+// PropertyTypes lists every type in the order they are offered to the user
+var PropertyTypes = []PropertyType{
+	PropertyText, PropertyNumber, PropertySelect, PropertyMultiSelect,
+	PropertyDate, PropertyCheckbox, PropertyPerson, PropertyRelation,
+}
+
+// DateLayout is how date properties are entered and stored
+const DateLayout = "2006-01-02"
+
+// Property is a typed column of a database
+type Property struct {
+	ID         int
+	Name       string
+	Type       PropertyType
+	Options    []string       // allowed values of select and multi-select properties
+	RelationID int            // database the pages of a relation property belong to
+	Pages      map[int]string // titles of the related pages, by note ID
+}
+
+// Collection is a database whose rows are pages with typed properties
+type Collection struct {
+	ID          int
+	Name        string
+	WorkspaceID int
+	Role        Role // what the current user may do with the database itself
+	Properties  []Property
+}
+
+// Row is a page of a database along with its property values, stored by property ID
+type Row struct {
+	Note   ListItemViewModel
+	Values map[int]string
+}
+
+// Normalize checks a value typed by the user and returns it the way it is stored.
+// Person and relation values are checked against the database by the caller.
+func (p Property) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+
+	switch p.Type {
+	case PropertyNumber:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a number", p.Name)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+
+	case PropertySelect:
+		option, ok := p.option(raw)
+		if !ok {
+			return "", fmt.Errorf("%s must be one of %s", p.Name, strings.Join(p.Options, ", "))
+		}
+		return option, nil
+
+	case PropertyMultiSelect:
+		var values []string
+		for _, v := range SplitList(raw) {
+			option, ok := p.option(v)
+			if !ok {
+				return "", fmt.Errorf("%s values must be among %s", p.Name, strings.Join(p.Options, ", "))
+			}
+			values = append(values, option)
+		}
+		return strings.Join(values, ", "), nil
+
+	case PropertyDate:
+		t, err := time.Parse(DateLayout, raw)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a date like 2024-07-31", p.Name)
+		}
+		return t.Format(DateLayout), nil
+
+	case PropertyCheckbox:
+		switch strings.ToLower(raw) {
+		case "true", "yes", "y", "x", "1":
+			return "true", nil
+		case "false", "no", "n", "0":
+			return "false", nil
+		}
+		return "", fmt.Errorf("%s must be yes or no", p.Name)
+	}
+	return raw, nil
+}
+
+// option returns the option matching v regardless of case
+func (p Property) option(v string) (string, bool) {
+	for _, option := range p.Options {
+		if strings.EqualFold(option, v) {
+			return option, true
+		}
+	}
+	return "", false
+}
+
+// Display renders a stored value for the table
+func (p Property) Display(value string) string {
+	switch p.Type {
+	case PropertyCheckbox:
+		if value == "true" {
+			return "[x]"
+		}
+		return "[ ]"
+	case PropertyRelation:
+		var titles []string
+		for _, id := range SplitList(value) {
+			if n, err := strconv.Atoi(id); err == nil {
+				titles = append(titles, p.Pages[n])
+			}
+		}
+		return strings.Join(titles, ", ")
+	}
+	return value
+}
+
+// compare orders two stored values of the property, empty values last
+func (p Property) compare(a, b string) int {
+	if a == "" || b == "" {
+		return boolCompare(a == "", b == "")
+	}
+	switch p.Type {
+	case PropertyNumber:
+		x, _ := strconv.ParseFloat(a, 64)
+		y, _ := strconv.ParseFloat(b, 64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case PropertySelect:
+		// Selects sort in the order their options were declared, like board columns
+		return p.optionIndex(a) - p.optionIndex(b)
+	case PropertyRelation:
+		a, b = p.Display(a), p.Display(b)
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// optionIndex is the position of a select option, unknown options go last
+func (p Property) optionIndex(v string) int {
+	for index, option := range p.Options {
+		if option == v {
+			return index
+		}
+	}
+	return len(p.Options)
+}
+
+func boolCompare(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// SplitList splits a comma separated multi-select or relation value, dropping blanks
+func SplitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// TitleColumn is the column index of the page title, which every database has
+const TitleColumn = -1
+
+// value returns what a row holds in a column, its title for TitleColumn
+func (c Collection) value(row Row, column int) string {
+	if column == TitleColumn {
+		return row.Note.Title()
+	}
+	return row.Values[c.Properties[column].ID]
+}
+
+// Column finds a column by name regardless of case; "title" and "name" are the page title
+func (c Collection) Column(name string) (int, bool) {
+	name = strings.TrimSpace(name)
+	for index, p := range c.Properties {
+		if strings.EqualFold(p.Name, name) {
+			return index, true
+		}
+	}
+	if strings.EqualFold(name, "title") || strings.EqualFold(name, "name") {
+		return TitleColumn, true
+	}
+	return 0, false
+}
+
+// SortRows orders rows by a column, keeping the current order between equal values
+func (c Collection) SortRows(rows []Row, column int, desc bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := c.value(rows[i], column), c.value(rows[j], column)
+		var cmp int
+		if column == TitleColumn {
+			cmp = strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		} else {
+			cmp = c.Properties[column].compare(a, b)
+		}
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+// Filter keeps the rows whose column compares to Value with Op
+type Filter struct {
+	Column int
+	Op     string // one of = != < > <= >= ~ (contains)
+	Value  string
+}
+
+// filterOps are the comparisons a filter can make, two-character ones first so that
+// != is not read as = when both start at the same place
+var filterOps = []string{"!=", "<=", ">=", "=", "<", ">", "~"}
+
+// ParseFilter reads a filter like "Status = Done", "Estimate >= 3" or "title ~ draft".
+// The operator is the first one in the expression, so values may hold operators of their own.
+func (c Collection) ParseFilter(expr string) (Filter, error) {
+	at, op := -1, ""
+	for _, candidate := range filterOps {
+		if i := strings.Index(expr, candidate); i >= 0 && (at < 0 || i < at) {
+			at, op = i, candidate
+		}
+	}
+	if at < 0 {
+		return Filter{}, fmt.Errorf("use a filter like: Status = Done")
+	}
+	name, value := expr[:at], expr[at+len(op):]
+	if strings.HasPrefix(value, "=") || strings.HasPrefix(value, "<") || strings.HasPrefix(value, ">") {
+		return Filter{}, fmt.Errorf("unknown comparison %q, use one of = != < > <= >= ~", op+value[:1])
+	}
+
+	column, ok := c.Column(name)
+	if !ok {
+		return Filter{}, fmt.Errorf("no property named %q", strings.TrimSpace(name))
+	}
+	f := Filter{Column: column, Op: op, Value: strings.TrimSpace(value)}
+	if column != TitleColumn && op != "~" {
+		// Compare against the stored form so "yes" matches checked boxes and 3 matches 3.0
+		p := c.Properties[column]
+		if p.Type != PropertyMultiSelect && p.Type != PropertyRelation {
+			normalized, err := p.Normalize(f.Value)
+			if err != nil {
+				return Filter{}, err
+			}
+			f.Value = normalized
+		}
+	}
+	return f, nil
+}
+
+// Match reports whether the row passes the filter
+func (c Collection) Match(f Filter, row Row) bool {
+	value := c.value(row, f.Column)
+	var p Property
+	if f.Column != TitleColumn {
+		p = c.Properties[f.Column]
+	}
+
+	switch f.Op {
+	case "~":
+		display := value
+		if f.Column != TitleColumn {
+			display = p.Display(value)
+		}
+		return strings.Contains(strings.ToLower(display), strings.ToLower(f.Value))
+	case "<", ">", "<=", ">=":
+		if value == "" || f.Column == TitleColumn {
+			return false
+		}
+		cmp := p.compare(value, f.Value)
+		switch f.Op {
+		case "<":
+			return cmp < 0
+		case ">":
+			return cmp > 0
+		case "<=":
+			return cmp <= 0
+		}
+		return cmp >= 0
+	}
+
+	equal := strings.EqualFold(value, f.Value)
+	switch {
+	case p.Type == PropertyCheckbox && f.Value == "false":
+		// Unchecked boxes are never written, so empty counts as unchecked
+		equal = value != "true"
+	case p.Type == PropertyMultiSelect || p.Type == PropertyRelation:
+		// A list equals a value when it contains it
+		equal = false
+		for _, v := range SplitList(p.Display(value)) {
+			equal = equal || strings.EqualFold(v, f.Value)
+		}
+	}
+	if f.Op == "!=" {
+		return !equal
+	}
+	return equal
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testCollection is a database with one property of the types filters treat differently
+func testCollection() Collection {
+	return Collection{Properties: []Property{
+		{ID: 1, Name: "Status", Type: PropertySelect, Options: []string{"Todo", "Doing", "Done"}},
+		{ID: 2, Name: "Estimate", Type: PropertyNumber},
+		{ID: 3, Name: "Tags", Type: PropertyMultiSelect, Options: []string{"bug", "ui"}},
+		{ID: 4, Name: "Shipped", Type: PropertyCheckbox},
+		{ID: 5, Name: "Note", Type: PropertyText},
+	}}
+}
+
+func testRow(title string, values map[int]string) Row {
+	return Row{Note: ListItemViewModel{ItemTitle: title}, Values: values}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    Filter
+		wantErr bool
+	}{
+		{expr: "Status = done", want: Filter{Column: 0, Op: "=", Value: "Done"}},
+		{expr: "status != Todo", want: Filter{Column: 0, Op: "!=", Value: "Todo"}},
+		{expr: "Estimate >= 3.0", want: Filter{Column: 1, Op: ">=", Value: "3"}},
+		{expr: "Estimate<=2", want: Filter{Column: 1, Op: "<=", Value: "2"}},
+		{expr: "Estimate > 1", want: Filter{Column: 1, Op: ">", Value: "1"}},
+		{expr: "title ~ draft", want: Filter{Column: TitleColumn, Op: "~", Value: "draft"}},
+		{expr: "Shipped = yes", want: Filter{Column: 3, Op: "=", Value: "true"}},
+		{expr: "Tags = bug", want: Filter{Column: 2, Op: "=", Value: "bug"}},
+		// The first operator splits, the rest belongs to the value
+		{expr: "Note = a != b", want: Filter{Column: 4, Op: "=", Value: "a != b"}},
+		{expr: "Note ~ x=y", want: Filter{Column: 4, Op: "~", Value: "x=y"}},
+		{expr: "Estimate => 3", wantErr: true},
+		{expr: "Estimate == 3", wantErr: true},
+		{expr: "Status", wantErr: true},
+		{expr: "Owner = me", wantErr: true},
+		{expr: "Status = Blocked", wantErr: true},
+		{expr: "Estimate > many", wantErr: true},
+	}
+	c := testCollection()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := c.ParseFilter(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseFilter(%q) = %+v, want %+v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	row := testRow("Draft plan", map[int]string{1: "Doing", 2: "3", 3: "bug, ui"})
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"Status = Doing", true},
+		{"Status != Doing", false},
+		{"Status = Done", false},
+		{"Estimate = 3", true},
+		{"Estimate < 3", false},
+		{"Estimate <= 3", true},
+		{"Estimate > 2.5", true},
+		{"Estimate >= 4", false},
+		{"title ~ PLAN", true},
+		{"title = draft plan", true},
+		{"Tags = ui", true},
+		{"Tags != ui", false},
+		{"Tags ~ bu", true},
+		// Unchecked boxes are stored as nothing
+		{"Shipped = no", true},
+		{"Shipped = yes", false},
+		// Empty values never compare
+		{"Note < z", false},
+	}
+	c := testCollection()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := c.ParseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseFilter(%q): %v", tt.expr, err)
+			}
+			if got := c.Match(f, row); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortRows(t *testing.T) {
+	rows := []Row{
+		testRow("b", map[int]string{1: "Done", 2: "10"}),
+		testRow("C", map[int]string{1: "Todo"}),
+		testRow("a", map[int]string{1: "Doing", 2: "9"}),
+		testRow("d", map[int]string{1: "Todo", 2: "2"}),
+	}
+	tests := []struct {
+		name   string
+		column int
+		desc   bool
+		want   []string
+	}{
+		{name: "title ignores case", column: TitleColumn, want: []string{"a", "b", "C", "d"}},
+		{name: "title descending", column: TitleColumn, desc: true, want: []string{"d", "C", "b", "a"}},
+		{name: "select by option order, ties kept", column: 0, want: []string{"C", "d", "a", "b"}},
+		{name: "numbers by value, empty last", column: 1, want: []string{"d", "a", "b", "C"}},
+	}
+	c := testCollection()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted := append([]Row(nil), rows...)
+			c.SortRows(sorted, tt.column, tt.desc)
+			var got []string
+			for _, row := range sorted {
+				got = append(got, row.Note.ItemTitle)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SortRows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"strings"
+	"time"
+
 	"github.com/charmbracelet/lipgloss"
 
 	_ "github.com/lib/pq"
@@ -8,10 +11,20 @@ import (
 
 // Define the list item view model struct
 type ListItemViewModel struct {
+	ID              int
+	Version         int
 	ItemTitle       string
 	Desc            string
 	Content         string
 	ShowItemContent bool
+	Role            Role      // what the current user may do with the note
+	Owner           string    // email of the owner, for notes shared with the current user
+	WorkspaceID     int       // 0 for the owner's personal notes
+	Due             time.Time // zero when the note has no due date
+	Daily           time.Time // day of a daily note, zero for other notes
+	AuthorID        int       // user who wrote the note, whose passphrase seals it when private
+	Private         bool      // title, description and content are sealed with the author's passphrase
+	Opened          bool      // the private note was unsealed with the session's passphrase
 }
 type Dimensions struct {
 	TotalWidth  int
@@ -19,9 +32,33 @@ type Dimensions struct {
 }
 
 // Methods to fulfill the list.Item interface
-func (i ListItemViewModel) FilterValue() string { return i.ItemTitle }
-func (i ListItemViewModel) Title() string       { return i.ItemTitle }
-func (i ListItemViewModel) Description() string { return i.Desc }
+func (i ListItemViewModel) FilterValue() string { return i.Title() }
+func (i ListItemViewModel) Title() string {
+	if i.Locked() {
+		return "🔒 Private note"
+	}
+	return i.ItemTitle
+}
+func (i ListItemViewModel) Description() string {
+	if i.Private {
+		return "🔒 private"
+	}
+	return i.Desc
+}
+
+// Locked reports whether the note is private and still sealed
+func (i ListItemViewModel) Locked() bool {
+	return i.Private && !i.Opened
+}
+
+// Subject names the note in what is read outside the author's session, like notifications
+// and commit messages, where the title of a private note must not show
+func (i ListItemViewModel) Subject() string {
+	if i.Private {
+		return "a private note"
+	}
+	return i.ItemTitle
+}
 
 // Renders the individual item view
 func (m ListItemViewModel) View() string {
@@ -31,6 +68,56 @@ func (m ListItemViewModel) View() string {
 	)
 }
 
+// EditorText lays a note out the way the editor expects it: title, description, then content
+func EditorText(item ListItemViewModel) string {
+	return item.ItemTitle + "\n" + item.Desc + "\n" + item.Content
+}
+
+// ParseEditorText splits the editor content back into title, description and content
+func ParseEditorText(fullText string) ListItemViewModel {
+	// Split the content by lines
+	lines := strings.Split(fullText, "\n")
+
+	var item ListItemViewModel
+	if len(lines) > 0 {
+		item.ItemTitle = lines[0]
+	}
+	if len(lines) > 1 {
+		item.Desc = lines[1]
+	}
+	if len(lines) > 2 {
+		item.Content = strings.Join(lines[2:], "\n")
+	}
+	return item
+}
+
+// FileName turns a title into a file name every file system accepts, without extension
+func FileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	name = strings.Trim(name, ". ")
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+	if name == "" {
+		return "Untitled"
+	}
+	return name
+}
+
+// Define the header separating shared notes from the user's own in the list
+type SectionHeader struct {
+	Name string
+}
+
+func (h SectionHeader) FilterValue() string { return "" }
+func (h SectionHeader) Title() string       { return "── " + h.Name + " ──" }
+func (h SectionHeader) Description() string { return "" }
+
 // Struct to hold a slice of items
 type ItemsMsg struct {
 	Items []ListItemViewModel
@@ -0,0 +1,47 @@
+package models
+
+// Role is what a user may do with a note, each role including the ones before it
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleCommenter
+	RoleEditor
+	RoleOwner
+)
+
+var roleNames = map[Role]string{
+	RoleNone:      "none",
+	RoleViewer:    "viewer",
+	RoleCommenter: "commenter",
+	RoleEditor:    "editor",
+	RoleOwner:     "owner",
+}
+
+func (r Role) String() string { return roleNames[r] }
+
+// ParseRole turns a stored role name back into a Role, unknown names grant nothing
+func ParseRole(name string) Role {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role
+		}
+	}
+	return RoleNone
+}
+
+// WorkspaceRole is a user's membership level in a workspace
+type WorkspaceRole string
+
+const (
+	WorkspaceOwner  WorkspaceRole = "owner"  // manages members, including admins, and sees every note
+	WorkspaceAdmin  WorkspaceRole = "admin"  // manages members and sees every note
+	WorkspaceMember WorkspaceRole = "member" // reads and edits every note, creates notes
+	WorkspaceGuest  WorkspaceRole = "guest"  // only sees notes explicitly shared with them
+)
+
+// CanManage reports whether the role may invite and remove members
+func (r WorkspaceRole) CanManage() bool {
+	return r == WorkspaceOwner || r == WorkspaceAdmin
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Task is a markdown checklist item of a note, "- [ ] text @due(2026-11-01)"
+type Task struct {
+	NoteID    int
+	NoteTitle string
+	Role      Role // what the current user may do with the note
+	Line      int  // index of the line in the note's content
+	Text      string
+	Done      bool
+	Due       time.Time // zero when the task has no @due
+}
+
+var (
+	taskPattern = regexp.MustCompile(`^(\s*[-*+]\s+\[)([ xX])(\]\s+)(.*)$`)
+	duePattern  = regexp.MustCompile(`@due\((\d{4}-\d{2}-\d{2})\)`)
+)
+
+// ParseTasks finds the checklist items of a note's content, skipping empty ones
+func ParseTasks(content string) []Task {
+	var tasks []Task
+	for index, line := range strings.Split(content, "\n") {
+		match := taskPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		task := Task{Line: index, Done: match[2] != " ", Text: match[4]}
+		if due := duePattern.FindStringSubmatch(task.Text); due != nil {
+			task.Due, _ = time.Parse(DateLayout, due[1])
+			task.Text = duePattern.ReplaceAllString(task.Text, "")
+		}
+		task.Text = strings.Join(strings.Fields(task.Text), " ")
+		if task.Text != "" {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// SetTaskDone checks or unchecks the task of the content, which must still read the same.
+// It reports false when the line no longer holds that task.
+func SetTaskDone(content string, task Task, done bool) (string, bool) {
+	lines := strings.Split(content, "\n")
+	if task.Line >= len(lines) {
+		return content, false
+	}
+	current := ParseTasks(lines[task.Line])
+	if len(current) != 1 || current[0].Text != task.Text {
+		return content, false
+	}
+
+	box := " "
+	if done {
+		box = "x"
+	}
+	lines[task.Line] = taskPattern.ReplaceAllString(lines[task.Line], "${1}"+box+"${3}${4}")
+	return strings.Join(lines, "\n"), true
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTasks(t *testing.T) {
+	content := "# Plan\n- [ ] write  the draft @due(2026-11-01)\n  * [x] review\n+ [X] ship\n- [ ]   \n- not a task\n-[ ] no space"
+	want := []Task{
+		{Line: 1, Text: "write the draft", Due: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{Line: 2, Text: "review", Done: true},
+		{Line: 3, Text: "ship", Done: true},
+	}
+	got := ParseTasks(content)
+	if len(got) != len(want) {
+		t.Fatalf("ParseTasks() found %d tasks, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Line != want[i].Line || got[i].Text != want[i].Text || got[i].Done != want[i].Done || !got[i].Due.Equal(want[i].Due) {
+			t.Errorf("task %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSetTaskDone(t *testing.T) {
+	content := "intro\n- [ ] first @due(2026-11-01)\n  - [x] second"
+	tests := []struct {
+		name    string
+		content string
+		task    Task
+		done    bool
+		want    string
+		wantOK  bool
+	}{
+		{
+			name: "check", content: content, task: Task{Line: 1, Text: "first"}, done: true,
+			want: "intro\n- [x] first @due(2026-11-01)\n  - [x] second", wantOK: true,
+		},
+		{
+			name: "uncheck keeps indentation", content: content, task: Task{Line: 2, Text: "second"}, done: false,
+			want: "intro\n- [ ] first @due(2026-11-01)\n  - [ ] second", wantOK: true,
+		},
+		{
+			name: "line now holds another task", content: content, task: Task{Line: 1, Text: "second"}, done: true,
+			want: content,
+		},
+		{
+			name: "line is not a task", content: content, task: Task{Line: 0, Text: "intro"}, done: true,
+			want: content,
+		},
+		{
+			name: "line is gone", content: content, task: Task{Line: 5, Text: "first"}, done: true,
+			want: content,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SetTaskDone(tt.content, tt.task, tt.done)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("SetTaskDone() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Template is a starting point for new notes. {{date}}, {{time}}, {{user}} and {{workspace}}
+// are filled in automatically, any other {{name}} is asked for when the template is used.
+type Template struct {
+	ID          int // 0 for built-in templates
+	Name        string
+	WorkspaceID int // 0 for the creator's personal templates
+	Title       string
+	Desc        string
+	Content     string
+	CanDelete   bool // whether the current user may remove it from the library
+}
+
+// TemplateVariables are filled in without asking
+var TemplateVariables = []string{"date", "time", "user", "workspace"}
+
+var variablePattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// Fields lists the names the user has to fill in, in the order they first appear
+func (t Template) Fields() []string {
+	var fields []string
+	seen := map[string]bool{}
+	for _, text := range []string{t.Title, t.Desc, t.Content} {
+		for _, match := range variablePattern.FindAllStringSubmatch(text, -1) {
+			name := match[1]
+			if seen[strings.ToLower(name)] || isTemplateVariable(name) {
+				continue
+			}
+			seen[strings.ToLower(name)] = true
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+func isTemplateVariable(name string) bool {
+	for _, v := range TemplateVariables {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand replaces the variables of the template, matched regardless of case
+func (t Template) Expand(values map[string]string) ListItemViewModel {
+	lower := map[string]string{}
+	for name, value := range values {
+		lower[strings.ToLower(name)] = value
+	}
+	expand := func(text string) string {
+		return variablePattern.ReplaceAllStringFunc(text, func(match string) string {
+			name := strings.ToLower(variablePattern.FindStringSubmatch(match)[1])
+			if value, ok := lower[name]; ok {
+				return value
+			}
+			return match
+		})
+	}
+	return ListItemViewModel{ItemTitle: expand(t.Title), Desc: expand(t.Desc), Content: expand(t.Content)}
+}
+
+// BuiltinTemplates are offered to everyone after their own templates
+var BuiltinTemplates = []Template{
+	{
+		Name:  "Meeting notes",
+		Title: "{{Meeting}} {{date}}",
+		Desc:  "Meeting notes by {{user}}",
+		Content: `## Attendees
+{{Attendees}}
+
+## Agenda
+
+## Notes
+
+## Action items
+- [ ]
+`,
+	},
+	{
+		Name:  "RFC",
+		Title: "RFC: {{Title}}",
+		Desc:  "Proposed by {{user}} on {{date}}",
+		Content: `## Summary
+
+## Motivation
+
+## Proposal
+
+## Alternatives considered
+
+## Open questions
+`,
+	},
+	{
+		Name:  "Incident report",
+		Title: "Incident: {{Summary}}",
+		Desc:  "Severity {{Severity}}, reported {{date}} {{time}}",
+		Content: `## Impact
+
+## Timeline
+- {{time}} incident reported by {{user}}
+
+## Root cause
+
+## Remediation
+- [ ]
+
+## Follow-ups
+- [ ]
+`,
+	},
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTemplateFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		template Template
+		want     []string
+	}{
+		{name: "no variables", template: Template{Title: "Plain", Content: "text"}},
+		{name: "automatic variables are not asked for", template: Template{Title: "{{date}} {{ User }}", Desc: "{{WORKSPACE}} {{time}}"}},
+		{
+			name:     "in order of first appearance, regardless of case",
+			template: Template{Title: "{{Meeting}} {{date}}", Desc: "{{ Room }}", Content: "{{meeting}}\n{{Attendees}}\n{{room}}"},
+			want:     []string{"Meeting", "Room", "Attendees"},
+		},
+		{name: "unclosed braces", template: Template{Content: "{{Name} and {Other}}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.template.Fields(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fields() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateExpand(t *testing.T) {
+	template := Template{
+		Title:   "{{Meeting}} {{date}}",
+		Desc:    "by {{ user }}",
+		Content: "{{meeting}} with {{Attendees}} at {{unknown}}",
+	}
+	values := map[string]string{"meeting": "Standup", "Date": "2026-10-19", "USER": "ada", "attendees": "{{user}}"}
+	want := ListItemViewModel{
+		ItemTitle: "Standup 2026-10-19",
+		Desc:      "by ada",
+		// Values are not expanded again, and unknown names stay as they are
+		Content: "Standup with {{user}} at {{unknown}}",
+	}
+	if got := template.Expand(values); got.ItemTitle != want.ItemTitle || got.Desc != want.Desc || got.Content != want.Content {
+		t.Errorf("Expand() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package notify
+
+import (
+	"fmt"
+	"strconv"
+
+	"notion_ssh_app/internal/app/collab"
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/models"
+)
+
+// Kinds of notifications
+const (
+	KindShare    = "share"
+	KindReply    = "reply"
+	KindMention  = "mention"
+	KindEdit     = "edit"
+	KindReminder = "reminder"
+	KindGit      = "git"
+)
+
+// Msg delivers a notification to the sessions of its recipient as it happens
+type Msg struct {
+	Notification db.Notification
+}
+
+// Send records the notification in the recipient's inbox and shows it in their open sessions.
+// Notifications about a note the recipient can no longer read are dropped.
+func Send(n db.Notification) {
+	if n.NoteID != 0 {
+		readable, _, err := db.NoteAccess(n.NoteID, n.UserID)
+		if err != nil {
+			fmt.Println("Error checking note access:", err)
+			return
+		}
+		if !readable {
+			return
+		}
+	}
+	n, err := db.AddNotification(n)
+	if err != nil {
+		fmt.Println("Error recording notification:", err)
+		return
+	}
+	collab.SendToUser(n.UserID, Msg{Notification: n})
+}
+
+// noteName quotes the title of a note for the text of a notification, which must not show
+// the title of a private note
+func noteName(noteID int, title string) string {
+	_, private, err := db.NoteAccess(noteID, 0)
+	if err != nil {
+		fmt.Println("Error checking note access:", err)
+		return "a note"
+	}
+	if private {
+		return "a private note"
+	}
+	return strconv.Quote(title)
+}
+
+// ShareGranted tells a user a note was shared with them
+func ShareGranted(noteID int, title string, actorID int, actor string, userID int, role models.Role) {
+	if role == models.RoleNone || userID == actorID {
+		return
+	}
+	name := noteName(noteID, title)
+	Send(db.Notification{
+		UserID:  userID,
+		Kind:    KindShare,
+		ActorID: actorID,
+		NoteID:  noteID,
+		Body:    fmt.Sprintf("%s shared %s with you as %s", actor, name, role),
+	})
+}
+
+// CommentPosted tells the people mentioned in a comment, and for replies the others
+// in the thread, that it was posted. Being mentioned takes precedence over the reply.
+func CommentPosted(noteID int, title string, actorID int, actor string, c db.Comment) {
+	name := noteName(noteID, title)
+	notified := map[int]bool{actorID: true}
+	for _, userID := range c.Mentions {
+		notified[userID] = true
+		Send(db.Notification{
+			UserID:  userID,
+			Kind:    KindMention,
+			ActorID: actorID,
+			NoteID:  noteID,
+			Body:    fmt.Sprintf("%s mentioned you on %s: %s", actor, name, c.Body),
+		})
+	}
+	if c.ParentID == 0 {
+		return
+	}
+
+	participants, err := db.ThreadParticipants(c.ParentID)
+	if err != nil {
+		fmt.Println("Error fetching thread participants:", err)
+		return
+	}
+	for _, userID := range participants {
+		if notified[userID] {
+			continue
+		}
+		notified[userID] = true
+		Send(db.Notification{
+			UserID:  userID,
+			Kind:    KindReply,
+			ActorID: actorID,
+			NoteID:  noteID,
+			Body:    fmt.Sprintf("%s replied on %s: %s", actor, name, c.Body),
+		})
+	}
+}
+
+// NoteEdited tells the followers of a note that it was saved
+func NoteEdited(noteID int, title string, actorID int, actor string) {
+	followers, err := db.NoteFollowers(noteID)
+	if err != nil {
+		fmt.Println("Error fetching note followers:", err)
+		return
+	}
+	name := noteName(noteID, title)
+	for _, userID := range followers {
+		if userID == actorID {
+			continue
+		}
+		Send(db.Notification{
+			UserID:  userID,
+			Kind:    KindEdit,
+			ActorID: actorID,
+			NoteID:  noteID,
+			Body:    fmt.Sprintf("%s edited %s", actor, name),
+		})
+	}
+}
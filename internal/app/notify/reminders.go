@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"notion_ssh_app/internal/app/collab"
+	"notion_ssh_app/internal/app/db"
+)
+
+// ToastMsg pops a reminder up in the sessions of its recipient
+type ToastMsg struct {
+	Notification db.Notification
+}
+
+// RunReminders fires due reminders every interval until ctx is done. Reminders show up as a
+// toast when their user is connected, and wait unread in the inbox otherwise.
+func RunReminders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fireReminders()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fireReminders delivers the reminders whose time has come
+func fireReminders() {
+	notifications, err := db.FireDueReminders()
+	if err != nil {
+		fmt.Println("Error firing reminders:", err)
+		return
+	}
+	for _, n := range notifications {
+		if !collab.SendToUser(n.UserID, ToastMsg{Notification: n}) {
+			continue
+		}
+		// Seen as a toast, the inbox keeps it as read
+		if err := db.MarkNotificationsRead(n.UserID, n.ID); err != nil {
+			fmt.Println("Error marking reminder read:", err)
+		}
+	}
+}
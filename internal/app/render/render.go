@@ -0,0 +1,140 @@
+// Package render turns notes into standalone HTML pages, for the web and for files
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// Page is what a rendered note shows
+type Page struct {
+	Title       string
+	Description string
+	Content     string // markdown
+	Footer      string
+	Print       bool // lay the page out for paper: no colors, urls after links, code kept on one page
+}
+
+// codeStyle colors highlighted code, print uses a style that survives black and white printers
+var (
+	codeStyle  = styles.Get("github")
+	printStyle = styles.Get("bw")
+)
+
+// formatter writes highlighted code with classes, their colors come from the page's stylesheet
+var formatter = chromahtml.New(chromahtml.WithClasses(true), chromahtml.TabWidth(4))
+
+// markdown renders notes the way GitHub does, with highlighted code blocks; raw HTML in notes is dropped
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(codeRenderer{}, 200))),
+)
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 46rem; margin: 3rem auto; padding: 0 1rem; font: 16px/1.6 system-ui, sans-serif; color: #1f1f1f; }
+h1.title { color: #7571F9; margin-bottom: 0; }
+p.description { color: #666; margin-top: .25rem; }
+pre { background: #f5f5f7; padding: 1rem; overflow-x: auto; }
+code { font-family: ui-monospace, monospace; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ddd; padding: .25rem .5rem; }
+footer { margin-top: 3rem; color: #999; font-size: .85rem; }
+{{if .Print -}}
+@page { size: A4; margin: 2cm; }
+body { max-width: none; margin: 0; padding: 0; font: 11pt/1.5 Georgia, serif; color: #000; }
+h1.title { color: #000; }
+pre { background: none; border: 1px solid #999; white-space: pre-wrap; page-break-inside: avoid; }
+h1, h2, h3 { page-break-after: avoid; }
+a { color: #000; }
+a[href^="http"]::after { content: " (" attr(href) ")"; font-size: .85em; }
+{{- end}}
+{{.CodeCSS}}
+</style>
+</head>
+<body>
+<h1 class="title">{{.Title}}</h1>
+{{with .Description}}<p class="description">{{.}}</p>{{end}}
+<article>{{.Body}}</article>
+{{with .Footer}}<footer>{{.}}</footer>{{end}}
+</body>
+</html>
+`))
+
+// Write renders the page as a standalone HTML document, styles included
+func Write(w io.Writer, p Page) error {
+	var body bytes.Buffer
+	if err := markdown.Convert([]byte(p.Content), &body); err != nil {
+		return err
+	}
+	style := codeStyle
+	if p.Print {
+		style = printStyle
+	}
+	var css strings.Builder
+	if err := formatter.WriteCSS(&css, style); err != nil {
+		return err
+	}
+	return pageTemplate.Execute(w, map[string]any{
+		"Title":       p.Title,
+		"Description": p.Description,
+		"Footer":      p.Footer,
+		"Print":       p.Print,
+		"Body":        template.HTML(body.String()),
+		"CodeCSS":     template.CSS(css.String()),
+	})
+}
+
+// codeRenderer highlights code blocks with chroma, by their language or by guessing it
+type codeRenderer struct{}
+
+func (r codeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderCode)
+	reg.Register(ast.KindCodeBlock, r.renderCode)
+}
+
+func (r codeRenderer) renderCode(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var code bytes.Buffer
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		code.Write(segment.Value(source))
+	}
+
+	var lexer chroma.Lexer
+	if fenced, ok := node.(*ast.FencedCodeBlock); ok && fenced.Info != nil {
+		lexer = lexers.Get(string(fenced.Language(source)))
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(code.String())
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	return ast.WalkSkipChildren, formatter.Format(w, codeStyle, iterator)
+}
@@ -0,0 +1,104 @@
+// Package vault seals private notes with a key derived from a passphrase only the user knows.
+// The key lives in the ssh session that derived it, so the server stores and sees nothing but
+// ciphertext, and a forgotten passphrase cannot be recovered.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Prefix starts every sealed value, followed by the base64 nonce and ciphertext
+const Prefix = "priv:v1:"
+
+// MinPassphrase is the shortest passphrase accepted for a new vault
+const MinPassphrase = 8
+
+// checkText is sealed with the key when the vault is created, to tell wrong passphrases apart
+const checkText = "notion_ssh_app/vault"
+
+// ErrWrongPassphrase is returned when a key does not open a sealed value
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// IsSealed reports whether a value was sealed with a vault key
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// NewSalt returns a random salt for DeriveKey, base64 encoded for storage
+func NewSalt() (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(salt), nil
+}
+
+// DeriveKey stretches a passphrase into a 32 byte key with argon2id
+func DeriveKey(passphrase, salt string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, err
+	}
+	return argon2.IDKey([]byte(passphrase), raw, 1, 64*1024, 4, 32), nil
+}
+
+// Check returns the value stored alongside the salt, which only key opens
+func Check(key []byte) (string, error) {
+	return Seal(key, checkText)
+}
+
+// Verify reports whether key is the one check was made with
+func Verify(key []byte, check string) bool {
+	text, err := Open(key, check)
+	return err == nil && text == checkText
+}
+
+// Seal encrypts a value with AES-GCM under a random nonce
+func Seal(key []byte, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a sealed value, returning values that are not sealed as they are
+func Open(key []byte, value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrWrongPassphrase
+	}
+	text, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(text), nil
+}
+
+// newAEAD returns AES-256-GCM with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
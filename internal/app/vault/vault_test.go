@@ -0,0 +1,64 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DeriveKey("correct horse", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := DeriveKey("wrong horse", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := DeriveKey("correct horse", salt); !bytes.Equal(key, again) {
+		t.Fatal("DeriveKey gives different keys for the same passphrase and salt")
+	}
+
+	sealed, err := Seal(key, "my diary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		key     []byte
+		value   string
+		want    string
+		wantErr error
+	}{
+		{name: "right key", key: key, value: sealed, want: "my diary"},
+		{name: "wrong key", key: other, value: sealed, wantErr: ErrWrongPassphrase},
+		{name: "plaintext is returned as is", key: key, value: "not sealed", want: "not sealed"},
+		{name: "truncated", key: key, value: sealed[:len(Prefix)+8], wantErr: ErrWrongPassphrase},
+		{name: "not base64", key: key, value: Prefix + "!!!", wantErr: ErrWrongPassphrase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Open(tt.key, tt.value)
+			if err != tt.wantErr || got != tt.want {
+				t.Errorf("Open() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	if !IsSealed(sealed) || IsSealed("my diary") {
+		t.Error("IsSealed does not tell sealed values apart")
+	}
+	if again, _ := Seal(key, "my diary"); again == sealed {
+		t.Error("Seal reuses its nonce")
+	}
+	check, err := Check(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(key, check) || Verify(other, check) {
+		t.Error("Verify does not tell the passphrases apart")
+	}
+}
@@ -0,0 +1,148 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+
+	"notion_ssh_app/internal/app/blobs"
+	"notion_ssh_app/internal/app/db"
+	"notion_ssh_app/internal/app/export"
+	"notion_ssh_app/internal/app/models"
+	"notion_ssh_app/internal/app/render"
+)
+
+// defaultBaseURL is used for links when PUBLIC_URL is not set
+const defaultBaseURL = "http://localhost:23237"
+
+// BaseURL is where the HTTP listener can be reached from the outside
+func BaseURL() string {
+	if url := os.Getenv("PUBLIC_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return defaultBaseURL
+}
+
+// ExportURL is the single-use download link of an export
+func ExportURL(token string) string {
+	return BaseURL() + "/export/" + token
+}
+
+// PublicationURL is the public link of a published note
+func PublicationURL(slug string) string {
+	return BaseURL() + "/p/" + slug
+}
+
+// AttachmentURL is the download link of an attachment
+func AttachmentURL(token string) string {
+	return BaseURL() + "/attachments/" + token
+}
+
+// Handler serves published notes at /p/{slug}, their print layout at /p/{slug}/print, exports
+// at /export/{token} and attachments at /attachments/{token}. Adding ?download to a note's
+// link saves it as a file.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /p/{slug}", func(w http.ResponseWriter, r *http.Request) { servePublication(w, r, false) })
+	mux.HandleFunc("GET /p/{slug}/print", func(w http.ResponseWriter, r *http.Request) { servePublication(w, r, true) })
+	mux.HandleFunc("GET /export/{token}", serveExport)
+	mux.HandleFunc("GET /attachments/{token}", serveAttachment)
+	return mux
+}
+
+// servePublication renders a published note's markdown to HTML
+func servePublication(w http.ResponseWriter, r *http.Request, print bool) {
+	item, err := db.PublishedNote(r.PathValue("slug"))
+	if err == db.ErrNotPublished {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Error("Could not load published note", "error", err)
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	var page bytes.Buffer
+	err = render.Write(&page, render.Page{
+		Title:       item.ItemTitle,
+		Description: item.Desc,
+		Content:     item.Content,
+		Footer:      "Published with NotionTerm.sh",
+		Print:       print,
+	})
+	if err != nil {
+		log.Error("Could not render published note", "error", err)
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src https: data:")
+	if r.URL.Query().Has("download") {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": models.FileName(item.ItemTitle) + ".html"}))
+	}
+	if _, err := page.WriteTo(w); err != nil {
+		log.Error("Could not write published note", "error", err)
+	}
+}
+
+// serveExport streams the zip of the user's notes a download link was created for
+func serveExport(w http.ResponseWriter, r *http.Request) {
+	userID, err := db.RedeemExportLink(r.PathValue("token"))
+	if err == db.ErrExportLinkInvalid {
+		http.Error(w, "this download link expired or was already used, create a new one from the app", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Could not redeem export link", "error", err)
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.Filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	if err := export.Zip(w, userID); err != nil {
+		// Headers are gone already, the truncated archive fails to open
+		log.Error("Could not write export", "error", err)
+	}
+}
+
+// serveAttachment streams an attachment a download link was created for. It is always saved as
+// a file rather than shown, so that uploaded HTML cannot run as this site.
+func serveAttachment(w http.ResponseWriter, r *http.Request) {
+	a, err := db.AttachmentByLink(r.PathValue("token"))
+	if err == db.ErrAttachmentLinkInvalid {
+		http.Error(w, "this download link expired, create a new one from the app", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Could not look up attachment link", "error", err)
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+	blob, err := blobs.Default.Open(a.BlobKey)
+	if err != nil {
+		log.Error("Could not open attachment", "error", err)
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Error("Could not write attachment", "error", err)
+	}
+}